@@ -8,6 +8,11 @@ export interface StoryRequest {
   primary_characters: string
   secondary_characters: string
   l_chapter: number
+  primary_character_ids?: string[] // Library characters appended to primary_characters
+  secondary_character_ids?: string[] // Library characters appended to secondary_characters
+  template_id?: string // Story template rendered into story_instructions
+  variables?: Record<string, string> // Values for the template's variables
+  fresh?: boolean // Skip cached and in-flight results for the same request
 }
 
 export interface StoryChapter {
@@ -26,12 +31,14 @@ export interface Story {
 
 export interface StoryResponse {
   message: string
-  status: string
+  status: string // "quarantined" when the story is held for review by content moderation
   story?: Story
   story_text?: string // Fallback when JSON parsing fails
   attempts: number
   parse_note?: string // Additional info about parsing
   data?: any // Raw response data for debugging
+  cached?: boolean // Served from the result cache
+  shared?: boolean // Shared with an identical request in flight
 }
 
 /**
@@ -154,6 +154,15 @@ export default function StoryGenerator() {
                   />
                 </div>
 
+                <label className="flex items-center gap-2 text-sm text-gray-700">
+                  <input
+                    type="checkbox"
+                    checked={formData.fresh ?? false}
+                    onChange={(e) => setFormData((prev) => ({ ...prev, fresh: e.target.checked }))}
+                  />
+                  Always generate a fresh story
+                </label>
+
                 <Button
                   onClick={generateStory}
                   disabled={isLoading || !formData.story_instructions.trim()}
@@ -0,0 +1,129 @@
+// Command image-stub is a stand-in image backend for development and tests.
+// It answers POST /generate {"prompt": "..."} with a placeholder PNG whose
+// colours are derived from the prompt, so the same prompt always yields the
+// same image.
+//
+//	go run ./cmd/image-stub -addr 127.0.0.1:3100
+//
+// With IMAGE_API_URL=http://127.0.0.1:3100/generate the server illustrates
+// chapters without a real model.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:3100", "address to listen on")
+	size := flag.Int("size", 512, "width and height of the generated images")
+	delay := flag.Duration("delay", 0, "time to wait before answering each request")
+	failEvery := flag.Int("fail-every", 0, "answer every n-th request with 503 (0 never fails)")
+	asJSON := flag.Bool("json", false, "answer with JSON holding a base64 image instead of the image itself")
+	flag.Parse()
+
+	var requests atomic.Int64
+
+	http.HandleFunc("/generate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body struct {
+			Prompt string `json:"prompt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Prompt == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "a prompt is required"})
+			return
+		}
+
+		n := requests.Add(1)
+		log.Printf("request %d: %q", n, body.Prompt)
+
+		if *delay > 0 {
+			select {
+			case <-time.After(*delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if *failEvery > 0 && n%int64(*failEvery) == 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "stub failure"})
+			return
+		}
+
+		data, err := placeholder(body.Prompt, *size)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if *asJSON {
+			writeJSON(w, http.StatusOK, map[string]string{
+				"image":        base64.StdEncoding.EncodeToString(data),
+				"content_type": "image/png",
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	})
+
+	log.Printf("image stub listening on http://%s/generate", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// placeholder draws a diagonal gradient between two colours picked from the
+// prompt's hash
+func placeholder(prompt string, size int) ([]byte, error) {
+	if size < 1 {
+		size = 512
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(prompt))
+	sum := h.Sum64()
+
+	from := color.RGBA{uint8(sum), uint8(sum >> 8), uint8(sum >> 16), 255}
+	to := color.RGBA{uint8(sum >> 24), uint8(sum >> 32), uint8(sum >> 40), 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			t := float64(x+y) / float64(2*size)
+			img.Set(x, y, color.RGBA{
+				R: blend(from.R, to.R, t),
+				G: blend(from.G, to.G, t),
+				B: blend(from.B, to.B, t),
+				A: 255,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func blend(a, b uint8, t float64) uint8 {
+	return uint8(float64(a) + (float64(b)-float64(a))*t)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -13,7 +13,9 @@ import (
 	"pocket-app/internal/config"
 	"pocket-app/internal/handlers"
 	"pocket-app/internal/services"
+	_ "pocket-app/migrations"
 	"pocket-app/pkg/logger"
+	"pocket-app/pkg/redact"
 )
 
 func main() {
@@ -24,6 +26,15 @@ func main() {
 	
 	// Initialize logger
 	logger.Init(cfg.LogLevel)
+	logger.SetRedactor(redact.New(redact.Rules{
+		Headers: cfg.Logging.RedactHeaders,
+		Fields:  cfg.Logging.RedactFields,
+		MaxBody: cfg.Logging.MaxBody,
+		Full:    cfg.FullLogBodies(),
+	}))
+	if cfg.FullLogBodies() {
+		logger.Warn("LOG_DEBUG_BODIES is on: request and response bodies are logged unmasked")
+	}
 	logger.Info("🚀 Starting PocketBase Application")
 
 	// Plugin flags
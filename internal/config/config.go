@@ -3,18 +3,43 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Environment string
-	LogLevel    string
-	AppName     string
-	AppVersion  string
-	APIPrefix   string
-	Database    DatabaseConfig
-	Auth        AuthConfig
-	Features    Features
+	Environment   string
+	LogLevel      string
+	Logging       LoggingConfig
+	AppName       string
+	AppVersion    string
+	APIPrefix     string
+	Database      DatabaseConfig
+	Auth          AuthConfig
+	Features      Features
+	Story         StoryConfig
+	StoryLimits   StoryLimitsConfig
+	RateLimit     RateLimitConfig
+	Quota         QuotaConfig
+	Retry         RetryConfig
+	Breaker       BreakerConfig
+	Cache         CacheConfig
+	Image         ImageConfig
+	Moderation    ModerationConfig
+	Workflows     WorkflowsConfig
+	GenerationLog GenerationLogConfig
+	Shares        SharesConfig
+	Rivet         RivetConfig
+	OpenAI        OpenAIConfig
+}
+
+// LoggingConfig holds the redaction rules for logged requests, responses and messages
+type LoggingConfig struct {
+	RedactHeaders []string
+	RedactFields  []string
+	MaxBody       int
+	DebugBodies   bool // log whole, unmasked bodies; only honored in development
 }
 
 // DatabaseConfig holds database-related configuration
@@ -42,11 +67,145 @@ type Features struct {
 	EnableAnalytics    bool
 }
 
+// StoryConfig holds story generation configuration
+type StoryConfig struct {
+	Generator         string
+	APIURL            string
+	JobWorkers        int
+	JobQueueSize      int
+	ValidationRetries int
+	IdempotencyWindow time.Duration
+}
+
+// StoryLimitsConfig holds the accepted ranges of story generation requests
+type StoryLimitsConfig struct {
+	MinChapters           int
+	MaxChapters           int
+	MinChapterLength      int
+	MaxChapterLength      int
+	MaxInstructionsLength int
+	MaxCharactersLength   int
+}
+
+// RateLimitConfig holds the story generation request rate limits; zero disables a limit
+type RateLimitConfig struct {
+	UserPerMinute int
+	IPPerMinute   int
+}
+
+// QuotaConfig holds the story generation quota of each user
+type QuotaConfig struct {
+	Period string // daily or monthly
+	Unit   string // stories or chapters
+	Limit  int    // zero disables the quota
+}
+
+// RetryConfig holds the retry policy for calls to the story upstream
+type RetryConfig struct {
+	MaxAttempts              int
+	InitialDelay             time.Duration
+	MaxDelay                 time.Duration
+	Multiplier               float64
+	Jitter                   float64
+	AttemptTimeout           time.Duration
+	OverallTimeout           time.Duration
+	RetryableStatuses        []int
+	RetryControlFlowExcluded bool
+}
+
+// BreakerConfig holds the circuit breaker settings for the story upstream
+type BreakerConfig struct {
+	Enabled          bool
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenProbes   int
+}
+
+// CacheConfig holds the deduplication and result cache settings for story generation
+type CacheConfig struct {
+	Dedupe     bool
+	Enabled    bool
+	TTL        time.Duration
+	MaxEntries int
+}
+
+// ImageConfig holds the chapter illustration pipeline settings
+type ImageConfig struct {
+	Enabled        bool
+	Backend        string
+	APIURL         string
+	Timeout        time.Duration
+	MaxAttempts    int
+	Workers        int
+	QueueSize      int
+	ThumbnailSize  int
+	RetriesPerHour int // image retries allowed per user every hour; zero disables the limit
+}
+
+// ModerationConfig holds the content moderation settings for story requests
+// and generated stories
+type ModerationConfig struct {
+	Enabled       bool
+	Backend       string // rules or workflow
+	Threshold     float64
+	Blocklist     []string
+	BlocklistFile string
+	Workflow      string
+	WorkflowURL   string
+	Timeout       time.Duration
+}
+
+// WorkflowsConfig holds the registry of Rivet workflows that can be run
+// through the API
+type WorkflowsConfig struct {
+	File     string   // JSON registry file; without one the Defaults are registered
+	Defaults []string // workflow (graph) names registered when there is no registry file
+	Timeout  time.Duration
+}
+
+// GenerationLogConfig holds the audit log settings for upstream calls
+type GenerationLogConfig struct {
+	Enabled     bool
+	MaxBodySize int // characters kept of each request and response body
+	Retention   time.Duration
+}
+
+// SharesConfig holds the settings for public story share links
+type SharesConfig struct {
+	MaxExpiry            time.Duration // longest expiry a link may have; zero allows links that never expire
+	PasswordAttempts     int           // wrong passwords allowed per link and client IP every 15 minutes
+	LinkPasswordAttempts int           // wrong passwords allowed per link from all clients every 15 minutes
+}
+
+// RivetConfig holds configuration for running Rivet graphs with the CLI
+type RivetConfig struct {
+	Command     string
+	ProjectPath string
+	Graph       string
+	Timeout     time.Duration
+}
+
+// OpenAIConfig holds configuration for OpenAI-compatible APIs
+type OpenAIConfig struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+}
+
 // New creates a new configuration instance with defaults
 func New() *Config {
 	return &Config{
 		Environment: getEnv("APP_ENV", "development"),
 		LogLevel:    getEnv("LOG_LEVEL", "info"),
+		Logging: LoggingConfig{
+			RedactHeaders: getEnvList("LOG_REDACT_HEADERS", []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token", "X-Share-Password"}),
+			RedactFields: getEnvList("LOG_REDACT_FIELDS", []string{
+				"password", "passwordConfirm", "oldPassword", "token", "secret", "api_key", "email",
+				"story_instructions", "primary_characters", "secondary_characters", "instructions", "content", "text", "messages",
+			}),
+			MaxBody:     getEnvInt("LOG_MAX_BODY", 1000),
+			DebugBodies: getEnvBool("LOG_DEBUG_BODIES", false),
+		},
 		AppName:     getEnv("APP_NAME", "PocketBase App"),
 		AppVersion:  getEnv("APP_VERSION", "1.0.0"),
 		APIPrefix:   getEnv("API_PREFIX", "/api/v1"),
@@ -69,6 +228,105 @@ func New() *Config {
 			EnableRealtime:      getEnvBool("FEATURE_REALTIME", true),
 			EnableAnalytics:     getEnvBool("FEATURE_ANALYTICS", false),
 		},
+		Story: StoryConfig{
+			Generator:         getEnv("STORY_GENERATOR", "rivet-http"),
+			APIURL:            getEnv("STORY_API_URL", "http://localhost:3000"),
+			JobWorkers:        getEnvInt("STORY_JOB_WORKERS", 2),
+			JobQueueSize:      getEnvInt("STORY_JOB_QUEUE_SIZE", 100),
+			ValidationRetries: getEnvInt("STORY_VALIDATION_RETRIES", 1),
+			IdempotencyWindow: getEnvDuration("STORY_IDEMPOTENCY_WINDOW", 24*time.Hour),
+		},
+		StoryLimits: StoryLimitsConfig{
+			MinChapters:           getEnvInt("STORY_MIN_CHAPTERS", 1),
+			MaxChapters:           getEnvInt("STORY_MAX_CHAPTERS", 10),
+			MinChapterLength:      getEnvInt("STORY_MIN_CHAPTER_LENGTH", 50),
+			MaxChapterLength:      getEnvInt("STORY_MAX_CHAPTER_LENGTH", 500),
+			MaxInstructionsLength: getEnvInt("STORY_MAX_INSTRUCTIONS_LENGTH", 2000),
+			MaxCharactersLength:   getEnvInt("STORY_MAX_CHARACTERS_LENGTH", 500),
+		},
+		RateLimit: RateLimitConfig{
+			UserPerMinute: getEnvInt("STORY_RATE_LIMIT_USER", 5),
+			IPPerMinute:   getEnvInt("STORY_RATE_LIMIT_IP", 20),
+		},
+		Quota: QuotaConfig{
+			Period: getEnv("STORY_QUOTA_PERIOD", "daily"),
+			Unit:   getEnv("STORY_QUOTA_UNIT", "stories"),
+			Limit:  getEnvInt("STORY_QUOTA_LIMIT", 20),
+		},
+		Retry: RetryConfig{
+			MaxAttempts:              getEnvInt("RIVET_RETRY_ATTEMPTS", 3),
+			InitialDelay:             getEnvDuration("STORY_RETRY_DELAY", 2*time.Second),
+			MaxDelay:                 getEnvDuration("STORY_RETRY_MAX_DELAY", 30*time.Second),
+			Multiplier:               getEnvFloat("STORY_RETRY_MULTIPLIER", 2),
+			Jitter:                   getEnvFloat("STORY_RETRY_JITTER", 0.2),
+			AttemptTimeout:           getEnvDuration("STORY_ATTEMPT_TIMEOUT", 2*time.Minute),
+			OverallTimeout:           getEnvDuration("STORY_TIMEOUT", 4*time.Minute),
+			RetryableStatuses:        getEnvIntList("STORY_RETRYABLE_STATUSES", []int{408, 425, 429, 500, 502, 503, 504}),
+			RetryControlFlowExcluded: getEnvBool("STORY_RETRY_CONTROL_FLOW_EXCLUDED", true),
+		},
+		Breaker: BreakerConfig{
+			Enabled:          getEnvBool("STORY_BREAKER_ENABLED", true),
+			FailureThreshold: getEnvInt("STORY_BREAKER_FAILURES", 5),
+			OpenTimeout:      getEnvDuration("STORY_BREAKER_OPEN_TIMEOUT", 30*time.Second),
+			HalfOpenProbes:   getEnvInt("STORY_BREAKER_HALF_OPEN_PROBES", 1),
+		},
+		Cache: CacheConfig{
+			Dedupe:     getEnvBool("STORY_DEDUPE_ENABLED", true),
+			Enabled:    getEnvBool("STORY_CACHE_ENABLED", false),
+			TTL:        getEnvDuration("STORY_CACHE_TTL", time.Hour),
+			MaxEntries: getEnvInt("STORY_CACHE_MAX_ENTRIES", 500),
+		},
+		Image: ImageConfig{
+			Enabled:        getEnvBool("IMAGE_GENERATION_ENABLED", false),
+			Backend:        getEnv("IMAGE_BACKEND", "http"),
+			APIURL:         getEnv("IMAGE_API_URL", "http://localhost:3100/generate"),
+			Timeout:        getEnvDuration("IMAGE_TIMEOUT", 2*time.Minute),
+			MaxAttempts:    getEnvInt("IMAGE_RETRY_ATTEMPTS", 3),
+			Workers:        getEnvInt("IMAGE_WORKERS", 1),
+			QueueSize:      getEnvInt("IMAGE_QUEUE_SIZE", 200),
+			ThumbnailSize:  getEnvInt("IMAGE_THUMBNAIL_SIZE", 320),
+			RetriesPerHour: getEnvInt("IMAGE_RETRY_LIMIT_USER", 20),
+		},
+		Moderation: ModerationConfig{
+			Enabled:       getEnvBool("MODERATION_ENABLED", true),
+			Backend:       getEnv("MODERATION_BACKEND", "rules"),
+			Threshold:     getEnvFloat("MODERATION_THRESHOLD", 0.5),
+			Blocklist:     getEnvList("MODERATION_BLOCKLIST", nil),
+			BlocklistFile: getEnv("MODERATION_BLOCKLIST_FILE", ""),
+			Workflow:      getEnv("RIVET_WORKFLOW_CONTENT_MODERATION", "content-moderation"),
+			WorkflowURL:   getEnv("MODERATION_WORKFLOW_URL", ""),
+			Timeout:       getEnvDuration("MODERATION_TIMEOUT", 30*time.Second),
+		},
+		Workflows: WorkflowsConfig{
+			File: getEnv("WORKFLOWS_FILE", ""),
+			Defaults: []string{
+				getEnv("RIVET_WORKFLOW_CONTENT_PROCESSOR", "content-processor"),
+				getEnv("RIVET_WORKFLOW_USER_ANALYTICS", "user-analytics"),
+				getEnv("RIVET_WORKFLOW_CONTENT_MODERATION", "content-moderation"),
+			},
+			Timeout: getEnvDuration("WORKFLOW_TIMEOUT", time.Minute),
+		},
+		GenerationLog: GenerationLogConfig{
+			Enabled:     getEnvBool("GENERATION_LOG_ENABLED", true),
+			MaxBodySize: getEnvInt("GENERATION_LOG_MAX_BODY", 20000),
+			Retention:   getEnvDuration("GENERATION_LOG_RETENTION", 30*24*time.Hour),
+		},
+		Shares: SharesConfig{
+			MaxExpiry:            getEnvDuration("SHARE_MAX_EXPIRY", 0),
+			PasswordAttempts:     getEnvInt("SHARE_PASSWORD_ATTEMPTS", 5),
+			LinkPasswordAttempts: getEnvInt("SHARE_LINK_PASSWORD_ATTEMPTS", 20),
+		},
+		Rivet: RivetConfig{
+			Command:     getEnv("RIVET_CLI_COMMAND", "npx @ironclad/rivet-cli"),
+			ProjectPath: getEnv("RIVET_PROJECT_PATH", "./rivet/ai.rivet-project"),
+			Graph:       getEnv("RIVET_STORY_GRAPH", ""),
+			Timeout:     time.Duration(getEnvInt("RIVET_TIMEOUT", 30000)) * time.Millisecond,
+		},
+		OpenAI: OpenAIConfig{
+			APIKey:  getEnv("OPENAI_API_KEY", ""),
+			BaseURL: getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+			Model:   getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+		},
 	}
 }
 
@@ -77,6 +335,12 @@ func (c *Config) IsDevelopment() bool {
 	return c.Environment == "development"
 }
 
+// FullLogBodies reports whether bodies are logged whole and unmasked:
+// LOG_DEBUG_BODIES is set and the environment is development
+func (c *Config) FullLogBodies() bool {
+	return c.Logging.DebugBodies && c.IsDevelopment()
+}
+
 // IsProduction returns true if the environment is production
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
@@ -107,3 +371,53 @@ func getEnvBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvIntList(key string, defaultValue []int) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		intValue, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return defaultValue
+		}
+		list = append(list, intValue)
+	}
+	return list
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
\ No newline at end of file
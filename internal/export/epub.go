@@ -0,0 +1,316 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"pocket-app/internal/services"
+)
+
+// EPUBContentType is the media type of an EPUB file
+const EPUBContentType = "application/epub+zip"
+
+// epubLanguage is the language declared for exported books
+const epubLanguage = "en"
+
+// epubChapter is a chapter document in the book
+type epubChapter struct {
+	ID         string
+	File       string
+	Title      string
+	Number     int
+	Paragraphs []string
+}
+
+// epubChapterPage is the data of a chapter document
+type epubChapterPage struct {
+	Language string
+	Chapter  epubChapter
+}
+
+// epubFile is a rendered entry of the book archive
+type epubFile struct {
+	name     string
+	template string
+	data     interface{}
+}
+
+// epubBook is the data the EPUB templates render
+type epubBook struct {
+	Identifier string
+	Title      string
+	Summary    string
+	Language   string
+	Date       string
+	Modified   string
+	Themes     []string
+	Chapters   []epubChapter
+}
+
+var epubTemplates = template.Must(template.New("epub").Funcs(template.FuncMap{
+	"xml": xmlEscape,
+	"add": func(a, b int) int { return a + b },
+}).Parse(`
+{{define "container.xml"}}<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+{{end}}
+
+{{define "content.opf"}}<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{.Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{xml .Identifier}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:language>{{.Language}}</dc:language>
+    <dc:date>{{.Date}}</dc:date>
+    {{- if .Summary}}
+    <dc:description>{{xml .Summary}}</dc:description>
+    {{- end}}
+    {{- range .Themes}}
+    <dc:subject>{{xml .}}</dc:subject>
+    {{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+    <item id="title-page" href="title.xhtml" media-type="application/xhtml+xml"/>
+    {{- range .Chapters}}
+    <item id="{{.ID}}" href="{{.File}}" media-type="application/xhtml+xml"/>
+    {{- end}}
+    {{- if .Themes}}
+    <item id="themes" href="themes.xhtml" media-type="application/xhtml+xml"/>
+    {{- end}}
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="title-page"/>
+    <itemref idref="nav"/>
+    {{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+    {{- end}}
+    {{- if .Themes}}
+    <itemref idref="themes"/>
+    {{- end}}
+  </spine>
+</package>
+{{end}}
+
+{{define "nav.xhtml"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <title>Contents</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>Contents</h1>
+    <ol>
+      <li><a href="title.xhtml">{{xml .Title}}</a></li>
+      {{- range .Chapters}}
+      <li><a href="{{.File}}">{{xml .Title}}</a></li>
+      {{- end}}
+      {{- if .Themes}}
+      <li><a href="themes.xhtml">Themes and Lessons</a></li>
+      {{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+{{end}}
+
+{{define "toc.ncx"}}<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="{{xml .Identifier}}"/>
+  </head>
+  <docTitle><text>{{xml .Title}}</text></docTitle>
+  <navMap>
+    <navPoint id="nav-title" playOrder="1">
+      <navLabel><text>{{xml .Title}}</text></navLabel>
+      <content src="title.xhtml"/>
+    </navPoint>
+    {{- range $i, $chapter := .Chapters}}
+    <navPoint id="nav-{{$chapter.ID}}" playOrder="{{add $i 2}}">
+      <navLabel><text>{{xml $chapter.Title}}</text></navLabel>
+      <content src="{{$chapter.File}}"/>
+    </navPoint>
+    {{- end}}
+    {{- if .Themes}}
+    <navPoint id="nav-themes" playOrder="{{add (len .Chapters) 2}}">
+      <navLabel><text>Themes and Lessons</text></navLabel>
+      <content src="themes.xhtml"/>
+    </navPoint>
+    {{- end}}
+  </navMap>
+</ncx>
+{{end}}
+
+{{define "title.xhtml"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <section epub:type="titlepage" class="title-page">
+    <h1>{{xml .Title}}</h1>
+    {{- if .Summary}}
+    <p class="summary">{{xml .Summary}}</p>
+    {{- end}}
+  </section>
+</body>
+</html>
+{{end}}
+
+{{define "chapter.xhtml"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <title>{{xml .Chapter.Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <section epub:type="chapter">
+    <h2>{{xml .Chapter.Title}}</h2>
+    {{- range .Chapter.Paragraphs}}
+    <p>{{xml .}}</p>
+    {{- end}}
+  </section>
+</body>
+</html>
+{{end}}
+
+{{define "themes.xhtml"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <title>Themes and Lessons</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <section epub:type="appendix">
+    <h2>Themes and Lessons</h2>
+    <ul>
+      {{- range .Themes}}
+      <li>{{xml .}}</li>
+      {{- end}}
+    </ul>
+  </section>
+</body>
+</html>
+{{end}}
+`))
+
+const epubStyle = `body { font-family: serif; line-height: 1.5; margin: 0 5%; }
+h1, h2 { font-family: sans-serif; text-align: center; }
+.title-page { margin-top: 30%; text-align: center; }
+.summary { font-style: italic; }
+p { text-indent: 1.5em; margin: 0 0 0.5em 0; }
+`
+
+// EPUB writes the story as an EPUB 3 book: a title page with the summary, a
+// table of contents, one XHTML document per chapter and a themes appendix.
+func EPUB(w io.Writer, stored *services.StoredStory) error {
+	book := newEPUBBook(stored)
+	archive := zip.NewWriter(w)
+
+	// the mimetype entry must come first, stored uncompressed and without a
+	// data descriptor, so readers find it at a fixed offset
+	mimetype, err := archive.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(EPUBContentType)),
+		CompressedSize64:   uint64(len(EPUBContentType)),
+		UncompressedSize64: uint64(len(EPUBContentType)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, EPUBContentType); err != nil {
+		return err
+	}
+
+	files := []epubFile{
+		{"META-INF/container.xml", "container.xml", book},
+		{"OEBPS/content.opf", "content.opf", book},
+		{"OEBPS/nav.xhtml", "nav.xhtml", book},
+		{"OEBPS/toc.ncx", "toc.ncx", book},
+		{"OEBPS/title.xhtml", "title.xhtml", book},
+	}
+	for _, chapter := range book.Chapters {
+		page := epubChapterPage{Language: book.Language, Chapter: chapter}
+		files = append(files, epubFile{"OEBPS/" + chapter.File, "chapter.xhtml", page})
+	}
+	if len(book.Themes) > 0 {
+		files = append(files, epubFile{"OEBPS/themes.xhtml", "themes.xhtml", book})
+	}
+
+	for _, file := range files {
+		var buf bytes.Buffer
+		if err := epubTemplates.ExecuteTemplate(&buf, file.template, file.data); err != nil {
+			return fmt.Errorf("render %s: %w", file.name, err)
+		}
+		if err := writeZipFile(archive, file.name, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := writeZipFile(archive, "OEBPS/style.css", []byte(epubStyle)); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// newEPUBBook prepares the template data for a story
+func newEPUBBook(stored *services.StoredStory) epubBook {
+	story := stored.Story
+
+	book := epubBook{
+		Identifier: "urn:pocket-app:story:" + stored.ID,
+		Title:      storyTitle(story),
+		Summary:    story.Summary,
+		Language:   epubLanguage,
+		Date:       stored.Created.UTC().Format("2006-01-02"),
+		Modified:   stored.Updated.UTC().Truncate(time.Second).Format("2006-01-02T15:04:05Z"),
+		Themes:     themes(story),
+	}
+	for i, chapter := range story.Chapters {
+		book.Chapters = append(book.Chapters, epubChapter{
+			ID:         fmt.Sprintf("chapter-%d", i+1),
+			File:       fmt.Sprintf("chapter-%d.xhtml", i+1),
+			Title:      chapterTitle(chapter),
+			Number:     chapter.Number,
+			Paragraphs: paragraphs(chapter.Content),
+		})
+	}
+	return book
+}
+
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// xmlEscape escapes text for XML character data and attribute values
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"pocket-app/internal/services"
+)
+
+// testStory is a story whose text needs escaping in every export format
+func testStory() *services.StoredStory {
+	return &services.StoredStory{
+		ID: "abc123",
+		Story: services.Story{
+			Title:   "Tom & Jerry <Friends>",
+			Summary: "A cat and a mouse.",
+			Chapters: []services.StoryChapter{
+				{Number: 1, Title: "The <b>Chase</b>", Content: "Tom runs & jumps.\n\nJerry hides in a \"hole\"."},
+				{Number: 2, Title: "# Peace", Content: "<script>alert(1)</script>\n\n> They make up."},
+			},
+			ThemesOrLessons: []string{"Friendship", "Patience & kindness"},
+		},
+		Created: time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC),
+		Updated: time.Date(2025, 7, 2, 8, 30, 0, 0, time.UTC),
+	}
+}
+
+// epubPackage is the part of content.opf the test checks
+type epubPackage struct {
+	Version  string `xml:"version,attr"`
+	Title    string `xml:"metadata>title"`
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// epubPage is the part of an XHTML document the test checks
+type epubPage struct {
+	Heading    string   `xml:"body>section>h2"`
+	Paragraphs []string `xml:"body>section>p"`
+}
+
+// TestEPUB opens an exported book the way a reading system does: through
+// the mimetype entry, container.xml and the package document
+func TestEPUB(t *testing.T) {
+	stored := testStory()
+
+	var buf bytes.Buffer
+	if err := EPUB(&buf, stored); err != nil {
+		t.Fatalf("EPUB: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+
+	first := archive.File[0]
+	if first.Name != "mimetype" {
+		t.Fatalf("first entry = %q, want mimetype", first.Name)
+	}
+	if first.Method != zip.Store {
+		t.Errorf("mimetype method = %d, want stored", first.Method)
+	}
+	if first.Flags&0x8 != 0 {
+		t.Error("mimetype has a data descriptor")
+	}
+	if got := readEntry(t, archive, "mimetype"); got != EPUBContentType {
+		t.Errorf("mimetype = %q, want %q", got, EPUBContentType)
+	}
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	parseXML(t, readEntry(t, archive, "META-INF/container.xml"), &container)
+	if len(container.Rootfiles) != 1 || container.Rootfiles[0].MediaType != "application/oebps-package+xml" {
+		t.Fatalf("container rootfiles = %+v", container.Rootfiles)
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	parseXML(t, readEntry(t, archive, opfPath), &pkg)
+	if pkg.Version != "3.0" {
+		t.Errorf("package version = %q, want 3.0", pkg.Version)
+	}
+	if pkg.Title != stored.Story.Title {
+		t.Errorf("title = %q, want %q", pkg.Title, stored.Story.Title)
+	}
+
+	hrefs := make(map[string]string)
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = item.Href
+		if _, err := archive.Open(path.Join(path.Dir(opfPath), item.Href)); err != nil {
+			t.Errorf("manifest item %s: %v", item.ID, err)
+		}
+	}
+
+	var spine []string
+	for _, ref := range pkg.Spine {
+		spine = append(spine, ref.IDRef)
+	}
+	wantSpine := []string{"title-page", "nav", "chapter-1", "chapter-2", "themes"}
+	if !reflect.DeepEqual(spine, wantSpine) {
+		t.Errorf("spine = %v, want %v", spine, wantSpine)
+	}
+
+	for i, chapter := range stored.Story.Chapters {
+		id := fmt.Sprintf("chapter-%d", i+1)
+		href, ok := hrefs[id]
+		if !ok {
+			t.Errorf("manifest has no %s", id)
+			continue
+		}
+
+		var page epubPage
+		parseXML(t, readEntry(t, archive, path.Join(path.Dir(opfPath), href)), &page)
+		if page.Heading != chapter.Title {
+			t.Errorf("%s heading = %q, want %q", id, page.Heading, chapter.Title)
+		}
+		if want := paragraphs(chapter.Content); !reflect.DeepEqual(page.Paragraphs, want) {
+			t.Errorf("%s paragraphs = %q, want %q", id, page.Paragraphs, want)
+		}
+	}
+}
+
+func readEntry(t *testing.T, archive *zip.Reader, name string) string {
+	t.Helper()
+
+	f, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+// parseXML decodes a document strictly, so that unescaped text fails
+func parseXML(t *testing.T, text string, v interface{}) {
+	t.Helper()
+
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = true
+	if err := decoder.Decode(v); err != nil {
+		t.Fatalf("parse XML: %v\n%s", err, text)
+	}
+}
@@ -0,0 +1,76 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"pocket-app/internal/services"
+)
+
+// Filename returns a download file name for a story title with the given extension
+func Filename(title, ext string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	name := b.String()
+	if name == "" {
+		name = "story"
+	}
+	if runes := []rune(name); len(runes) > 80 {
+		name = strings.TrimRight(string(runes[:80]), "-")
+	}
+	return name + "." + ext
+}
+
+// paragraphs splits chapter content into paragraphs on blank lines; single
+// line breaks stay inside a paragraph
+func paragraphs(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	var result []string
+	for _, block := range strings.Split(content, "\n\n") {
+		if block = strings.TrimSpace(block); block != "" {
+			result = append(result, block)
+		}
+	}
+	return result
+}
+
+// storyTitle returns the story title, or a placeholder for untitled stories
+func storyTitle(story services.Story) string {
+	if title := strings.TrimSpace(story.Title); title != "" {
+		return title
+	}
+	return "Untitled Story"
+}
+
+// chapterTitle returns the chapter title, or its number for untitled chapters
+func chapterTitle(chapter services.StoryChapter) string {
+	if title := strings.TrimSpace(chapter.Title); title != "" {
+		return title
+	}
+	return fmt.Sprintf("Chapter %d", chapter.Number)
+}
+
+// themes returns the story's non-empty themes and lessons
+func themes(story services.Story) []string {
+	var result []string
+	for _, theme := range story.ThemesOrLessons {
+		if theme = strings.TrimSpace(theme); theme != "" {
+			result = append(result, theme)
+		}
+	}
+	return result
+}
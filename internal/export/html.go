@@ -0,0 +1,129 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"pocket-app/internal/services"
+)
+
+// HTMLContentType is the media type of an HTML export
+const HTMLContentType = "text/html; charset=utf-8"
+
+// HTMLOptions controls the HTML export
+type HTMLOptions struct {
+	// ImageCaptions adds each chapter's image prompt as a caption
+	ImageCaptions bool
+}
+
+// htmlChapter is a chapter of the HTML export
+type htmlChapter struct {
+	Anchor      string
+	Title       string
+	Paragraphs  []string
+	ImagePrompt string
+}
+
+// htmlDocument is the data the HTML template renders
+type htmlDocument struct {
+	Title    string
+	Summary  string
+	Created  string
+	Themes   []string
+	Chapters []htmlChapter
+}
+
+var htmlTemplate = template.Must(template.New("story").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: Georgia, "Times New Roman", serif; line-height: 1.6; max-width: 42em; margin: 2em auto; padding: 0 1em; color: #222; }
+  h1, h2 { font-family: "Helvetica Neue", Arial, sans-serif; line-height: 1.2; }
+  h1 { text-align: center; margin-bottom: 0.25em; }
+  .summary { font-style: italic; text-align: center; color: #555; }
+  .date { text-align: center; color: #888; font-size: 0.9em; }
+  nav ol { padding-left: 1.5em; }
+  nav a { color: inherit; }
+  .chapter p { text-indent: 1.5em; margin: 0 0 0.75em 0; }
+  .image-prompt { border-left: 3px solid #ccc; padding-left: 0.75em; color: #666; font-size: 0.9em; }
+  @media print {
+    body { max-width: none; margin: 0; font-size: 12pt; }
+    nav { page-break-after: always; }
+    .chapter { page-break-before: always; }
+    a { text-decoration: none; }
+  }
+</style>
+</head>
+<body>
+<header>
+  <h1>{{.Title}}</h1>
+  {{- if .Summary}}
+  <p class="summary">{{.Summary}}</p>
+  {{- end}}
+  <p class="date">{{.Created}}</p>
+</header>
+<nav>
+  <h2>Contents</h2>
+  <ol>
+    {{- range .Chapters}}
+    <li><a href="#{{.Anchor}}">{{.Title}}</a></li>
+    {{- end}}
+    {{- if .Themes}}
+    <li><a href="#themes">Themes and Lessons</a></li>
+    {{- end}}
+  </ol>
+</nav>
+{{- range .Chapters}}
+<section class="chapter" id="{{.Anchor}}">
+  <h2>{{.Title}}</h2>
+  {{- if .ImagePrompt}}
+  <p class="image-prompt">Illustration: {{.ImagePrompt}}</p>
+  {{- end}}
+  {{- range .Paragraphs}}
+  <p>{{.}}</p>
+  {{- end}}
+</section>
+{{- end}}
+{{- if .Themes}}
+<section id="themes">
+  <h2>Themes and Lessons</h2>
+  <ul>
+    {{- range .Themes}}
+    <li>{{.}}</li>
+    {{- end}}
+  </ul>
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML writes the story as a single self-contained HTML page with embedded
+// styles, a table of contents and an anchor per chapter, suitable for printing.
+func HTML(w io.Writer, stored *services.StoredStory, opts HTMLOptions) error {
+	story := stored.Story
+
+	doc := htmlDocument{
+		Title:   storyTitle(story),
+		Summary: story.Summary,
+		Created: stored.Created.UTC().Format("January 2, 2006"),
+		Themes:  themes(story),
+	}
+	for i, chapter := range story.Chapters {
+		c := htmlChapter{
+			Anchor:     fmt.Sprintf("chapter-%d", i+1),
+			Title:      chapterTitle(chapter),
+			Paragraphs: paragraphs(chapter.Content),
+		}
+		if opts.ImageCaptions {
+			c.ImagePrompt = chapter.ImagePrompt
+		}
+		doc.Chapters = append(doc.Chapters, c)
+	}
+
+	return htmlTemplate.Execute(w, doc)
+}
@@ -0,0 +1,32 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestHTMLEscaping checks that story text is escaped in the HTML export
+func TestHTMLEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	if err := HTML(&buf, testStory(), HTMLOptions{ImageCaptions: true}); err != nil {
+		t.Fatalf("HTML: %v", err)
+	}
+	out := buf.String()
+
+	for _, escaped := range []string{
+		"Tom &amp; Jerry &lt;Friends&gt;",
+		"The &lt;b&gt;Chase&lt;/b&gt;",
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"Patience &amp; kindness",
+	} {
+		if !strings.Contains(out, escaped) {
+			t.Errorf("output does not contain %q", escaped)
+		}
+	}
+	for _, raw := range []string{"<script>", "<b>", "<Friends>"} {
+		if strings.Contains(out, raw) {
+			t.Errorf("output contains unescaped %q", raw)
+		}
+	}
+}
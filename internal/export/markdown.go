@@ -0,0 +1,129 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"pocket-app/internal/services"
+)
+
+// MarkdownContentType is the media type of a Markdown export
+const MarkdownContentType = "text/markdown; charset=utf-8"
+
+// Markdown writes the story as Markdown with YAML front matter holding the
+// title, themes and, when they are known, generation parameters, ready for a
+// static site generator. Story text is escaped, so that markup or HTML in it
+// is shown as written rather than rendered.
+func Markdown(w io.Writer, stored *services.StoredStory) error {
+	story := stored.Story
+	b := bufio.NewWriter(w)
+
+	b.WriteString("---\n")
+	fmt.Fprintf(b, "title: %s\n", yamlString(storyTitle(story)))
+	fmt.Fprintf(b, "id: %s\n", yamlString(stored.ID))
+	fmt.Fprintf(b, "date: %s\n", stored.Created.UTC().Format(time.RFC3339))
+	fmt.Fprintf(b, "updated: %s\n", stored.Updated.UTC().Format(time.RFC3339))
+	if story.Summary != "" {
+		fmt.Fprintf(b, "summary: %s\n", yamlString(story.Summary))
+	}
+	if list := themes(story); len(list) > 0 {
+		b.WriteString("themes:\n")
+		for _, theme := range list {
+			fmt.Fprintf(b, "  - %s\n", yamlString(theme))
+		}
+	}
+	if stored.Request.NChapters > 0 {
+		b.WriteString("parameters:\n")
+		fmt.Fprintf(b, "  n_chapters: %d\n", stored.Request.NChapters)
+		fmt.Fprintf(b, "  l_chapter: %d\n", stored.Request.LChapter)
+		fmt.Fprintf(b, "  story_instructions: %s\n", yamlString(stored.Request.StoryInstructions))
+		fmt.Fprintf(b, "  primary_characters: %s\n", yamlString(stored.Request.PrimaryCharacters))
+		fmt.Fprintf(b, "  secondary_characters: %s\n", yamlString(stored.Request.SecondaryCharacters))
+	}
+	b.WriteString("---\n\n")
+
+	fmt.Fprintf(b, "# %s\n\n", markdownLine(storyTitle(story)))
+	if story.Summary != "" {
+		fmt.Fprintf(b, "> %s\n\n", strings.ReplaceAll(markdownText(story.Summary), "\n", "\n> "))
+	}
+
+	for _, chapter := range story.Chapters {
+		fmt.Fprintf(b, "## %s\n\n", markdownLine(chapterTitle(chapter)))
+		for _, paragraph := range paragraphs(chapter.Content) {
+			fmt.Fprintf(b, "%s\n\n", markdownText(paragraph))
+		}
+	}
+
+	if list := themes(story); len(list) > 0 {
+		b.WriteString("## Themes and Lessons\n\n")
+		for _, theme := range list {
+			fmt.Fprintf(b, "- %s\n", markdownLine(theme))
+		}
+	}
+
+	return b.Flush()
+}
+
+// yamlString quotes a string as a YAML double-quoted scalar; JSON string
+// syntax is a subset of it
+func yamlString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return string(bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+// markdownInline escapes the characters that start inline Markdown or HTML
+var markdownInline = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	`*`, `\*`,
+	`_`, `\_`,
+	`[`, `\[`,
+	`]`, `\]`,
+	`|`, `\|`,
+	`~`, `\~`,
+	`&`, `&amp;`,
+	`<`, `&lt;`,
+	`>`, `&gt;`,
+)
+
+// markdownText escapes text so that Markdown renders it as plain text; line
+// breaks are kept
+func markdownText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = markdownLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownLine escapes a single line of text. Besides inline markup, a line
+// that would start a heading, quote, list, rule or code block is escaped at
+// its start.
+func markdownLine(line string) string {
+	line = markdownInline.Replace(strings.TrimSpace(line))
+	if line == "" {
+		return line
+	}
+
+	switch line[0] {
+	case '#', '-', '+', '=':
+		return `\` + line
+	}
+
+	digits := 0
+	for digits < len(line) && line[digits] >= '0' && line[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 && digits < len(line) && (line[digits] == '.' || line[digits] == ')') {
+		return line[:digits] + `\` + line[digits:]
+	}
+	return line
+}
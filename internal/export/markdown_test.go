@@ -0,0 +1,68 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"plain text", "Pip walks home.", "Pip walks home."},
+		{"heading", "# Peace", `\# Peace`},
+		{"rule", "---", `\---`},
+		{"setext underline", "===", `\===`},
+		{"list item", "- one", `\- one`},
+		{"ordered list item", "12. twelve", `12\. twelve`},
+		{"number in text", "12 apples.", "12 apples."},
+		{"quote", "> said", "&gt; said"},
+		{"html", `<script>alert(1)</script>`, "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"entity", "&amp; more", "&amp;amp; more"},
+		{"emphasis and links", "*bold* _it_ [x](y) `code`", "\\*bold\\* \\_it\\_ \\[x\\](y) \\`code\\`"},
+		{"indented code", "    code", "code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownLine(tt.line); got != tt.want {
+				t.Errorf("markdownLine(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMarkdown checks that story text cannot add headings, quotes or HTML
+// to the exported document
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Markdown(&buf, testStory()); err != nil {
+		t.Fatalf("Markdown: %v", err)
+	}
+	out := buf.String()
+
+	var headings []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "#") {
+			headings = append(headings, line)
+		}
+	}
+	want := []string{
+		"# Tom &amp; Jerry &lt;Friends&gt;",
+		"## The &lt;b&gt;Chase&lt;/b&gt;",
+		`## \# Peace`,
+		"## Themes and Lessons",
+	}
+	if strings.Join(headings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("headings = %q, want %q", headings, want)
+	}
+
+	for _, raw := range []string{"<script>", "<b>", "\n> They"} {
+		if strings.Contains(out, raw) {
+			t.Errorf("output contains unescaped %q:\n%s", raw, out)
+		}
+	}
+}
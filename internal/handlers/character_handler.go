@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"pocket-app/pkg/response"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// registerCharacterHooks validates characters saved through the records API
+func (m *Manager) registerCharacterHooks() {
+	validateCharacter := func(e *core.RecordRequestEvent) error {
+		if errs := m.services.Character.Validate(e.Record); errs.HasErrors() {
+			return response.ValidationError(e.Response, errs)
+		}
+		return e.Next()
+	}
+	m.app.OnRecordCreateRequest("characters").BindFunc(validateCharacter)
+	m.app.OnRecordUpdateRequest("characters").BindFunc(validateCharacter)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pocket-app/internal/services"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/response"
+	"pocket-app/pkg/validator"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// registerGenerationLogRoutes registers the admin routes over the audit log
+// of upstream generation calls
+func (m *Manager) registerGenerationLogRoutes(se *core.ServeEvent) {
+	logs := se.Router.Group("/api/admin/generation-logs")
+	logs.Bind(apis.RequireSuperuserAuth())
+	logs.GET("", m.listGenerationLogs)
+	logs.GET("/{id}", m.getGenerationLog)
+
+	logger.Info("Generation log routes registered")
+}
+
+// listGenerationLogs lists generation log entries, newest first. They can be
+// filtered by user, operation, outcome, generator, status, min_latency_ms
+// and a from/to range of RFC 3339 times or dates.
+func (m *Manager) listGenerationLogs(e *core.RequestEvent) error {
+	filter, errs := generationLogFilter(e)
+	if errs.HasErrors() {
+		return response.ValidationError(e.Response, errs)
+	}
+
+	page, perPage := paginationParams(e)
+	entries, total, err := m.services.GenerationLog.List(filter, page, perPage)
+	if err != nil {
+		return response.InternalError(e.Response, "Failed to list generation logs", err)
+	}
+
+	return response.Paginated(e.Response, entries, page, perPage, total, "Generation logs retrieved successfully")
+}
+
+// getGenerationLog returns a generation log entry with its request and response
+func (m *Manager) getGenerationLog(e *core.RequestEvent) error {
+	entry, err := m.services.GenerationLog.Get(e.Request.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrGenerationLogNotFound) {
+			return response.NotFound(e.Response, "Generation log entry not found")
+		}
+		return response.InternalError(e.Response, "Failed to get generation log entry", err)
+	}
+
+	return response.Success(e.Response, entry, "Generation log entry retrieved successfully")
+}
+
+// generationLogFilter reads the generation log filters from the query
+func generationLogFilter(e *core.RequestEvent) (services.GenerationLogFilter, validator.ValidationErrors) {
+	query := e.Request.URL.Query()
+	v := validator.New()
+
+	filter := services.GenerationLogFilter{
+		User:      strings.TrimSpace(query.Get("user")),
+		Operation: strings.TrimSpace(query.Get("operation")),
+		Outcome:   strings.TrimSpace(query.Get("outcome")),
+		Generator: strings.TrimSpace(query.Get("generator")),
+	}
+	if filter.Operation != "" {
+		v.Custom("operation", slices.Contains(services.GenerationOperations, filter.Operation),
+			"Operation must be one of: "+strings.Join(services.GenerationOperations, ", "))
+	}
+	if filter.Outcome != "" {
+		v.Custom("outcome", slices.Contains(services.GenerationOutcomes, filter.Outcome),
+			"Outcome must be one of: "+strings.Join(services.GenerationOutcomes, ", "))
+	}
+
+	if value := query.Get("status"); value != "" {
+		status, err := strconv.Atoi(value)
+		v.Custom("status", err == nil && status > 0, "Status must be a positive number")
+		filter.Status = status
+	}
+	if value := query.Get("min_latency_ms"); value != "" {
+		latency, err := strconv.Atoi(value)
+		v.Custom("min_latency_ms", err == nil && latency >= 0, "Minimum latency must be a number of milliseconds")
+		filter.MinLatencyMS = latency
+	}
+
+	var ok bool
+	if value := query.Get("from"); value != "" {
+		filter.From, ok = parseFilterTime(value)
+		v.Custom("from", ok, "From must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	if value := query.Get("to"); value != "" {
+		filter.To, ok = parseFilterTime(value)
+		v.Custom("to", ok, "To must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+
+	return filter, v.Errors()
+}
+
+// parseFilterTime parses an RFC 3339 time or a date (midnight UTC)
+func parseFilterTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
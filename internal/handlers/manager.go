@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"pocket-app/internal/config"
+	"pocket-app/internal/middleware"
 	"pocket-app/internal/services"
 	"pocket-app/pkg/logger"
 
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 )
 
 // Manager manages all HTTP handlers
@@ -13,14 +15,19 @@ type Manager struct {
 	app      *pocketbase.PocketBase
 	config   *config.Config
 	services *services.Manager
+
+	// rateLimit is shared by every generation route, so that they draw
+	// from one per-user and per-IP budget
+	rateLimit func(e *core.RequestEvent) error
 }
 
 // New creates a new handlers manager
 func New(app *pocketbase.PocketBase, cfg *config.Config, services *services.Manager) *Manager {
 	return &Manager{
-		app:      app,
-		config:   cfg,
-		services: services,
+		app:       app,
+		config:    cfg,
+		services:  services,
+		rateLimit: middleware.GenerationRateLimit(cfg),
 	}
 }
 
@@ -30,6 +37,9 @@ func (m *Manager) Init() error {
 	
 	// Register hooks instead of routes
 	m.registerHooks()
+
+	// Register custom API routes
+	m.registerRoutes()
 	
 	logger.Info("Handlers initialized successfully")
 	return nil
@@ -39,11 +49,24 @@ func (m *Manager) Init() error {
 func (m *Manager) registerHooks() {
 	logger.Info("Setting up application hooks...")
 	
-	// Note: In PocketBase v0.28.4, the hook API is different.
-	// For now, we'll focus on the core Go structure.
-	// Custom hooks can be added later with the correct API.
+	m.registerStoryHooks()
+	m.registerCharacterHooks()
+	m.registerTemplateHooks()
 	
-	logger.Info("Application hooks registered successfully (placeholder)")
+	logger.Info("Application hooks registered successfully")
+}
+
+// registerRoutes registers custom API routes on serve
+func (m *Manager) registerRoutes() {
+	m.app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		m.registerStoryRoutes(se)
+		m.registerShareRoutes(se)
+		m.registerTemplateRoutes(se)
+		m.registerModerationRoutes(se)
+		m.registerWorkflowRoutes(se)
+		m.registerGenerationLogRoutes(se)
+		return se.Next()
+	})
 }
 
 // registerUserHooks registers user-related hooks (placeholder)
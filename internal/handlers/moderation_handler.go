@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+
+	"pocket-app/internal/services"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/response"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// storyReviewBody is the body of a story review
+type storyReviewBody struct {
+	Decision string `json:"decision"` // approve or reject
+	Note     string `json:"note"`
+}
+
+// registerModerationRoutes registers the review routes for stories held by
+// content moderation
+func (m *Manager) registerModerationRoutes(se *core.ServeEvent) {
+	moderation := se.Router.Group("/api/admin/moderation")
+	moderation.Bind(apis.RequireSuperuserAuth())
+	moderation.GET("/quarantine", m.listQuarantinedStories)
+	moderation.GET("/stories/{id}", m.getStoryForReview)
+	moderation.POST("/stories/{id}/review", m.reviewStory)
+
+	logger.Info("Moderation routes registered")
+}
+
+// listQuarantinedStories lists the stories held for review, oldest first
+func (m *Manager) listQuarantinedStories(e *core.RequestEvent) error {
+	page, perPage := paginationParams(e)
+
+	stories, total, err := m.services.Story.ListQuarantinedStories(page, perPage)
+	if err != nil {
+		return response.InternalError(e.Response, "Failed to list quarantined stories", err)
+	}
+
+	return response.Paginated(e.Response, stories, page, perPage, total, "Quarantined stories retrieved successfully")
+}
+
+// getStoryForReview returns a story with its chapters and moderation decisions
+func (m *Manager) getStoryForReview(e *core.RequestEvent) error {
+	story, err := m.services.Story.GetStoryForReview(e.Request.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrStoryNotFound) {
+			return response.NotFound(e.Response, "Story not found")
+		}
+		return response.InternalError(e.Response, "Failed to get story", err)
+	}
+
+	return response.Success(e.Response, story, "Story retrieved successfully")
+}
+
+// reviewStory approves a story, showing it to its owner, or rejects it
+func (m *Manager) reviewStory(e *core.RequestEvent) error {
+	var body storyReviewBody
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+	if body.Decision != "approve" && body.Decision != "reject" {
+		return response.BadRequest(e.Response, `Decision must be "approve" or "reject"`)
+	}
+
+	story, err := m.services.Story.ReviewStory(e.Request.PathValue("id"), e.Auth.Id, body.Decision == "approve", body.Note)
+	if err != nil {
+		if errors.Is(err, services.ErrStoryNotFound) {
+			return response.NotFound(e.Response, "Story not found")
+		}
+		return response.InternalError(e.Response, "Failed to review story", err)
+	}
+
+	return response.Success(e.Response, story, "Story reviewed successfully")
+}
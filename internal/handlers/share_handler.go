@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pocket-app/internal/export"
+	"pocket-app/internal/services"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/response"
+	"pocket-app/pkg/validator"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// sharePasswordHeader carries the password of a protected share link
+const sharePasswordHeader = "X-Share-Password"
+
+// shareCreateBody is the body of a share link creation request
+type shareCreateBody struct {
+	Permission string `json:"permission"`
+	ExpiresAt  string `json:"expires_at"`
+	Password   string `json:"password"`
+}
+
+// registerShareRoutes registers the owner routes that create, list and
+// revoke share links, and the public read-only routes that open them
+func (m *Manager) registerShareRoutes(se *core.ServeEvent) {
+	shares := se.Router.Group("/api/stories/{id}/shares")
+	shares.Bind(apis.RequireAuth())
+	shares.POST("", m.createShare)
+	shares.GET("", m.listShares)
+	shares.DELETE("/{share}", m.revokeShare)
+
+	shared := se.Router.Group("/api/shared/{token}")
+	shared.GET("", m.viewSharedStory)
+	shared.GET("/export.epub", m.exportSharedEPUB)
+	shared.GET("/export.md", m.exportSharedMarkdown)
+	shared.GET("/export.html", m.exportSharedHTML)
+
+	logger.Info("Share routes registered")
+}
+
+// createShare creates a share link to one of the caller's stories. The
+// permission defaults to view; expires_at is an RFC 3339 time or a date.
+func (m *Manager) createShare(e *core.RequestEvent) error {
+	var body shareCreateBody
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+
+	opts := services.ShareOptions{
+		Permission: strings.TrimSpace(body.Permission),
+		Password:   body.Password,
+	}
+	if opts.Permission == "" {
+		opts.Permission = services.SharePermissionView
+	}
+	if value := strings.TrimSpace(body.ExpiresAt); value != "" {
+		expiresAt, ok := parseFilterTime(value)
+		if !ok {
+			var errs validator.ValidationErrors
+			errs.Add("expires_at", "Expiry must be an RFC 3339 time or a YYYY-MM-DD date")
+			return response.ValidationError(e.Response, errs)
+		}
+		opts.ExpiresAt = expiresAt
+	}
+	if errs := m.services.Share.ValidateOptions(opts); errs.HasErrors() {
+		return response.ValidationError(e.Response, errs)
+	}
+
+	share, err := m.services.Share.Create(e.Auth.Id, e.Request.PathValue("id"), opts)
+	if err != nil {
+		if errors.Is(err, services.ErrStoryNotFound) {
+			return response.NotFound(e.Response, "Story not found")
+		}
+		return response.InternalError(e.Response, "Failed to create share link", err)
+	}
+
+	return response.Created(e.Response, share, "Share link created successfully")
+}
+
+// listShares lists the caller's share links to a story with their view and
+// download counts
+func (m *Manager) listShares(e *core.RequestEvent) error {
+	shares, err := m.services.Share.List(e.Auth.Id, e.Request.PathValue("id"))
+	if err != nil {
+		return response.InternalError(e.Response, "Failed to list share links", err)
+	}
+
+	return response.Success(e.Response, shares, "Share links retrieved successfully")
+}
+
+// revokeShare revokes one of the caller's share links
+func (m *Manager) revokeShare(e *core.RequestEvent) error {
+	share, err := m.services.Share.Revoke(e.Auth.Id, e.Request.PathValue("id"), e.Request.PathValue("share"))
+	if err != nil {
+		if errors.Is(err, services.ErrShareNotFound) {
+			return response.NotFound(e.Response, "Share link not found")
+		}
+		return response.InternalError(e.Response, "Failed to revoke share link", err)
+	}
+
+	return response.Success(e.Response, share, "Share link revoked successfully")
+}
+
+// viewSharedStory returns the story of a share link, read-only. Protected
+// links take their password in the X-Share-Password header.
+func (m *Manager) viewSharedStory(e *core.RequestEvent) error {
+	story, err := m.services.Share.View(e.Request.PathValue("token"), e.Request.Header.Get(sharePasswordHeader), e.RealIP())
+	if err != nil {
+		return shareErrorResponse(e, err)
+	}
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return response.Success(e.Response, story, "Shared story retrieved successfully")
+}
+
+// exportSharedEPUB downloads the story of a share link as an EPUB 3 book
+func (m *Manager) exportSharedEPUB(e *core.RequestEvent) error {
+	return m.exportSharedStory(e, "EPUB", export.EPUBContentType, "epub", export.EPUB)
+}
+
+// exportSharedMarkdown downloads the story of a share link as Markdown
+func (m *Manager) exportSharedMarkdown(e *core.RequestEvent) error {
+	return m.exportSharedStory(e, "Markdown", export.MarkdownContentType, "md", export.Markdown)
+}
+
+// exportSharedHTML downloads the story of a share link as a single printable
+// HTML page; ?captions=true adds each chapter's image prompt as a caption
+func (m *Manager) exportSharedHTML(e *core.RequestEvent) error {
+	captions, _ := strconv.ParseBool(e.Request.URL.Query().Get("captions"))
+	opts := export.HTMLOptions{ImageCaptions: captions}
+
+	return m.exportSharedStory(e, "HTML", export.HTMLContentType, "html", func(w io.Writer, stored *services.StoredStory) error {
+		return export.HTML(w, stored, opts)
+	})
+}
+
+// exportSharedStory opens a share link that allows downloads, renders its
+// story and sends it as a file download
+func (m *Manager) exportSharedStory(e *core.RequestEvent, format, contentType, ext string, render func(io.Writer, *services.StoredStory) error) error {
+	stored, err := m.services.Share.Download(e.Request.PathValue("token"), e.Request.Header.Get(sharePasswordHeader), e.RealIP())
+	if err != nil {
+		return shareErrorResponse(e, err)
+	}
+
+	var buf bytes.Buffer
+	if err := render(&buf, stored); err != nil {
+		logger.Error("Failed to export shared story as "+format, err)
+		return response.InternalError(e.Response, "Failed to export story", err)
+	}
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return sendExport(e, contentType, export.Filename(stored.Story.Title, ext), buf.Bytes())
+}
+
+// shareErrorResponse maps errors opening a share link to responses
+func shareErrorResponse(e *core.RequestEvent, err error) error {
+	switch {
+	case errors.Is(err, services.ErrShareNotFound):
+		return response.NotFound(e.Response, "Shared story not found")
+	case errors.Is(err, services.ErrShareUnavailable):
+		return response.Error(e.Response, http.StatusGone, "This share link has expired or was revoked")
+	case errors.Is(err, services.ErrSharePasswordRequired):
+		return response.Unauthorized(e.Response, "This share link requires a password")
+	case errors.Is(err, services.ErrSharePasswordInvalid):
+		return response.Unauthorized(e.Response, "Wrong share link password")
+	case errors.Is(err, services.ErrSharePasswordAttempts):
+		e.Response.Header().Set("Retry-After", strconv.Itoa(int(services.SharePasswordWindow.Seconds())))
+		return response.TooManyRequests(e.Response, "Too many wrong passwords, please try again later")
+	case errors.Is(err, services.ErrShareDownloadForbidden):
+		return response.Forbidden(e.Response, "This share link does not allow downloads")
+	}
+	return response.InternalError(e.Response, "Failed to open shared story", err)
+}
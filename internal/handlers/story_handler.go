@@ -0,0 +1,821 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pocket-app/internal/export"
+	"pocket-app/internal/middleware"
+	"pocket-app/internal/services"
+	"pocket-app/pkg/breaker"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/response"
+	"pocket-app/pkg/validator"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultStoriesPerPage = 20
+	maxStoriesPerPage     = 100
+)
+
+// Idempotency key scopes; a key may only be reused on the endpoint it was first sent to
+const (
+	idempotencyScopeGenerate = "generate-story"
+	idempotencyScopeJobs     = "story-jobs"
+)
+
+// chapterRegenerationBody is the optional body of a chapter regeneration request
+type chapterRegenerationBody struct {
+	Instructions string `json:"instructions"`
+}
+
+// storyContinuationBody is the body of a story continuation request
+type storyContinuationBody struct {
+	NChapters    int    `json:"n_chapters"`
+	Instructions string `json:"instructions"`
+}
+
+// errIdempotencyKeyTooLong is returned for an Idempotency-Key header over the maximum length
+var errIdempotencyKeyTooLong = errors.New("idempotency key is too long")
+
+// registerStoryHooks moderates user edits to stories and chapters made
+// through the records API and records a manual revision for each, and keeps
+// revisions immutable
+func (m *Manager) registerStoryHooks() {
+	recordManualRevision := func(e *core.RecordRequestEvent) error {
+		authorID := ""
+		if e.Auth != nil && e.Auth.Collection().Name == "users" {
+			authorID = e.Auth.Id
+		}
+		if authorID != "" {
+			if err := m.services.Story.ModerateEdit(e.Request.Context(), authorID, e.Record); err != nil {
+				return moderationErrorResponse(e.RequestEvent, err)
+			}
+		}
+
+		changed := services.RevisionChanged(e.Record)
+		if err := e.Next(); err != nil || !changed {
+			return err
+		}
+
+		if err := m.services.Story.RecordRevision(e.Record, authorID, services.RevisionSourceManual); err != nil {
+			logger.Error("Failed to record story revision", err)
+		}
+		return nil
+	}
+	m.app.OnRecordCreateRequest("stories", "story_chapters").BindFunc(recordManualRevision)
+	m.app.OnRecordUpdateRequest("stories", "story_chapters").BindFunc(recordManualRevision)
+
+	m.app.OnRecordUpdate("story_revisions").BindFunc(func(e *core.RecordEvent) error {
+		return errors.New("story revisions cannot be changed")
+	})
+}
+
+// registerStoryRoutes registers story generation and story library routes
+func (m *Manager) registerStoryRoutes(se *core.ServeEvent) {
+	requestLog := middleware.RequestLogging()
+
+	se.Router.POST("/api/generate-story", m.generateStory).Bind(apis.RequireAuth()).BindFunc(requestLog, m.rateLimit)
+	se.Router.POST("/api/generate-story/stream", m.streamStory).Bind(apis.RequireAuth()).BindFunc(requestLog, m.rateLimit)
+	se.Router.GET("/api/quota", m.getQuota).Bind(apis.RequireAuth())
+
+	stories := se.Router.Group("/api/stories")
+	stories.Bind(apis.RequireAuth())
+	stories.GET("", m.listStories)
+	stories.GET("/{id}", m.getStory)
+	stories.DELETE("/{id}", m.deleteStory)
+	stories.GET("/{id}/export.epub", m.exportStoryEPUB)
+	stories.GET("/{id}/export.md", m.exportStoryMarkdown)
+	stories.GET("/{id}/export.html", m.exportStoryHTML)
+	stories.POST("/{id}/chapters/{number}/regenerate", m.regenerateChapter).BindFunc(requestLog, m.rateLimit)
+	stories.POST("/{id}/continue", m.continueStory).BindFunc(requestLog, m.rateLimit)
+	stories.GET("/{id}/chapters/{number}/revisions", m.listChapterRevisions)
+	stories.GET("/{id}/images", m.listStoryImages)
+	stories.POST("/{id}/chapters/{number}/image/retry", m.retryChapterImage)
+	stories.GET("/{id}/revisions", m.listRevisions)
+	stories.GET("/{id}/revisions/diff", m.diffRevisions)
+	stories.POST("/{id}/revisions/{revision}/restore", m.restoreRevision)
+
+	se.Router.POST("/api/story-jobs", m.createStoryJob).Bind(apis.RequireAuth()).BindFunc(requestLog, m.rateLimit)
+	se.Router.GET("/api/story-jobs/{id}", m.getStoryJob).Bind(apis.RequireAuth())
+
+	se.Router.GET("/api/admin/story-upstream", m.storyUpstreamStatus).Bind(apis.RequireSuperuserAuth())
+
+	logger.Info("Story routes registered")
+}
+
+// generateStory generates a story, charges it to the caller's quota and saves it
+func (m *Manager) generateStory(e *core.RequestEvent) error {
+	var req services.StoryRequest
+	if err := e.BindBody(&req); err != nil {
+		logger.Warn("Error parsing story request body: %v", err)
+		return e.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+	bound := req
+
+	if errs, err := m.prepareStoryRequest(e.Auth, &req); err != nil {
+		return response.InternalError(e.Response, "Failed to prepare story request", err)
+	} else if errs.HasErrors() {
+		return response.ValidationError(e.Response, errs)
+	}
+	if err := m.services.Moderation.CheckStoryRequest(e.Request.Context(), e.Auth.Id, req); err != nil {
+		return moderationErrorResponse(e, err)
+	}
+
+	claim, err := m.claimIdempotencyKey(e, idempotencyScopeGenerate, bound)
+	if err != nil {
+		return idempotencyErrorResponse(e, err)
+	}
+	if claim != nil && claim.Replay != nil {
+		e.Response.Header().Set("Idempotent-Replayed", "true")
+		return e.JSON(claim.Replay.StatusCode, claim.Replay.Response)
+	}
+
+	reservation, err := m.services.Quota.Reserve(e.Auth.Id, req)
+	if err != nil {
+		m.services.Idempotency.Abandon(claim)
+		return quotaErrorResponse(e, err)
+	}
+
+	logger.Info("Story generation request: %d chapters, chapter length %d", req.NChapters, req.LChapter)
+
+	ctx := services.WithGenerationCaller(e.Request.Context(), e.Auth.Id, services.GenerationOpGenerate)
+	result, err := m.services.Story.Generate(ctx, req)
+	if err != nil {
+		m.services.Quota.Release(*reservation)
+		m.services.Idempotency.Abandon(claim)
+		return upstreamErrorResponse(e, err)
+	}
+
+	if result.Valid() {
+		record, err := m.services.Story.SaveStory(e.Request.Context(), e.Auth.Id, req, result.Story)
+		if err != nil {
+			logger.Error("Failed to persist generated story", err)
+		} else {
+			result.StoryID = record.Id
+			if record.GetString("moderation_status") == services.ModerationQuarantined {
+				result.Withhold()
+			}
+		}
+	}
+	if result.StoryID == "" {
+		m.services.Quota.Release(*reservation)
+		m.services.Idempotency.Abandon(claim)
+	} else {
+		m.services.Idempotency.Complete(claim, result.StatusCode, result, "")
+	}
+
+	return e.JSON(result.StatusCode, result)
+}
+
+// streamStory generates a story and sends it to the client as Server-Sent Events
+func (m *Manager) streamStory(e *core.RequestEvent) error {
+	var req services.StoryRequest
+	if err := e.BindBody(&req); err != nil {
+		logger.Warn("Error parsing story stream request body: %v", err)
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+
+	if errs, err := m.prepareStoryRequest(e.Auth, &req); err != nil {
+		return response.InternalError(e.Response, "Failed to prepare story request", err)
+	} else if errs.HasErrors() {
+		return response.ValidationError(e.Response, errs)
+	}
+	if err := m.services.Moderation.CheckStoryRequest(e.Request.Context(), e.Auth.Id, req); err != nil {
+		return moderationErrorResponse(e, err)
+	}
+
+	reservation, err := m.services.Quota.Reserve(e.Auth.Id, req)
+	if err != nil {
+		return quotaErrorResponse(e, err)
+	}
+
+	e.Response.Header().Set("Content-Type", "text/event-stream")
+	e.Response.Header().Set("Cache-Control", "no-cache")
+	e.Response.Header().Set("Connection", "keep-alive")
+	e.Response.Header().Set("X-Accel-Buffering", "no")
+	e.Response.WriteHeader(http.StatusOK)
+
+	send := func(event services.StoryEvent) error {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(e.Response, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return err
+		}
+		return e.Flush()
+	}
+
+	ctx := services.WithGenerationCaller(e.Request.Context(), e.Auth.Id, services.GenerationOpStream)
+	// chapters are moderated before they are sent, so flagged content never
+	// reaches the client even though the story is only saved at the end
+	result, err := m.services.Story.GenerateStream(ctx, req, m.services.Moderation.GateStream(e.Request.Context(), e.Auth.Id, send))
+	if err != nil {
+		m.services.Quota.Release(*reservation)
+		if e.Request.Context().Err() != nil {
+			logger.Info("Story stream cancelled by client")
+			return nil
+		}
+		logger.Warn("Story stream failed: %v", err)
+		payload := map[string]interface{}{
+			"error": err.Error(),
+		}
+		var upstreamErr *services.UpstreamError
+		var openErr *breaker.OpenError
+		if errors.As(err, &upstreamErr) {
+			payload["error"] = upstreamErr.Message
+			payload["attempts"] = upstreamErr.Attempts
+		} else if errors.As(err, &openErr) {
+			payload["error"] = "Story service is temporarily unavailable, please try again later"
+			payload["retry_after"] = retryAfterSeconds(openErr)
+		}
+		return send(services.StoryEvent{Type: services.StoryEventError, Data: payload})
+	}
+
+	done := map[string]interface{}{
+		"status":   result.Status,
+		"message":  result.Message,
+		"attempts": result.Attempts,
+	}
+	if result.Valid() {
+		record, err := m.services.Story.SaveStory(e.Request.Context(), e.Auth.Id, req, result.Story)
+		if err != nil {
+			logger.Error("Failed to persist streamed story", err)
+		} else {
+			done["story_id"] = record.Id
+			if record.GetString("moderation_status") == services.ModerationQuarantined {
+				result.Withhold()
+				done["status"] = result.Status
+				done["message"] = result.Message
+				return send(services.StoryEvent{Type: services.StoryEventDone, Data: done})
+			}
+		}
+	}
+	if done["story_id"] == nil {
+		m.services.Quota.Release(*reservation)
+	}
+	if result.Story == nil {
+		done["story_text"] = result.StoryText
+		done["parse_note"] = result.ParseNote
+	}
+	if result.ParseStrategy != "" {
+		done["parse_strategy"] = result.ParseStrategy
+	}
+	if result.ValidationProblems.HasErrors() {
+		done["validation_problems"] = result.ValidationProblems
+	}
+	if len(result.Repairs) > 0 {
+		done["repairs"] = result.Repairs
+	}
+
+	return send(services.StoryEvent{Type: services.StoryEventDone, Data: done})
+}
+
+// createStoryJob queues a story generation job and returns its id immediately
+func (m *Manager) createStoryJob(e *core.RequestEvent) error {
+	var req services.StoryRequest
+	if err := e.BindBody(&req); err != nil {
+		logger.Warn("Error parsing story job request body: %v", err)
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+	bound := req
+
+	if errs, err := m.prepareStoryRequest(e.Auth, &req); err != nil {
+		return response.InternalError(e.Response, "Failed to prepare story request", err)
+	} else if errs.HasErrors() {
+		return response.ValidationError(e.Response, errs)
+	}
+	if err := m.services.Moderation.CheckStoryRequest(e.Request.Context(), e.Auth.Id, req); err != nil {
+		return moderationErrorResponse(e, err)
+	}
+
+	claim, err := m.claimIdempotencyKey(e, idempotencyScopeJobs, bound)
+	if err != nil {
+		return idempotencyErrorResponse(e, err)
+	}
+	if claim != nil && claim.Replay != nil {
+		job, err := m.services.StoryJob.GetJob(e.Auth.Id, claim.Replay.JobID)
+		if err != nil {
+			return response.InternalError(e.Response, "Failed to load story job", err)
+		}
+		e.Response.Header().Set("Idempotent-Replayed", "true")
+		return response.Accepted(e.Response, map[string]interface{}{
+			"id":     job["id"],
+			"status": job["status"],
+		}, "Story job already created")
+	}
+
+	job, err := m.services.StoryJob.Enqueue(e.Auth.Id, req)
+	if err != nil {
+		m.services.Idempotency.Abandon(claim)
+		if errors.Is(err, services.ErrJobQueueFull) {
+			return response.Error(e.Response, http.StatusServiceUnavailable, "Story job queue is full, please try again later")
+		}
+		var quotaErr *services.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return quotaErrorResponse(e, err)
+		}
+		return response.InternalError(e.Response, "Failed to queue story job", err)
+	}
+
+	m.services.Idempotency.Complete(claim, http.StatusAccepted, nil, job.Id)
+
+	return response.Accepted(e.Response, map[string]interface{}{
+		"id":     job.Id,
+		"status": job.GetString("status"),
+	}, "Story job queued")
+}
+
+// getStoryJob reports the status, attempt count and result of a job
+func (m *Manager) getStoryJob(e *core.RequestEvent) error {
+	job, err := m.services.StoryJob.GetJob(e.Auth.Id, e.Request.PathValue("id"))
+	if err != nil {
+		return response.NotFound(e.Response, "Story job not found")
+	}
+
+	return response.Success(e.Response, job, "Story job retrieved successfully")
+}
+
+// listStories lists the authenticated user's stories
+func (m *Manager) listStories(e *core.RequestEvent) error {
+	page, perPage := paginationParams(e)
+
+	stories, total, err := m.services.Story.ListStories(e.Auth.Id, page, perPage)
+	if err != nil {
+		logger.Error("Failed to list stories", err)
+		return response.InternalError(e.Response, "Failed to list stories", err)
+	}
+
+	return response.Paginated(e.Response, stories, page, perPage, total, "Stories retrieved successfully")
+}
+
+// getStory returns a single story with its chapters
+func (m *Manager) getStory(e *core.RequestEvent) error {
+	story, err := m.services.Story.GetStory(e.Auth.Id, e.Request.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrStoryNotFound) {
+			return response.NotFound(e.Response, "Story not found")
+		}
+		logger.Error("Failed to get story", err)
+		return response.InternalError(e.Response, "Failed to get story", err)
+	}
+
+	return response.Success(e.Response, story, "Story retrieved successfully")
+}
+
+// deleteStory deletes a story and its chapters
+func (m *Manager) deleteStory(e *core.RequestEvent) error {
+	if err := m.services.Story.DeleteStory(e.Auth.Id, e.Request.PathValue("id")); err != nil {
+		if errors.Is(err, services.ErrStoryNotFound) {
+			return response.NotFound(e.Response, "Story not found")
+		}
+		logger.Error("Failed to delete story", err)
+		return response.InternalError(e.Response, "Failed to delete story", err)
+	}
+
+	return response.Success(e.Response, nil, "Story deleted successfully")
+}
+
+// exportStoryEPUB downloads a story as an EPUB 3 book
+func (m *Manager) exportStoryEPUB(e *core.RequestEvent) error {
+	return m.exportStory(e, "EPUB", export.EPUBContentType, "epub", export.EPUB)
+}
+
+// exportStoryMarkdown downloads a story as Markdown with YAML front matter
+func (m *Manager) exportStoryMarkdown(e *core.RequestEvent) error {
+	return m.exportStory(e, "Markdown", export.MarkdownContentType, "md", export.Markdown)
+}
+
+// exportStoryHTML downloads a story as a single printable HTML page;
+// ?captions=true adds each chapter's image prompt as a caption
+func (m *Manager) exportStoryHTML(e *core.RequestEvent) error {
+	captions, _ := strconv.ParseBool(e.Request.URL.Query().Get("captions"))
+	opts := export.HTMLOptions{ImageCaptions: captions}
+
+	return m.exportStory(e, "HTML", export.HTMLContentType, "html", func(w io.Writer, stored *services.StoredStory) error {
+		return export.HTML(w, stored, opts)
+	})
+}
+
+// exportStory loads one of the caller's stories, renders it and sends it as
+// a file download
+func (m *Manager) exportStory(e *core.RequestEvent, format, contentType, ext string, render func(io.Writer, *services.StoredStory) error) error {
+	stored, err := m.services.Story.LoadStory(e.Auth.Id, e.Request.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrStoryNotFound) {
+			return response.NotFound(e.Response, "Story not found")
+		}
+		logger.Error("Failed to load story for export", err)
+		return response.InternalError(e.Response, "Failed to load story", err)
+	}
+
+	var buf bytes.Buffer
+	if err := render(&buf, stored); err != nil {
+		logger.Error("Failed to export story as "+format, err)
+		return response.InternalError(e.Response, "Failed to export story", err)
+	}
+
+	return sendExport(e, contentType, export.Filename(stored.Story.Title, ext), buf.Bytes())
+}
+
+// sendExport writes an exported story as a file download
+func sendExport(e *core.RequestEvent, contentType, filename string, data []byte) error {
+	e.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	e.Response.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	return e.Blob(http.StatusOK, contentType, data)
+}
+
+// regenerateChapter generates a new version of one chapter of a story; the
+// previous version is kept as a revision. It is charged to the caller's quota
+// as one chapter, which counts only when the quota unit is chapters.
+func (m *Manager) regenerateChapter(e *core.RequestEvent) error {
+	number, err := strconv.Atoi(e.Request.PathValue("number"))
+	if err != nil || number < 1 {
+		return response.BadRequest(e.Response, "Invalid chapter number")
+	}
+
+	var body chapterRegenerationBody
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+	maxLength := m.config.StoryLimits.MaxInstructionsLength
+	if utf8.RuneCountInString(body.Instructions) > maxLength {
+		errs := validator.New().Custom("instructions", false,
+			fmt.Sprintf("Instructions must be at most %d characters", maxLength)).Errors()
+		return response.ValidationError(e.Response, errs)
+	}
+	if err := m.services.Moderation.CheckRequest(e.Request.Context(), e.Auth.Id, body.Instructions); err != nil {
+		return moderationErrorResponse(e, err)
+	}
+
+	reservation, err := m.services.Quota.ReserveChapters(e.Auth.Id, 1)
+	if err != nil {
+		return quotaErrorResponse(e, err)
+	}
+
+	logger.Info("Chapter regeneration request: chapter %d of story %s", number, e.Request.PathValue("id"))
+
+	regeneration, err := m.services.Story.RegenerateChapter(e.Request.Context(), e.Auth.Id, e.Request.PathValue("id"), number, body.Instructions)
+	if err != nil {
+		m.services.Quota.Release(*reservation)
+		switch {
+		case errors.Is(err, services.ErrStoryNotFound):
+			return response.NotFound(e.Response, "Story not found")
+		case errors.Is(err, services.ErrChapterNotFound):
+			return response.NotFound(e.Response, "Chapter not found")
+		case errors.As(err, new(*services.FlaggedContentError)):
+			return moderationErrorResponse(e, err)
+		}
+		return upstreamErrorResponse(e, err)
+	}
+	if regeneration.Chapter == nil {
+		m.services.Quota.Release(*reservation)
+		return response.Error(e.Response, http.StatusBadGateway, "Regenerated chapter failed validation", regeneration.Result)
+	}
+
+	return response.Success(e.Response, regeneration, "Chapter regenerated successfully")
+}
+
+// continueStory appends newly generated chapters to a story. It is charged to
+// the caller's quota like a generation of the new chapters.
+func (m *Manager) continueStory(e *core.RequestEvent) error {
+	var body storyContinuationBody
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+
+	limits := m.config.StoryLimits
+	v := validator.New()
+	v.Range("n_chapters", body.NChapters, limits.MinChapters, limits.MaxChapters,
+		fmt.Sprintf("Number of chapters must be between %d and %d", limits.MinChapters, limits.MaxChapters))
+	v.Custom("instructions", utf8.RuneCountInString(body.Instructions) <= limits.MaxInstructionsLength,
+		fmt.Sprintf("Instructions must be at most %d characters", limits.MaxInstructionsLength))
+	if v.HasErrors() {
+		return response.ValidationError(e.Response, v.Errors())
+	}
+	if err := m.services.Moderation.CheckRequest(e.Request.Context(), e.Auth.Id, body.Instructions); err != nil {
+		return moderationErrorResponse(e, err)
+	}
+
+	reservation, err := m.services.Quota.Reserve(e.Auth.Id, services.StoryRequest{NChapters: body.NChapters})
+	if err != nil {
+		return quotaErrorResponse(e, err)
+	}
+
+	logger.Info("Story continuation request: %d chapters for story %s", body.NChapters, e.Request.PathValue("id"))
+
+	continuation, err := m.services.Story.ContinueStory(e.Request.Context(), e.Auth.Id, e.Request.PathValue("id"), body.NChapters, body.Instructions)
+	if err != nil {
+		m.services.Quota.Release(*reservation)
+		switch {
+		case errors.Is(err, services.ErrStoryNotFound):
+			return response.NotFound(e.Response, "Story not found")
+		case errors.As(err, new(*services.FlaggedContentError)):
+			return moderationErrorResponse(e, err)
+		}
+		return upstreamErrorResponse(e, err)
+	}
+	if continuation.Chapters == nil {
+		m.services.Quota.Release(*reservation)
+		return response.Error(e.Response, http.StatusBadGateway, "Story continuation failed validation", continuation.Result)
+	}
+
+	return response.Success(e.Response, continuation, "Story continued successfully")
+}
+
+// listChapterRevisions lists the revisions of one chapter, newest first
+func (m *Manager) listChapterRevisions(e *core.RequestEvent) error {
+	number, err := strconv.Atoi(e.Request.PathValue("number"))
+	if err != nil || number < 1 {
+		return response.BadRequest(e.Response, "Invalid chapter number")
+	}
+
+	revisions, err := m.services.Story.ListRevisions(e.Auth.Id, e.Request.PathValue("id"), number)
+	if err != nil {
+		return chapterErrorResponse(e, err, "Failed to list chapter revisions")
+	}
+
+	return response.Success(e.Response, revisions, "Chapter revisions retrieved successfully")
+}
+
+// listStoryImages reports the illustration status of each chapter of a story
+func (m *Manager) listStoryImages(e *core.RequestEvent) error {
+	images, err := m.services.Image.ListImages(e.Auth.Id, e.Request.PathValue("id"))
+	if err != nil {
+		return chapterErrorResponse(e, err, "Failed to list chapter images")
+	}
+
+	return response.Success(e.Response, map[string]interface{}{
+		"enabled": m.services.Image.Enabled(),
+		"images":  images,
+	}, "Chapter images retrieved successfully")
+}
+
+// retryChapterImage queues a new illustration for a chapter
+func (m *Manager) retryChapterImage(e *core.RequestEvent) error {
+	number, err := strconv.Atoi(e.Request.PathValue("number"))
+	if err != nil || number < 1 {
+		return response.BadRequest(e.Response, "Invalid chapter number")
+	}
+
+	image, err := m.services.Image.Retry(e.Auth.Id, e.Request.PathValue("id"), number)
+	switch {
+	case errors.Is(err, services.ErrImagesDisabled):
+		return response.Error(e.Response, http.StatusServiceUnavailable, "Image generation is disabled")
+	case errors.Is(err, services.ErrNoImagePrompt):
+		return response.BadRequest(e.Response, "Chapter has no image prompt")
+	case errors.Is(err, services.ErrImageInProgress):
+		return response.Error(e.Response, http.StatusConflict, "Chapter image is already being generated")
+	case errors.Is(err, services.ErrImageRetryLimit):
+		return response.TooManyRequests(e.Response, "Too many image retries, please try again later")
+	case err != nil:
+		return chapterErrorResponse(e, err, "Failed to retry chapter image")
+	}
+
+	return response.Accepted(e.Response, image, "Chapter image queued")
+}
+
+// listRevisions lists the revisions of a story and its chapters, newest
+// first; the chapter query parameter limits the list to one chapter
+func (m *Manager) listRevisions(e *core.RequestEvent) error {
+	number := 0
+	if value := e.Request.URL.Query().Get("chapter"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return response.BadRequest(e.Response, "Invalid chapter number")
+		}
+		number = n
+	}
+
+	revisions, err := m.services.Story.ListRevisions(e.Auth.Id, e.Request.PathValue("id"), number)
+	if err != nil {
+		return chapterErrorResponse(e, err, "Failed to list revisions")
+	}
+
+	return response.Success(e.Response, revisions, "Revisions retrieved successfully")
+}
+
+// diffRevisions returns a word-level diff between the from and to revisions
+func (m *Manager) diffRevisions(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	if from == "" || to == "" {
+		return response.BadRequest(e.Response, "Both from and to revision ids are required")
+	}
+
+	diff, err := m.services.Story.DiffRevisions(e.Auth.Id, e.Request.PathValue("id"), from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrRevisionsNotComparable) {
+			return response.BadRequest(e.Response, "Revisions must belong to the same story or chapter")
+		}
+		return chapterErrorResponse(e, err, "Failed to diff revisions")
+	}
+
+	return response.Success(e.Response, diff, "Revision diff retrieved successfully")
+}
+
+// restoreRevision copies an old revision back onto its story or chapter
+func (m *Manager) restoreRevision(e *core.RequestEvent) error {
+	revision, err := m.services.Story.RestoreRevision(e.Auth.Id, e.Request.PathValue("id"), e.Request.PathValue("revision"), e.Auth.Id)
+	if err != nil {
+		return chapterErrorResponse(e, err, "Failed to restore revision")
+	}
+
+	return response.Success(e.Response, revision, "Revision restored successfully")
+}
+
+// chapterErrorResponse maps story, chapter and revision lookup errors to 404
+func chapterErrorResponse(e *core.RequestEvent, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrStoryNotFound):
+		return response.NotFound(e.Response, "Story not found")
+	case errors.Is(err, services.ErrChapterNotFound):
+		return response.NotFound(e.Response, "Chapter not found")
+	case errors.Is(err, services.ErrRevisionNotFound):
+		return response.NotFound(e.Response, "Revision not found")
+	}
+	logger.Error(message, err)
+	return response.InternalError(e.Response, message, err)
+}
+
+// upstreamErrorResponse writes the error payload for a failed story
+// generation: a generic message and the upstream status
+func upstreamErrorResponse(e *core.RequestEvent, err error) error {
+	var openErr *breaker.OpenError
+	if errors.As(err, &openErr) {
+		retryAfter := retryAfterSeconds(openErr)
+		e.Response.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return e.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"error":       "Story service is temporarily unavailable, please try again later",
+			"retry_after": retryAfter,
+		})
+	}
+
+	var upstreamErr *services.UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		logger.Error("Story generation failed", err)
+		return e.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to prepare request",
+		})
+	}
+
+	// the upstream URL and response body stay in the server log and the
+	// generation log
+	body := map[string]interface{}{
+		"error":    upstreamErr.Message,
+		"attempts": upstreamErr.Attempts,
+	}
+	if upstreamErr.UpstreamStatus != 0 {
+		body["status"] = upstreamErr.UpstreamStatus
+	}
+
+	return e.JSON(upstreamErr.StatusCode, body)
+}
+
+// paginationParams reads page and perPage query parameters with sane defaults
+func paginationParams(e *core.RequestEvent) (int, int) {
+	query := e.Request.URL.Query()
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, err := strconv.Atoi(query.Get("perPage"))
+	if err != nil || perPage < 1 {
+		perPage = defaultStoriesPerPage
+	}
+	if perPage > maxStoriesPerPage {
+		perPage = maxStoriesPerPage
+	}
+
+	return page, perPage
+}
+
+// prepareStoryRequest renders the request's template, validates the result
+// and expands its character references. Problems with the request are
+// returned as validation errors. Users who set skip_story_cache always get a
+// freshly generated story.
+func (m *Manager) prepareStoryRequest(auth *core.Record, req *services.StoryRequest) (validator.ValidationErrors, error) {
+	if auth.GetBool("skip_story_cache") {
+		req.Fresh = true
+	}
+	if errs, err := m.services.Template.Apply(req); err != nil || errs.HasErrors() {
+		return errs, err
+	}
+	if errs := m.services.Story.ValidateRequest(*req); errs.HasErrors() {
+		return errs, nil
+	}
+	return m.services.Character.ExpandRequest(auth.Id, req)
+}
+
+// claimIdempotencyKey claims the request's Idempotency-Key header for the
+// request body as it was bound, before templates and characters are
+// expanded; it returns a nil claim when the request has none
+func (m *Manager) claimIdempotencyKey(e *core.RequestEvent, scope string, bound services.StoryRequest) (*services.IdempotencyClaim, error) {
+	key := strings.TrimSpace(e.Request.Header.Get("Idempotency-Key"))
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) > services.MaxIdempotencyKeyLength {
+		return nil, errIdempotencyKeyTooLong
+	}
+	return m.services.Idempotency.Begin(e.Auth.Id, scope, key, bound)
+}
+
+// idempotencyErrorResponse responds to an Idempotency-Key that cannot be used
+func idempotencyErrorResponse(e *core.RequestEvent, err error) error {
+	switch {
+	case errors.Is(err, errIdempotencyKeyTooLong):
+		return response.BadRequest(e.Response, fmt.Sprintf("Idempotency-Key must be at most %d characters", services.MaxIdempotencyKeyLength))
+	case errors.Is(err, services.ErrIdempotencyKeyMismatch):
+		return response.Error(e.Response, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+	case errors.Is(err, services.ErrIdempotencyInProgress):
+		e.Response.Header().Set("Retry-After", "5")
+		return response.Error(e.Response, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+	default:
+		return response.InternalError(e.Response, "Failed to check idempotency key", err)
+	}
+}
+
+// moderationErrorResponse responds to content rejected by moderation with
+// 422, or with 503 when the content could not be moderated. Reasons are only
+// given for the caller's own input.
+func moderationErrorResponse(e *core.RequestEvent, err error) error {
+	var flaggedErr *services.FlaggedContentError
+	switch {
+	case errors.As(err, &flaggedErr) && flaggedErr.Stage == services.ModerationStageInput:
+		return response.Error(e.Response, http.StatusUnprocessableEntity, "Request was rejected by content moderation", map[string]interface{}{
+			"reasons":    flaggedErr.Verdict.Reasons,
+			"categories": flaggedErr.Verdict.Categories,
+		})
+	case errors.As(err, &flaggedErr):
+		return response.Error(e.Response, http.StatusUnprocessableEntity, "Generated content was withheld by content moderation", map[string]interface{}{
+			"categories": flaggedErr.Verdict.Categories,
+		})
+	case errors.Is(err, services.ErrModerationUnavailable):
+		logger.Warn("Rejecting request: %v", err)
+		return response.Error(e.Response, http.StatusServiceUnavailable, "Content moderation is temporarily unavailable, please try again later")
+	}
+	return response.InternalError(e.Response, "Failed to moderate content", err)
+}
+
+// getQuota returns the caller's story generation quota for the current period
+func (m *Manager) getQuota(e *core.RequestEvent) error {
+	status, err := m.services.Quota.Status(e.Auth.Id)
+	if err != nil {
+		return response.InternalError(e.Response, "Failed to load quota", err)
+	}
+	return response.Success(e.Response, status, "")
+}
+
+// quotaErrorResponse responds to a failed quota reservation, with 429 and the
+// reset time when the quota is used up
+func quotaErrorResponse(e *core.RequestEvent, err error) error {
+	var quotaErr *services.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return response.InternalError(e.Response, "Failed to check story quota", err)
+	}
+
+	retryAfter := int(time.Until(quotaErr.Status.ResetAt).Round(time.Second) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	e.Response.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	return response.TooManyRequests(e.Response, "Story generation quota exceeded", map[string]interface{}{
+		"scope":       "quota",
+		"quota":       quotaErr.Status,
+		"reset_at":    quotaErr.Status.ResetAt,
+		"retry_after": retryAfter,
+	})
+}
+
+// storyUpstreamStatus returns the story generator backend and circuit breaker state
+func (m *Manager) storyUpstreamStatus(e *core.RequestEvent) error {
+	return response.Success(e.Response, m.services.Story.UpstreamStatus(), "")
+}
+
+// retryAfterSeconds returns the Retry-After value for an open circuit, in whole seconds
+func retryAfterSeconds(err *breaker.OpenError) int {
+	seconds := int((err.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/response"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// templatePreviewBody is the request body of a template preview
+type templatePreviewBody struct {
+	Variables map[string]string `json:"variables"`
+}
+
+// registerTemplateHooks validates story templates saved through the records API
+func (m *Manager) registerTemplateHooks() {
+	validateTemplate := func(e *core.RecordRequestEvent) error {
+		if errs := m.services.Template.Validate(e.Record); errs.HasErrors() {
+			return response.ValidationError(e.Response, errs)
+		}
+		return e.Next()
+	}
+	m.app.OnRecordCreateRequest("story_templates").BindFunc(validateTemplate)
+	m.app.OnRecordUpdateRequest("story_templates").BindFunc(validateTemplate)
+}
+
+// registerTemplateRoutes registers story template routes
+func (m *Manager) registerTemplateRoutes(se *core.ServeEvent) {
+	se.Router.POST("/api/story-templates/{id}/preview", m.previewTemplate).Bind(apis.RequireAuth())
+
+	logger.Info("Story template routes registered")
+}
+
+// previewTemplate renders a story template with the given variables and
+// returns the generation parameters it would produce, without generating
+func (m *Manager) previewTemplate(e *core.RequestEvent) error {
+	var body templatePreviewBody
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+
+	req, errs, err := m.services.Template.Render(e.Request.PathValue("id"), body.Variables)
+	if err != nil {
+		return response.InternalError(e.Response, "Failed to render story template", err)
+	}
+	if errs.HasErrors() {
+		return response.ValidationError(e.Response, errs)
+	}
+
+	return response.Success(e.Response, map[string]interface{}{
+		"template_id":        req.TemplateID,
+		"template_version":   req.TemplateVersion,
+		"story_instructions": req.StoryInstructions,
+		"n_chapters":         req.NChapters,
+		"l_chapter":          req.LChapter,
+	}, "Story template rendered successfully")
+}
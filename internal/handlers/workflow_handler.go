@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"pocket-app/internal/middleware"
+	"pocket-app/internal/services"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/response"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// workflowRunBody is the request body of a workflow run
+type workflowRunBody struct {
+	Inputs map[string]interface{} `json:"inputs"`
+}
+
+// registerWorkflowRoutes registers the routes that list and run the
+// registered Rivet workflows. Access is checked per workflow, so the run
+// route does not require auth itself.
+func (m *Manager) registerWorkflowRoutes(se *core.ServeEvent) {
+	requestLog := middleware.RequestLogging()
+
+	workflows := se.Router.Group("/api/workflows")
+	workflows.GET("", m.listWorkflows)
+	workflows.POST("/{name}/run", m.runWorkflow).BindFunc(requestLog, m.rateLimit)
+	workflows.GET("/{name}/runs", m.listWorkflowRuns).Bind(apis.RequireAuth())
+
+	logger.Info("Workflow routes registered")
+}
+
+// listWorkflows lists the workflows the caller may run, with their input schemas
+func (m *Manager) listWorkflows(e *core.RequestEvent) error {
+	workflows := m.services.Workflow.Available(e.Auth)
+
+	items := make([]map[string]interface{}, len(workflows))
+	for i, workflow := range workflows {
+		items[i] = map[string]interface{}{
+			"name":        workflow.Name,
+			"description": workflow.Description,
+			"inputs":      workflow.Inputs,
+			"auth":        workflow.Auth,
+			"timeout":     workflow.Timeout,
+		}
+	}
+
+	return response.Success(e.Response, items, "Workflows retrieved successfully")
+}
+
+// runWorkflow runs a workflow with the given inputs and returns the recorded
+// run. Failed runs respond with 502 and timed out runs with 504.
+func (m *Manager) runWorkflow(e *core.RequestEvent) error {
+	workflow, err := m.services.Workflow.Find(e.Request.PathValue("name"), e.Auth)
+	if err != nil {
+		return workflowErrorResponse(e, err)
+	}
+
+	var body workflowRunBody
+	if err := e.BindBody(&body); err != nil {
+		return response.BadRequest(e.Response, "Invalid request body")
+	}
+	if errs := workflow.ValidateInputs(body.Inputs); errs.HasErrors() {
+		return response.ValidationError(e.Response, errs)
+	}
+
+	run, err := m.services.Workflow.Run(e.Request.Context(), workflow, e.Auth, body.Inputs)
+	if err != nil {
+		return response.InternalError(e.Response, "Failed to run workflow", err)
+	}
+
+	switch run["status"] {
+	case services.WorkflowRunTimedOut:
+		return response.Error(e.Response, http.StatusGatewayTimeout, "Workflow run timed out", run)
+	case services.WorkflowRunFailed:
+		return response.Error(e.Response, http.StatusBadGateway, "Workflow run failed", run)
+	}
+	return response.Success(e.Response, run, "Workflow run succeeded")
+}
+
+// listWorkflowRuns lists the runs of a workflow, newest first: the caller's
+// own, or all of them for superusers
+func (m *Manager) listWorkflowRuns(e *core.RequestEvent) error {
+	workflow, err := m.services.Workflow.Find(e.Request.PathValue("name"), e.Auth)
+	if err != nil {
+		return workflowErrorResponse(e, err)
+	}
+
+	page, perPage := paginationParams(e)
+	runs, total, err := m.services.Workflow.ListRuns(workflow, e.Auth, page, perPage)
+	if err != nil {
+		return response.InternalError(e.Response, "Failed to list workflow runs", err)
+	}
+
+	return response.Paginated(e.Response, runs, page, perPage, total, "Workflow runs retrieved successfully")
+}
+
+// workflowErrorResponse maps workflow lookup and access errors to responses
+func workflowErrorResponse(e *core.RequestEvent, err error) error {
+	switch {
+	case errors.Is(err, services.ErrWorkflowNotFound):
+		return response.NotFound(e.Response, "Workflow not found")
+	case errors.Is(err, services.ErrWorkflowAuthRequired):
+		return response.Unauthorized(e.Response, "Authentication is required to run this workflow")
+	case errors.Is(err, services.ErrWorkflowForbidden):
+		return response.Forbidden(e.Response, "You are not allowed to run this workflow")
+	}
+	return response.InternalError(e.Response, "Failed to find workflow", err)
+}
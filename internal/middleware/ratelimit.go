@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/ratelimit"
+	"pocket-app/pkg/response"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// GenerationRateLimit limits story generation requests per authenticated
+// user and per client IP, using STORY_RATE_LIMIT_USER and STORY_RATE_LIMIT_IP
+func GenerationRateLimit(cfg *config.Config) func(e *core.RequestEvent) error {
+	users := ratelimit.New(cfg.RateLimit.UserPerMinute, time.Minute)
+	ips := ratelimit.New(cfg.RateLimit.IPPerMinute, time.Minute)
+
+	return func(e *core.RequestEvent) error {
+		ip := e.RealIP()
+		if result := ips.Allow(ip); !result.Allowed {
+			logger.Warn("Generation rate limit exceeded for IP %s", ip)
+			return tooManyRequests(e, "ip", result)
+		}
+
+		if e.Auth != nil {
+			result := users.Allow(e.Auth.Id)
+			if !result.Allowed {
+				logger.Warn("Generation rate limit exceeded for user %s", e.Auth.Id)
+				return tooManyRequests(e, "user", result)
+			}
+			setRateLimitHeaders(e, result)
+		}
+
+		return e.Next()
+	}
+}
+
+// tooManyRequests responds with 429 and when the limit resets
+func tooManyRequests(e *core.RequestEvent, scope string, result ratelimit.Result) error {
+	retryAfter := int(result.RetryAfter().Round(time.Second) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	setRateLimitHeaders(e, result)
+	e.Response.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	return response.TooManyRequests(e.Response, "Too many generation requests, please slow down", map[string]interface{}{
+		"scope":       scope,
+		"limit":       result.Limit,
+		"reset_at":    result.Reset.UTC(),
+		"retry_after": retryAfter,
+	})
+}
+
+func setRateLimitHeaders(e *core.RequestEvent, result ratelimit.Result) {
+	if result.Limit == 0 {
+		return
+	}
+	e.Response.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	e.Response.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	e.Response.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.Reset.Unix(), 10))
+}
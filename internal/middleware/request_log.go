@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"pocket-app/pkg/logger"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RequestLogging logs each request with its status and latency and, at debug
+// level, its headers and body. Headers and bodies pass through the logger's
+// redaction rules: deny-listed headers, masked fields and truncated bodies.
+func RequestLogging() func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		started := time.Now()
+
+		if logger.DebugEnabled() {
+			var body []byte
+			if e.Request.Body != nil {
+				data, err := io.ReadAll(e.Request.Body)
+				if err != nil {
+					return err
+				}
+				body = data
+				e.Request.Body = io.NopCloser(bytes.NewReader(data))
+			}
+			logger.Debug("%s %s headers: %v", e.Request.Method, e.Request.URL.Path, logger.Headers(e.Request.Header))
+			if len(body) > 0 {
+				logger.Debug("%s %s body: %s", e.Request.Method, e.Request.URL.Path, logger.Body(body))
+			}
+		}
+
+		err := e.Next()
+
+		logger.Info("%s %s -> %d in %s", e.Request.Method, e.Request.URL.Path, e.Status(), time.Since(started).Round(time.Millisecond))
+		if logger.DebugEnabled() {
+			logger.Debug("%s %s response headers: %v", e.Request.Method, e.Request.URL.Path, logger.Headers(e.Response.Header()))
+		}
+		return err
+	}
+}
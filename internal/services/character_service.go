@@ -0,0 +1,302 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/validator"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Character library limits
+const (
+	// maxCharacterRefs is the number of library characters a request may
+	// reference for each role
+	maxCharacterRefs = 10
+
+	maxCharacterTraits         = 20
+	maxCharacterTraitLength    = 50
+	maxCharacterRelationships  = 20
+	maxCharacterRelationLength = 100
+
+	// maxExpandedCharactersLength matches the size of the stories'
+	// character fields
+	maxExpandedCharactersLength = 20000
+)
+
+// CharacterRelationship relates a character to another character of the
+// same owner; Relation describes what the character is to the other one,
+// e.g. "older sister"
+type CharacterRelationship struct {
+	Character string `json:"character"`
+	Relation  string `json:"relation"`
+}
+
+// CharacterService handles the users' character libraries
+type CharacterService struct {
+	app    *pocketbase.PocketBase
+	config *config.Config
+}
+
+// NewCharacterService creates a new character service
+func NewCharacterService(app *pocketbase.PocketBase, cfg *config.Config) *CharacterService {
+	return &CharacterService{
+		app:    app,
+		config: cfg,
+	}
+}
+
+// Validate checks the traits and relationships of a character record; the
+// other fields are checked by the collection schema
+func (s *CharacterService) Validate(record *core.Record) validator.ValidationErrors {
+	v := validator.New()
+
+	var traits []string
+	if err := unmarshalOptionalJSON(record, "traits", &traits); err != nil {
+		v.Custom("traits", false, "Traits must be a list of strings")
+	} else {
+		v.Custom("traits", len(traits) <= maxCharacterTraits,
+			fmt.Sprintf("A character can have at most %d traits", maxCharacterTraits))
+		for _, trait := range traits {
+			trait = strings.TrimSpace(trait)
+			if trait == "" || utf8.RuneCountInString(trait) > maxCharacterTraitLength {
+				v.Custom("traits", false, fmt.Sprintf("Traits must be 1 to %d characters long", maxCharacterTraitLength))
+				break
+			}
+		}
+	}
+
+	var relationships []CharacterRelationship
+	if err := unmarshalOptionalJSON(record, "relationships", &relationships); err != nil {
+		v.Custom("relationships", false, `Relationships must be a list of {"character", "relation"} objects`)
+		return v.Errors()
+	}
+	v.Custom("relationships", len(relationships) <= maxCharacterRelationships,
+		fmt.Sprintf("A character can have at most %d relationships", maxCharacterRelationships))
+	for _, relationship := range relationships {
+		relation := strings.TrimSpace(relationship.Relation)
+		if relation == "" || utf8.RuneCountInString(relation) > maxCharacterRelationLength {
+			v.Custom("relationships", false, fmt.Sprintf("Each relationship needs a relation of at most %d characters", maxCharacterRelationLength))
+			break
+		}
+		if relationship.Character == record.Id {
+			v.Custom("relationships", false, "A character cannot be related to itself")
+			break
+		}
+		other, err := s.app.FindRecordById("characters", relationship.Character)
+		if err != nil || other.GetString("owner") != record.GetString("owner") {
+			v.Custom("relationships", false, fmt.Sprintf("Character %q not found", relationship.Character))
+			break
+		}
+	}
+
+	return v.Errors()
+}
+
+// ExpandRequest appends the descriptions of the library characters the
+// request references to its character text. It returns validation errors
+// for characters that do not exist or are not owned by the user.
+func (s *CharacterService) ExpandRequest(ownerID string, req *StoryRequest) (validator.ValidationErrors, error) {
+	if len(req.PrimaryCharacterIDs) == 0 && len(req.SecondaryCharacterIDs) == 0 {
+		return nil, nil
+	}
+
+	v := validator.New()
+
+	req.PrimaryCharacterIDs = uniqueStrings(req.PrimaryCharacterIDs)
+	req.SecondaryCharacterIDs = uniqueStrings(req.SecondaryCharacterIDs)
+
+	primary, err := s.findOwnedCharacters(ownerID, req.PrimaryCharacterIDs, "primary_character_ids", v)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := s.findOwnedCharacters(ownerID, req.SecondaryCharacterIDs, "secondary_character_ids", v)
+	if err != nil {
+		return nil, err
+	}
+	if v.HasErrors() {
+		return v.Errors(), nil
+	}
+
+	names, err := s.relatedNames(ownerID, append(primary, secondary...))
+	if err != nil {
+		return nil, err
+	}
+
+	req.PrimaryCharacters = appendCharacters(req.PrimaryCharacters, primary, names)
+	req.SecondaryCharacters = appendCharacters(req.SecondaryCharacters, secondary, names)
+
+	v.Custom("primary_character_ids", utf8.RuneCountInString(req.PrimaryCharacters) <= maxExpandedCharactersLength,
+		fmt.Sprintf("Primary characters must be at most %d characters once expanded", maxExpandedCharactersLength))
+	v.Custom("secondary_character_ids", utf8.RuneCountInString(req.SecondaryCharacters) <= maxExpandedCharactersLength,
+		fmt.Sprintf("Secondary characters must be at most %d characters once expanded", maxExpandedCharactersLength))
+
+	return v.Errors(), nil
+}
+
+// characterIDs returns the library characters the request references
+func (r StoryRequest) characterIDs() []string {
+	ids := append(append([]string{}, r.PrimaryCharacterIDs...), r.SecondaryCharacterIDs...)
+	return uniqueStrings(ids)
+}
+
+// findOwnedCharacters loads characters by id in the given order, adding a
+// validation error for each one the user does not own
+func (s *CharacterService) findOwnedCharacters(ownerID string, ids []string, field string, v *validator.Validator) ([]*core.Record, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	records, err := s.app.FindRecordsByIds("characters", ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		if record.GetString("owner") == ownerID {
+			byID[record.Id] = record
+		}
+	}
+
+	characters := make([]*core.Record, 0, len(ids))
+	for _, id := range ids {
+		record, ok := byID[id]
+		if !ok {
+			v.Custom(field, false, fmt.Sprintf("Character %q not found", id))
+			continue
+		}
+		characters = append(characters, record)
+	}
+	return characters, nil
+}
+
+// relatedNames returns the names of the characters the given characters
+// have relationships with, by id
+func (s *CharacterService) relatedNames(ownerID string, characters []*core.Record) (map[string]string, error) {
+	names := make(map[string]string)
+	var missing []string
+	for _, character := range characters {
+		names[character.Id] = character.GetString("name")
+	}
+	for _, character := range characters {
+		for _, relationship := range characterRelationships(character) {
+			if _, ok := names[relationship.Character]; !ok {
+				missing = append(missing, relationship.Character)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return names, nil
+	}
+
+	records, err := s.app.FindRecordsByIds("characters", uniqueStrings(missing))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.GetString("owner") == ownerID {
+			names[record.Id] = record.GetString("name")
+		}
+	}
+	return names, nil
+}
+
+// appendCharacters adds a line describing each character to free-text
+// character notes
+func appendCharacters(text string, characters []*core.Record, names map[string]string) string {
+	lines := make([]string, 0, len(characters)+1)
+	if text = strings.TrimSpace(text); text != "" {
+		lines = append(lines, text)
+	}
+	for _, character := range characters {
+		lines = append(lines, describeCharacter(character, names))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeCharacter renders a library character as a line of prompt text,
+// e.g. "Ana, age 7: A curious girl. Traits: brave, kind. Relationships:
+// older sister of Bo."
+func describeCharacter(character *core.Record, names map[string]string) string {
+	var b strings.Builder
+
+	b.WriteString(strings.TrimSpace(character.GetString("name")))
+	if age := character.GetInt("age"); age > 0 {
+		fmt.Fprintf(&b, ", age %d", age)
+	}
+
+	var details []string
+	if description := strings.TrimSpace(character.GetString("description")); description != "" {
+		details = append(details, strings.TrimRight(description, ".")+".")
+	}
+
+	var traits []string
+	if err := unmarshalOptionalJSON(character, "traits", &traits); err == nil {
+		var cleaned []string
+		for _, trait := range traits {
+			if trait = strings.TrimSpace(trait); trait != "" {
+				cleaned = append(cleaned, trait)
+			}
+		}
+		if len(cleaned) > 0 {
+			details = append(details, "Traits: "+strings.Join(cleaned, ", ")+".")
+		}
+	}
+
+	var relations []string
+	for _, relationship := range characterRelationships(character) {
+		name, ok := names[relationship.Character]
+		relation := strings.TrimSpace(relationship.Relation)
+		if !ok || relation == "" {
+			continue
+		}
+		relations = append(relations, relation+" of "+name)
+	}
+	if len(relations) > 0 {
+		details = append(details, "Relationships: "+strings.Join(relations, ", ")+".")
+	}
+
+	if len(details) > 0 {
+		b.WriteString(": ")
+		b.WriteString(strings.Join(details, " "))
+	}
+	return b.String()
+}
+
+// characterRelationships decodes a character's relationships, ignoring
+// malformed data
+func characterRelationships(character *core.Record) []CharacterRelationship {
+	var relationships []CharacterRelationship
+	if err := unmarshalOptionalJSON(character, "relationships", &relationships); err != nil {
+		return nil
+	}
+	return relationships
+}
+
+// unmarshalOptionalJSON decodes a JSON field, leaving result untouched when
+// the field is empty
+func unmarshalOptionalJSON(record *core.Record, field string, result interface{}) error {
+	raw := strings.TrimSpace(record.GetString(field))
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), result)
+}
+
+// uniqueStrings returns the non-empty values in their first order of appearance
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/breaker"
+	"pocket-app/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Generation operations, recorded with each upstream call
+const (
+	GenerationOpGenerate   = "generate"
+	GenerationOpStream     = "stream"
+	GenerationOpJob        = "job"
+	GenerationOpRegenerate = "regenerate"
+	GenerationOpContinue   = "continue"
+	GenerationOpWorkflow   = "workflow"
+	GenerationOpImage      = "image"
+	GenerationOpModeration = "moderation"
+)
+
+// Generation call outcomes
+const (
+	GenerationOutcomeSuccess             = "success"
+	GenerationOutcomeInvalid             = "invalid"
+	GenerationOutcomeParseError          = "parse_error"
+	GenerationOutcomeControlFlowExcluded = "control_flow_excluded"
+	GenerationOutcomeUpstreamError       = "upstream_error"
+	GenerationOutcomeCircuitOpen         = "circuit_open"
+	GenerationOutcomeCanceled            = "canceled"
+	GenerationOutcomeError               = "error"
+)
+
+// GenerationOperations and GenerationOutcomes are the values the generation
+// log can be filtered by
+var (
+	GenerationOperations = []string{
+		GenerationOpGenerate, GenerationOpStream, GenerationOpJob, GenerationOpRegenerate, GenerationOpContinue,
+		GenerationOpWorkflow, GenerationOpImage, GenerationOpModeration,
+	}
+	GenerationOutcomes = []string{
+		GenerationOutcomeSuccess, GenerationOutcomeInvalid, GenerationOutcomeParseError, GenerationOutcomeControlFlowExcluded,
+		GenerationOutcomeUpstreamError, GenerationOutcomeCircuitOpen, GenerationOutcomeCanceled, GenerationOutcomeError,
+	}
+)
+
+// ErrGenerationLogNotFound is returned when a generation log entry does not exist
+var ErrGenerationLogNotFound = errors.New("generation log entry not found")
+
+// generationCallerKey is the context key of the caller of a generation
+type generationCallerKey struct{}
+
+// generationCaller attributes generation calls to a user and an operation
+type generationCaller struct {
+	userID    string
+	operation string
+}
+
+// WithGenerationCaller returns a context whose generation calls are recorded
+// as made by the user for the operation
+func WithGenerationCaller(ctx context.Context, userID, operation string) context.Context {
+	return context.WithValue(ctx, generationCallerKey{}, generationCaller{userID: userID, operation: operation})
+}
+
+// GenerationCall is an upstream generation call to be recorded
+type GenerationCall struct {
+	Generator string
+	// Round counts the corrective regenerations before this call
+	Round   int
+	Request StoryRequest
+	Result  *GenerationResult
+	Err     error
+	Latency time.Duration
+}
+
+// UpstreamCall is a workflow, image or moderation call to be recorded
+type UpstreamCall struct {
+	Operation string
+	// Generator is the backend that was called, e.g. "http" or "cli"
+	Generator string
+	Request   interface{}
+	Status    int
+	Response  string
+	Attempts  int
+	Err       error
+	Latency   time.Duration
+}
+
+// GenerationLogFilter selects generation log entries; zero values match everything
+type GenerationLogFilter struct {
+	User         string
+	Operation    string
+	Outcome      string
+	Generator    string
+	Status       int
+	MinLatencyMS int
+	From         time.Time
+	To           time.Time
+}
+
+// GenerationLogService records every upstream call in the generation_logs
+// collection: story generations, workflow runs, and image and moderation
+// requests, so that a reported story can be traced back to what was sent and
+// received
+type GenerationLogService struct {
+	app    *pocketbase.PocketBase
+	config *config.Config
+}
+
+// NewGenerationLogService creates a new generation log service
+func NewGenerationLogService(app *pocketbase.PocketBase, cfg *config.Config) *GenerationLogService {
+	return &GenerationLogService{
+		app:    app,
+		config: cfg,
+	}
+}
+
+// Record stores a generation call with the caller set on its context.
+// Request and response bodies are truncated to GENERATION_LOG_MAX_BODY
+// characters.
+func (s *GenerationLogService) Record(ctx context.Context, call GenerationCall) {
+	if !s.config.GenerationLog.Enabled {
+		return
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("generation_logs")
+	if err != nil {
+		logger.Error("Failed to record generation call", err)
+		return
+	}
+
+	caller, _ := ctx.Value(generationCallerKey{}).(generationCaller)
+	maxBody := s.config.GenerationLog.MaxBodySize
+
+	request := call.Request
+	request.StoryInstructions = truncateLogText(request.StoryInstructions, maxBody)
+	request.PrimaryCharacters = truncateLogText(request.PrimaryCharacters, maxBody)
+	request.SecondaryCharacters = truncateLogText(request.SecondaryCharacters, maxBody)
+
+	record := core.NewRecord(collection)
+	record.Set("user", caller.userID)
+	record.Set("operation", caller.operation)
+	record.Set("generator", call.Generator)
+	record.Set("round", call.Round)
+	record.Set("request_hash", call.Request.Hash())
+	record.Set("request", request)
+	record.Set("latency_ms", call.Latency.Milliseconds())
+	record.Set("outcome", generationOutcome(ctx, call.Result, call.Err))
+
+	var upstreamErr *UpstreamError
+	switch {
+	case call.Err != nil && errors.As(call.Err, &upstreamErr):
+		record.Set("response_status", upstreamErr.UpstreamStatus)
+		record.Set("response", truncateLogText(upstreamErr.Body, maxBody))
+		record.Set("attempts", upstreamErr.Attempts)
+		record.Set("error", truncateRunes(call.Err.Error(), 2000))
+	case call.Err != nil:
+		record.Set("error", truncateRunes(call.Err.Error(), 2000))
+	case call.Result != nil:
+		record.Set("response_status", call.Result.StatusCode)
+		record.Set("response", truncateLogText(generationResponseText(call.Result), maxBody))
+		record.Set("attempts", call.Result.Attempts)
+		record.Set("parse_strategy", truncateRunes(call.Result.ParseStrategy, 200))
+		if call.Result.ParseError != "" {
+			record.Set("error", truncateRunes(call.Result.ParseError, 2000))
+		}
+	}
+
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to record generation call", err)
+	}
+}
+
+// RecordUpstream stores a workflow, image or moderation call, attributed to
+// the user of the caller set on its context. The request is stored as JSON
+// unless it is longer than GENERATION_LOG_MAX_BODY characters, when its
+// truncated text is stored instead.
+func (s *GenerationLogService) RecordUpstream(ctx context.Context, call UpstreamCall) {
+	if !s.config.GenerationLog.Enabled {
+		return
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("generation_logs")
+	if err != nil {
+		logger.Error("Failed to record upstream call", err)
+		return
+	}
+
+	body, err := json.Marshal(call.Request)
+	if err != nil {
+		logger.Error("Failed to record upstream call", err)
+		return
+	}
+	caller, _ := ctx.Value(generationCallerKey{}).(generationCaller)
+	maxBody := s.config.GenerationLog.MaxBodySize
+	sum := sha256.Sum256(body)
+
+	var request interface{} = json.RawMessage(body)
+	if truncated := truncateLogText(string(body), maxBody); len(truncated) != len(body) {
+		request = truncated
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("user", caller.userID)
+	record.Set("operation", call.Operation)
+	record.Set("generator", truncateRunes(call.Generator, 50))
+	record.Set("request_hash", hex.EncodeToString(sum[:]))
+	record.Set("request", request)
+	record.Set("response_status", call.Status)
+	record.Set("response", truncateLogText(call.Response, maxBody))
+	record.Set("attempts", call.Attempts)
+	record.Set("latency_ms", call.Latency.Milliseconds())
+	record.Set("outcome", upstreamOutcome(ctx, call))
+	if call.Err != nil {
+		record.Set("error", truncateRunes(call.Err.Error(), 2000))
+	}
+
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to record upstream call", err)
+	}
+}
+
+// List returns the entries matching the filter, newest first, without their
+// request and response bodies
+func (s *GenerationLogService) List(filter GenerationLogFilter, page, perPage int) ([]map[string]interface{}, int, error) {
+	collection, err := s.app.FindCollectionByNameOrId("generation_logs")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	exprs := filter.expressions()
+	query := s.app.RecordQuery(collection).
+		OrderBy("created DESC", "id DESC").
+		Limit(int64(perPage)).
+		Offset(int64((page - 1) * perPage))
+	for _, expr := range exprs {
+		query.AndWhere(expr)
+	}
+
+	var records []*core.Record
+	if err := query.All(&records); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.app.CountRecords(collection, exprs...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		entries[i] = generationLogMap(record)
+	}
+	return entries, int(total), nil
+}
+
+// Get returns an entry with its request and response bodies
+func (s *GenerationLogService) Get(id string) (map[string]interface{}, error) {
+	record, err := s.app.FindRecordById("generation_logs", id)
+	if err != nil {
+		return nil, ErrGenerationLogNotFound
+	}
+
+	entry := generationLogMap(record)
+	entry["request"] = record.Get("request")
+	entry["response"] = record.GetString("response")
+	return entry, nil
+}
+
+// Prune deletes the entries older than GENERATION_LOG_RETENTION in a single
+// statement, without loading them; a zero retention keeps them forever
+func (s *GenerationLogService) Prune() {
+	retention := s.config.GenerationLog.Retention
+	if retention <= 0 {
+		return
+	}
+
+	cutoff, err := types.ParseDateTime(time.Now().Add(-retention))
+	if err != nil {
+		logger.Error("Failed to prune generation logs", err)
+		return
+	}
+
+	result, err := s.app.DB().Delete(
+		"generation_logs",
+		dbx.NewExp("[[created]] < {:cutoff}", dbx.Params{"cutoff": cutoff.String()}),
+	).Execute()
+	if err != nil {
+		logger.Error("Failed to delete expired generation logs", err)
+		return
+	}
+	if pruned, err := result.RowsAffected(); err == nil && pruned > 0 {
+		logger.Info("Pruned %d expired generation logs", pruned)
+	}
+}
+
+// expressions converts the filter to query conditions
+func (f GenerationLogFilter) expressions() []dbx.Expression {
+	var exprs []dbx.Expression
+	if f.User != "" {
+		exprs = append(exprs, dbx.HashExp{"user": f.User})
+	}
+	if f.Operation != "" {
+		exprs = append(exprs, dbx.HashExp{"operation": f.Operation})
+	}
+	if f.Outcome != "" {
+		exprs = append(exprs, dbx.HashExp{"outcome": f.Outcome})
+	}
+	if f.Generator != "" {
+		exprs = append(exprs, dbx.HashExp{"generator": f.Generator})
+	}
+	if f.Status != 0 {
+		exprs = append(exprs, dbx.HashExp{"response_status": f.Status})
+	}
+	if f.MinLatencyMS > 0 {
+		exprs = append(exprs, dbx.NewExp("[[latency_ms]] >= {:latency}", dbx.Params{"latency": f.MinLatencyMS}))
+	}
+	if !f.From.IsZero() {
+		exprs = append(exprs, dbx.NewExp("[[created]] >= {:from}", dbx.Params{"from": f.From.UTC().Format(types.DefaultDateLayout)}))
+	}
+	if !f.To.IsZero() {
+		exprs = append(exprs, dbx.NewExp("[[created]] < {:to}", dbx.Params{"to": f.To.UTC().Format(types.DefaultDateLayout)}))
+	}
+	return exprs
+}
+
+// generationOutcome classifies the result of a generation call
+func generationOutcome(ctx context.Context, result *GenerationResult, err error) string {
+	var openErr *breaker.OpenError
+	var upstreamErr *UpstreamError
+	switch {
+	case err == nil && result.Valid():
+		return GenerationOutcomeSuccess
+	case err == nil && result.Status == "control_flow_excluded":
+		return GenerationOutcomeControlFlowExcluded
+	case err == nil && result.Story == nil:
+		return GenerationOutcomeParseError
+	case err == nil:
+		return GenerationOutcomeInvalid
+	case errors.As(err, &openErr):
+		return GenerationOutcomeCircuitOpen
+	case ctx.Err() != nil:
+		return GenerationOutcomeCanceled
+	case errors.As(err, &upstreamErr):
+		return GenerationOutcomeUpstreamError
+	}
+	return GenerationOutcomeError
+}
+
+// upstreamOutcome classifies the result of a workflow, image or moderation
+// call: calls that got no usable response are upstream errors, and calls
+// whose response could not be read are parse errors
+func upstreamOutcome(ctx context.Context, call UpstreamCall) string {
+	switch {
+	case call.Err == nil:
+		return GenerationOutcomeSuccess
+	case ctx.Err() != nil:
+		return GenerationOutcomeCanceled
+	case call.Status == 0 || call.Status >= 400:
+		return GenerationOutcomeUpstreamError
+	}
+	return GenerationOutcomeParseError
+}
+
+// generationResponseText returns what the upstream sent back: its raw
+// response when the generator kept it, or else the model's text, the story
+// text or the story
+func generationResponseText(result *GenerationResult) string {
+	if result.RawResponse != "" {
+		return result.RawResponse
+	}
+	if result.ModelOutput != "" {
+		return result.ModelOutput
+	}
+	if result.StoryText != "" {
+		return result.StoryText
+	}
+	if result.Story != nil {
+		data, err := json.Marshal(result.Story)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return ""
+}
+
+// truncateLogText shortens a logged body to at most max runes, noting how
+// much was cut; a max of zero or less keeps the whole body
+func truncateLogText(text string, max int) string {
+	if max <= 0 {
+		return text
+	}
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + fmt.Sprintf("… [truncated %d characters]", len(runes)-max)
+}
+
+// generationLogMap converts a generation log record to its API
+// representation, without the request and response bodies
+func generationLogMap(record *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              record.Id,
+		"user":            record.GetString("user"),
+		"operation":       record.GetString("operation"),
+		"generator":       record.GetString("generator"),
+		"round":           record.GetInt("round"),
+		"request_hash":    record.GetString("request_hash"),
+		"response_status": record.GetInt("response_status"),
+		"latency_ms":      record.GetInt("latency_ms"),
+		"attempts":        record.GetInt("attempts"),
+		"parse_strategy":  record.GetString("parse_strategy"),
+		"outcome":         record.GetString("outcome"),
+		"error":           record.GetString("error"),
+		"created":         record.GetDateTime("created"),
+	}
+}
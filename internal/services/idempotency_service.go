@@ -0,0 +1,280 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Idempotency key statuses
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// MaxIdempotencyKeyLength is the longest accepted Idempotency-Key header
+const MaxIdempotencyKeyLength = 255
+
+// idempotencyTokenLength is the length of the token that marks who holds a claim
+const idempotencyTokenLength = 32
+
+// idempotencyStaleFloor is how long an in-progress key is held when
+// generations have neither an overall nor a per-attempt time limit
+const idempotencyStaleFloor = 30 * time.Minute
+
+var (
+	// ErrIdempotencyKeyMismatch is returned when a key is reused with a different request
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key was already used with a different request")
+
+	// ErrIdempotencyInProgress is returned while the first request with a key is still running
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// IdempotencyClaim is the outcome of presenting an idempotency key. Replay is
+// set when the key has already completed; otherwise the caller owns the key
+// and must Complete or Abandon the claim.
+type IdempotencyClaim struct {
+	record *core.Record
+	token  string
+	Replay *IdempotentReplay
+}
+
+// IdempotentReplay is the stored outcome of an earlier request with the same key
+type IdempotentReplay struct {
+	StatusCode int
+	Response   interface{}
+	JobID      string
+}
+
+// IdempotencyService stores request outcomes by Idempotency-Key in the idempotency_keys collection
+type IdempotencyService struct {
+	app    *pocketbase.PocketBase
+	config *config.Config
+}
+
+// NewIdempotencyService creates a new idempotency service
+func NewIdempotencyService(app *pocketbase.PocketBase, cfg *config.Config) *IdempotencyService {
+	return &IdempotencyService{
+		app:    app,
+		config: cfg,
+	}
+}
+
+// Begin claims a key for a request, given as the client sent it. Reusing a
+// key with a different scope or request fails with ErrIdempotencyKeyMismatch,
+// and reusing it while the first request runs fails with
+// ErrIdempotencyInProgress. Expired keys, and in-progress keys older than the
+// longest a generation can run, are claimed anew.
+func (s *IdempotencyService) Begin(ownerID, scope, key string, req StoryRequest) (*IdempotencyClaim, error) {
+	fingerprint, err := idempotencyFingerprint(scope, req)
+	if err != nil {
+		return nil, err
+	}
+	token := security.RandomString(idempotencyTokenLength)
+	now := time.Now()
+
+	var claim *IdempotencyClaim
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := txApp.FindFirstRecordByFilter(
+			"idempotency_keys",
+			"owner = {:owner} && key = {:key}",
+			dbx.Params{"owner": ownerID, "key": key},
+		)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if record != nil && record.GetDateTime("expires_at").Time().After(now) {
+			if record.GetString("fingerprint") != fingerprint {
+				return ErrIdempotencyKeyMismatch
+			}
+			if record.GetString("status") == IdempotencyCompleted {
+				claim = &IdempotencyClaim{
+					record: record,
+					Replay: &IdempotentReplay{
+						StatusCode: record.GetInt("response_status"),
+						Response:   record.Get("response"),
+						JobID:      record.GetString("job"),
+					},
+				}
+				return nil
+			}
+			if now.Sub(record.GetDateTime("updated").Time()) < s.staleAfter() {
+				return ErrIdempotencyInProgress
+			}
+			logger.Warn("Taking over abandoned idempotency key for user %s", ownerID)
+		}
+
+		if record == nil {
+			collection, err := txApp.FindCollectionByNameOrId("idempotency_keys")
+			if err != nil {
+				return err
+			}
+			record = core.NewRecord(collection)
+			record.Set("owner", ownerID)
+			record.Set("key", key)
+		}
+
+		expiresAt, err := types.ParseDateTime(now.Add(s.config.Story.IdempotencyWindow))
+		if err != nil {
+			return err
+		}
+		record.Set("scope", scope)
+		record.Set("fingerprint", fingerprint)
+		record.Set("token", token)
+		record.Set("status", IdempotencyInProgress)
+		record.Set("response_status", 0)
+		record.Set("response", nil)
+		record.Set("job", "")
+		record.Set("expires_at", expiresAt)
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+
+		claim = &IdempotencyClaim{record: record, token: token}
+		return nil
+	})
+	if isUniqueViolation(err) {
+		// a concurrent first request with the same key created it first
+		return nil, ErrIdempotencyInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+// Complete stores the outcome of a claimed request for replay, unless the
+// key has since been taken over by another request
+func (s *IdempotencyService) Complete(claim *IdempotencyClaim, statusCode int, response interface{}, jobID string) {
+	if claim == nil || claim.Replay != nil {
+		return
+	}
+
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := s.heldRecord(txApp, claim)
+		if err != nil || record == nil {
+			return err
+		}
+
+		record.Set("status", IdempotencyCompleted)
+		record.Set("response_status", statusCode)
+		record.Set("response", response)
+		record.Set("job", jobID)
+		return txApp.Save(record)
+	})
+	if err != nil {
+		logger.Error("Failed to store idempotent response", err)
+	}
+}
+
+// Abandon releases a claimed key so that a retry of the request runs again,
+// unless the key has since been taken over by another request
+func (s *IdempotencyService) Abandon(claim *IdempotencyClaim) {
+	if claim == nil || claim.Replay != nil {
+		return
+	}
+
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := s.heldRecord(txApp, claim)
+		if err != nil || record == nil {
+			return err
+		}
+		return txApp.Delete(record)
+	})
+	if err != nil {
+		logger.Error("Failed to release idempotency key", err)
+	}
+}
+
+// heldRecord reloads the key of a claim; it returns nil when the key is gone
+// or now belongs to a request that took it over
+func (s *IdempotencyService) heldRecord(txApp core.App, claim *IdempotencyClaim) (*core.Record, error) {
+	record, err := txApp.FindRecordById("idempotency_keys", claim.record.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.GetString("token") != claim.token {
+		logger.Warn("Idempotency key was taken over before the request finished")
+		return nil, nil
+	}
+	return record, nil
+}
+
+// Prune deletes expired keys in a single statement, without loading them
+func (s *IdempotencyService) Prune() {
+	result, err := s.app.DB().Delete(
+		"idempotency_keys",
+		dbx.NewExp("[[expires_at]] < {:now}", dbx.Params{"now": types.NowDateTime().String()}),
+	).Execute()
+	if err != nil {
+		logger.Error("Failed to delete expired idempotency keys", err)
+		return
+	}
+	if pruned, err := result.RowsAffected(); err == nil && pruned > 0 {
+		logger.Info("Pruned %d expired idempotency keys", pruned)
+	}
+}
+
+// staleAfter is how long an in-progress key may go without completing
+// before it is considered abandoned: every validation round of a generation
+// may take up to the overall upstream timeout, or without one, up to every
+// attempt running into its own timeout after the longest backoff
+func (s *IdempotencyService) staleAfter() time.Duration {
+	retry := s.config.Retry
+
+	round := retry.OverallTimeout
+	if round <= 0 {
+		attempts := time.Duration(max(retry.MaxAttempts, 1))
+		if retry.AttemptTimeout <= 0 {
+			return idempotencyStaleFloor
+		}
+		round = attempts*retry.AttemptTimeout + (attempts-1)*retry.MaxDelay
+	}
+
+	rounds := time.Duration(s.config.Story.ValidationRetries + 1)
+	return rounds*round + time.Minute
+}
+
+// isUniqueViolation reports whether a save failed because a value broke a
+// unique index, e.g. when a concurrent request stored the same value first
+func isUniqueViolation(err error) bool {
+	var fieldErrs validation.Errors
+	if !errors.As(err, &fieldErrs) {
+		return false
+	}
+	for _, fieldErr := range fieldErrs {
+		var validationErr validation.Error
+		if errors.As(fieldErr, &validationErr) && validationErr.Code() == "validation_not_unique" {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotencyFingerprint identifies the endpoint and request body a key was used for
+func idempotencyFingerprint(scope string, req StoryRequest) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(scope+":"), body...))
+	return hex.EncodeToString(sum[:]), nil
+}
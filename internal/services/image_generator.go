@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/retry"
+)
+
+// Image backend names, selected with IMAGE_BACKEND
+const (
+	ImageBackendHTTP = "http"
+)
+
+// GeneratedImage is an image produced by an image backend
+type GeneratedImage struct {
+	Data        []byte
+	ContentType string
+}
+
+// ImageGenerator produces an illustration for an image prompt
+type ImageGenerator interface {
+	// Name returns the backend name
+	Name() string
+
+	// Generate creates one image, including the backend's own retries
+	Generate(ctx context.Context, prompt string) (*GeneratedImage, error)
+}
+
+// NewImageGenerator creates the image generator selected in the configuration
+func NewImageGenerator(cfg *config.Config, logs *GenerationLogService) (ImageGenerator, error) {
+	switch cfg.Image.Backend {
+	case ImageBackendHTTP:
+		return NewHTTPImageGenerator(cfg, logs), nil
+	default:
+		return nil, fmt.Errorf("unknown image backend %q", cfg.Image.Backend)
+	}
+}
+
+// HTTPImageGenerator posts image prompts to an HTTP endpoint (IMAGE_API_URL).
+// The endpoint answers with the image itself, or with JSON holding the image
+// as base64 in an "image" field. Every call is recorded in the generation log.
+type HTTPImageGenerator struct {
+	config *config.Config
+	client *retry.Client
+	logs   *GenerationLogService
+}
+
+// NewHTTPImageGenerator creates a new HTTP image generator
+func NewHTTPImageGenerator(cfg *config.Config, logs *GenerationLogService) *HTTPImageGenerator {
+	policy := storyRetryPolicy(cfg)
+	policy.MaxAttempts = cfg.Image.MaxAttempts
+	policy.AttemptTimeout = cfg.Image.Timeout
+	policy.OverallTimeout = 0
+
+	return &HTTPImageGenerator{
+		config: cfg,
+		client: retry.NewClient(policy),
+		logs:   logs,
+	}
+}
+
+// Name returns the backend name
+func (g *HTTPImageGenerator) Name() string {
+	return ImageBackendHTTP
+}
+
+// imageResponse is the JSON form of an image endpoint response
+type imageResponse struct {
+	Image       string `json:"image"`
+	ContentType string `json:"content_type"`
+	Error       string `json:"error"`
+}
+
+// Generate calls the image endpoint, retrying on transport errors and
+// retryable statuses
+func (g *HTTPImageGenerator) Generate(ctx context.Context, prompt string) (*GeneratedImage, error) {
+	request := map[string]string{"prompt": prompt}
+	call := UpstreamCall{Operation: GenerationOpImage, Generator: g.Name(), Request: request}
+	started := time.Now()
+
+	image, err := g.generate(ctx, request, &call)
+	call.Err = err
+	call.Latency = time.Since(started)
+	if image != nil {
+		call.Response = fmt.Sprintf("%d bytes of %s", len(image.Data), image.ContentType)
+	}
+	g.logs.RecordUpstream(ctx, call)
+
+	return image, err
+}
+
+// generate makes the image request and notes its status, attempts and, when
+// it is not an image, its response on the call
+func (g *HTTPImageGenerator) generate(ctx context.Context, request map[string]string, call *UpstreamCall) (*GeneratedImage, error) {
+	apiURL := g.config.Image.APIURL
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Accept", "image/*, application/json")
+
+	resp, attempts, err := g.client.Do(ctx, http.MethodPost, apiURL, body, header)
+	call.Attempts = attempts
+	if err != nil {
+		var statusErr *retry.StatusError
+		if !errors.As(err, &statusErr) {
+			return nil, fmt.Errorf("image request failed after %d attempts: %w", attempts, err)
+		}
+		resp = statusErr.Response
+	}
+
+	call.Status = resp.StatusCode
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		call.Response = string(resp.Body)
+	}
+	if resp.StatusCode >= 400 {
+		message := strings.TrimSpace(string(resp.Body))
+		var decoded imageResponse
+		if json.Unmarshal(resp.Body, &decoded) == nil && decoded.Error != "" {
+			message = decoded.Error
+		}
+		message = truncateRunes(message, 200)
+		return nil, fmt.Errorf("image API returned status %d: %s", resp.StatusCode, message)
+	}
+
+	image := &GeneratedImage{Data: resp.Body, ContentType: contentType}
+	if strings.HasPrefix(contentType, "application/json") {
+		var decoded imageResponse
+		if err := json.Unmarshal(resp.Body, &decoded); err != nil {
+			return nil, fmt.Errorf("invalid image API response: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(decoded.Image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image data: %w", err)
+		}
+		image = &GeneratedImage{Data: data, ContentType: decoded.ContentType}
+	}
+
+	// trust the bytes rather than the label
+	image.ContentType = http.DetectContentType(image.Data)
+	if !strings.HasPrefix(image.ContentType, "image/") {
+		return nil, fmt.Errorf("image API returned %s instead of an image", image.ContentType)
+	}
+
+	logger.Debug("Image API returned %d bytes of %s after %d attempts", len(image.Data), image.ContentType, attempts)
+	return image, nil
+}
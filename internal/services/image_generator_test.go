@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"pocket-app/internal/config"
+)
+
+// imageReply is one canned answer of a test image endpoint
+type imageReply struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// TestHTTPImageGenerator runs the generator against endpoints that answer
+// like cmd/image-stub: with the image, with base64 JSON (-json) or with 503s
+// (-fail-every)
+func TestHTTPImageGenerator(t *testing.T) {
+	pngData := testPNG(t)
+	jsonImage := func(data []byte) []byte {
+		body, _ := json.Marshal(map[string]string{
+			"image":        base64.StdEncoding.EncodeToString(data),
+			"content_type": "image/png",
+		})
+		return body
+	}
+	unavailable := imageReply{http.StatusServiceUnavailable, "application/json", []byte(`{"error":"stub failure"}`)}
+
+	tests := []struct {
+		name      string
+		replies   []imageReply // the last reply repeats
+		wantCalls int
+		wantErr   string
+	}{
+		{
+			name:      "image body",
+			replies:   []imageReply{{http.StatusOK, "image/png", pngData}},
+			wantCalls: 1,
+		},
+		{
+			name:      "mislabeled image body",
+			replies:   []imageReply{{http.StatusOK, "application/octet-stream", pngData}},
+			wantCalls: 1,
+		},
+		{
+			name:      "base64 image in JSON",
+			replies:   []imageReply{{http.StatusOK, "application/json; charset=utf-8", jsonImage(pngData)}},
+			wantCalls: 1,
+		},
+		{
+			name:      "503 retried",
+			replies:   []imageReply{unavailable, unavailable, {http.StatusOK, "image/png", pngData}},
+			wantCalls: 3,
+		},
+		{
+			name:      "503 until the attempts run out",
+			replies:   []imageReply{unavailable},
+			wantCalls: 3,
+			wantErr:   "image API returned status 503: stub failure",
+		},
+		{
+			name:      "client error not retried",
+			replies:   []imageReply{{http.StatusBadRequest, "application/json", []byte(`{"error":"a prompt is required"}`)}},
+			wantCalls: 1,
+			wantErr:   "image API returned status 400: a prompt is required",
+		},
+		{
+			name:      "not an image",
+			replies:   []imageReply{{http.StatusOK, "image/png", []byte("<html>busy</html>")}},
+			wantCalls: 1,
+			wantErr:   "instead of an image",
+		},
+		{
+			name:      "invalid base64",
+			replies:   []imageReply{{http.StatusOK, "application/json", []byte(`{"image":"not base64!"}`)}},
+			wantCalls: 1,
+			wantErr:   "invalid image data",
+		},
+		{
+			name:      "invalid JSON",
+			replies:   []imageReply{{http.StatusOK, "application/json", []byte(`{"image":`)}},
+			wantCalls: 1,
+			wantErr:   "invalid image API response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Prompt string `json:"prompt"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Prompt != "a fox under the moon" {
+					t.Errorf("request body prompt = %q (%v)", body.Prompt, err)
+				}
+
+				reply := tt.replies[min(calls, len(tt.replies)-1)]
+				calls++
+				w.Header().Set("Content-Type", reply.contentType)
+				w.WriteHeader(reply.status)
+				w.Write(reply.body)
+			}))
+			defer server.Close()
+
+			generated, err := testImageGenerator(server.URL).Generate(context.Background(), "a fox under the moon")
+
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+			if generated.ContentType != "image/png" || !bytes.Equal(generated.Data, pngData) {
+				t.Errorf("generated %d bytes of %s, want the %d byte PNG", len(generated.Data), generated.ContentType, len(pngData))
+			}
+		})
+	}
+}
+
+func TestHTTPImageGeneratorUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := testImageGenerator(server.URL).Generate(context.Background(), "a fox")
+	if err == nil || !strings.Contains(err.Error(), "image request failed after 3 attempts") {
+		t.Errorf("err = %v, want a failed request after 3 attempts", err)
+	}
+}
+
+func TestHTTPImageGeneratorLongError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(strings.Repeat("é", 300)))
+	}))
+	defer server.Close()
+
+	_, err := testImageGenerator(server.URL).Generate(context.Background(), "a fox")
+	if err == nil {
+		t.Fatal("Generate() succeeded on a 400")
+	}
+	if !utf8.ValidString(err.Error()) || strings.Count(err.Error(), "é") != 200 {
+		t.Errorf("err = %q, want the message cut to 200 characters", err)
+	}
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	thumbnail, err := makeThumbnail(testPNG(t), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || img.Bounds().Dx() != 8 || img.Bounds().Dy() != 4 {
+		t.Errorf("thumbnail is a %dx%d %s, want an 8x4 jpeg", img.Bounds().Dx(), img.Bounds().Dy(), format)
+	}
+
+	if _, err := makeThumbnail([]byte("not an image"), 8); err == nil {
+		t.Error("makeThumbnail() accepted data that is not an image")
+	}
+}
+
+// testImageGenerator returns an HTTP image generator for a test endpoint
+// with three quick attempts
+func testImageGenerator(apiURL string) *HTTPImageGenerator {
+	cfg := &config.Config{
+		Image: config.ImageConfig{
+			APIURL:      apiURL,
+			Timeout:     5 * time.Second,
+			MaxAttempts: 3,
+		},
+		Retry: config.RetryConfig{
+			InitialDelay:      time.Millisecond,
+			MaxDelay:          5 * time.Millisecond,
+			Multiplier:        2,
+			RetryableStatuses: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable},
+		},
+	}
+	// generation logging is disabled in cfg, so the log service needs no app
+	return NewHTTPImageGenerator(cfg, NewGenerationLogService(nil, cfg))
+}
+
+// testPNG returns a small 32x16 PNG
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 16))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
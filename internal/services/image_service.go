@@ -0,0 +1,510 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/ratelimit"
+
+	"github.com/disintegration/imaging"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+
+	// imaging registers the GIF, JPEG and PNG decoders; WebP is added for
+	// backends that return it
+	_ "golang.org/x/image/webp"
+)
+
+// Chapter image statuses
+const (
+	ImageStatusPending    = "pending"
+	ImageStatusGenerating = "generating"
+	ImageStatusSucceeded  = "succeeded"
+	ImageStatusFailed     = "failed"
+)
+
+var (
+	// ErrImagesDisabled is returned when image generation is turned off
+	ErrImagesDisabled = errors.New("image generation is disabled")
+
+	// ErrNoImagePrompt is returned when a chapter has no image prompt to illustrate
+	ErrNoImagePrompt = errors.New("chapter has no image prompt")
+
+	// ErrImageInProgress is returned when a chapter's image is already queued or generating
+	ErrImageInProgress = errors.New("chapter image is already being generated")
+
+	// ErrImageQueueFull is returned when no more images can be queued
+	ErrImageQueueFull = errors.New("image queue is full")
+
+	// ErrImageRetryLimit is returned when a user asked for too many image retries
+	ErrImageRetryLimit = errors.New("too many image retries")
+)
+
+// ImageService illustrates chapters in background workers. A chapter whose
+// image prompt is created or changed is marked pending and queued; the
+// workers store the image and a thumbnail as files on the chapter record.
+// Chapters of stories held back by moderation are only illustrated once a
+// reviewer approves the story. Owners cannot edit image prompts directly, so
+// retries are the only images they can ask for, and those are rate limited.
+type ImageService struct {
+	app       *pocketbase.PocketBase
+	config    *config.Config
+	story     *StoryService
+	generator ImageGenerator
+	retries   *ratelimit.Limiter
+
+	queue     chan string
+	queuedMu  sync.Mutex
+	queued    map[string]struct{}
+	stop      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewImageService creates a new image service
+func NewImageService(app *pocketbase.PocketBase, cfg *config.Config, story *StoryService, generator ImageGenerator) *ImageService {
+	queueSize := cfg.Image.QueueSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ImageService{
+		app:       app,
+		config:    cfg,
+		story:     story,
+		generator: generator,
+		retries:   ratelimit.New(cfg.Image.RetriesPerHour, time.Hour),
+		queue:     make(chan string, queueSize),
+		queued:    make(map[string]struct{}),
+		stop:      make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Enabled reports whether chapters are illustrated
+func (s *ImageService) Enabled() bool {
+	return s.config.Image.Enabled
+}
+
+// RegisterHooks marks chapters pending when their image prompt is set or
+// changed, or when their story is approved, and queues them once the change
+// is committed
+func (s *ImageService) RegisterHooks() {
+	s.app.OnRecordCreate("story_chapters").BindFunc(func(e *core.RecordEvent) error {
+		if s.Enabled() && e.Record.GetString("image_prompt") != "" && chapterStoryVisible(e.App, e.Record) {
+			markImagePending(e.Record)
+		}
+		return e.Next()
+	})
+
+	s.app.OnRecordUpdate("story_chapters").BindFunc(func(e *core.RecordEvent) error {
+		prompt := e.Record.GetString("image_prompt")
+		if s.Enabled() && prompt != "" && prompt != e.Record.Original().GetString("image_prompt") && chapterStoryVisible(e.App, e.Record) {
+			markImagePending(e.Record)
+		}
+		return e.Next()
+	})
+
+	s.app.OnRecordUpdate("stories").BindFunc(func(e *core.RecordEvent) error {
+		approved := !storyVisible(e.Record.Original()) && storyVisible(e.Record)
+		if err := e.Next(); err != nil || !approved || !s.Enabled() {
+			return err
+		}
+		s.markStoryPending(e.App, e.Record.Id)
+		return nil
+	})
+
+	queuePending := func(e *core.RecordEvent) error {
+		if s.Enabled() && e.Record.GetString("image_status") == ImageStatusPending {
+			s.enqueue(e.Record)
+		}
+		return e.Next()
+	}
+	s.app.OnRecordAfterCreateSuccess("story_chapters").BindFunc(queuePending)
+	s.app.OnRecordAfterUpdateSuccess("story_chapters").BindFunc(queuePending)
+}
+
+// Start launches the workers and re-queues images left unfinished by a previous run
+func (s *ImageService) Start() {
+	if !s.Enabled() {
+		return
+	}
+
+	s.startOnce.Do(func() {
+		workers := s.config.Image.Workers
+		if workers < 1 {
+			workers = 1
+		}
+
+		for i := 0; i < workers; i++ {
+			s.wg.Add(1)
+			go s.worker()
+		}
+
+		logger.Info("Image workers started: %d (%s)", workers, s.generator.Name())
+
+		s.recoverPendingImages()
+	})
+}
+
+// Stop signals the workers to exit and cancels in-flight generations; their
+// chapters stay "generating" and are re-queued on the next start
+func (s *ImageService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.cancel()
+		s.wg.Wait()
+		logger.Info("Image workers stopped")
+	})
+}
+
+// ListImages returns the image status of every chapter of one of the user's stories
+func (s *ImageService) ListImages(ownerID, storyID string) ([]map[string]interface{}, error) {
+	story, err := s.story.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters, err := s.story.findChapters(story.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]map[string]interface{}, len(chapters))
+	for i, chapter := range chapters {
+		images[i] = chapterImageMap(chapter)
+	}
+	return images, nil
+}
+
+// Retry queues a new image for a chapter whose image failed or should be
+// redrawn. Each user may retry IMAGE_RETRY_LIMIT_USER images every hour.
+func (s *ImageService) Retry(ownerID, storyID string, number int) (map[string]interface{}, error) {
+	if !s.Enabled() {
+		return nil, ErrImagesDisabled
+	}
+
+	chapter, err := s.story.findOwnedChapter(ownerID, storyID, number)
+	if err != nil {
+		return nil, err
+	}
+	if chapter.GetString("image_prompt") == "" {
+		return nil, ErrNoImagePrompt
+	}
+	switch chapter.GetString("image_status") {
+	case ImageStatusPending, ImageStatusGenerating:
+		return nil, ErrImageInProgress
+	}
+	if !s.retries.Allow(ownerID).Allowed {
+		logger.Warn("Image retry limit exceeded for user %s", ownerID)
+		return nil, ErrImageRetryLimit
+	}
+
+	markImagePending(chapter)
+	if err := s.app.Save(chapter); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Image for chapter %s queued for retry", chapter.Id)
+	return chapterImageMap(chapter), nil
+}
+
+// enqueue hands a pending chapter to the workers; a chapter that cannot be
+// queued is marked failed so that it can be retried
+func (s *ImageService) enqueue(chapter *core.Record) {
+	s.queuedMu.Lock()
+	if _, ok := s.queued[chapter.Id]; ok {
+		s.queuedMu.Unlock()
+		return
+	}
+	s.queued[chapter.Id] = struct{}{}
+	s.queuedMu.Unlock()
+
+	select {
+	case s.queue <- chapter.Id:
+		logger.Debug("Image for chapter %s queued", chapter.Id)
+	default:
+		s.dequeued(chapter.Id)
+		logger.Warn("Image queue is full, chapter %s not illustrated", chapter.Id)
+		s.fail(chapter, ErrImageQueueFull)
+	}
+}
+
+// dequeued forgets that a chapter is waiting in the queue
+func (s *ImageService) dequeued(chapterID string) {
+	s.queuedMu.Lock()
+	delete(s.queued, chapterID)
+	s.queuedMu.Unlock()
+}
+
+// recoverPendingImages puts chapters that were pending or generating at
+// shutdown back on the queue
+func (s *ImageService) recoverPendingImages() {
+	records, err := s.app.FindRecordsByFilter(
+		"story_chapters",
+		"image_status = {:pending} || image_status = {:generating}",
+		"updated",
+		0,
+		0,
+		dbx.Params{"pending": ImageStatusPending, "generating": ImageStatusGenerating},
+	)
+	if err != nil {
+		logger.Error("Failed to load pending chapter images", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	logger.Info("Re-queueing %d pending chapter images", len(records))
+
+	go func() {
+		for _, record := range records {
+			s.queuedMu.Lock()
+			s.queued[record.Id] = struct{}{}
+			s.queuedMu.Unlock()
+
+			select {
+			case s.queue <- record.Id:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// worker processes queued chapters until the service is stopped
+func (s *ImageService) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case chapterID := <-s.queue:
+			s.dequeued(chapterID)
+			s.run(chapterID)
+		}
+	}
+}
+
+// run generates the image of a single chapter and records the outcome
+func (s *ImageService) run(chapterID string) {
+	record, err := s.app.FindRecordById("story_chapters", chapterID)
+	if err != nil {
+		logger.Error("Failed to load chapter "+chapterID+" for its image", err)
+		return
+	}
+	switch record.GetString("image_status") {
+	case ImageStatusPending, ImageStatusGenerating:
+	default:
+		return
+	}
+	story, err := s.app.FindRecordById("stories", record.GetString("story"))
+	if err != nil || !storyVisible(story) {
+		// left for the story's approval to queue again
+		logger.Info("Story of chapter %s is held back by moderation, not illustrating it", chapterID)
+		record.Set("image_status", "")
+		if err := s.app.Save(record); err != nil {
+			logger.Error("Failed to reset image status of chapter "+chapterID, err)
+		}
+		return
+	}
+
+	prompt := record.GetString("image_prompt")
+	record.Set("image_status", ImageStatusGenerating)
+	record.Set("image_attempts", record.GetInt("image_attempts")+1)
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to mark chapter image as generating", err)
+		return
+	}
+
+	logger.Info("Generating image for chapter %s", chapterID)
+
+	ctx := WithGenerationCaller(s.ctx, story.GetString("owner"), GenerationOpImage)
+	generated, err := s.generator.Generate(ctx, prompt)
+	if s.ctx.Err() != nil {
+		logger.Info("Image for chapter %s interrupted by shutdown", chapterID)
+		return
+	}
+	var thumbnail []byte
+	if err == nil {
+		thumbnail, err = makeThumbnail(generated.Data, s.config.Image.ThumbnailSize)
+	}
+
+	// the chapter may have been edited while the image was generated
+	record, loadErr := s.app.FindRecordById("story_chapters", chapterID)
+	if loadErr != nil {
+		logger.Info("Chapter %s was deleted while its image was generated", chapterID)
+		return
+	}
+	if record.GetString("image_prompt") != prompt {
+		logger.Info("Image prompt of chapter %s changed during generation, discarding the image", chapterID)
+		return
+	}
+
+	if err != nil {
+		logger.Warn("Image generation failed for chapter %s: %v", chapterID, err)
+		s.fail(record, err)
+		return
+	}
+
+	name := fmt.Sprintf("chapter-%d", record.GetInt("number"))
+	imageFile, err := filesystem.NewFileFromBytes(generated.Data, name+imageExtension(generated.ContentType))
+	if err != nil {
+		s.fail(record, err)
+		return
+	}
+	thumbFile, err := filesystem.NewFileFromBytes(thumbnail, name+"-thumb.jpg")
+	if err != nil {
+		s.fail(record, err)
+		return
+	}
+
+	record.Set("image", imageFile)
+	record.Set("image_thumb", thumbFile)
+	record.Set("image_status", ImageStatusSucceeded)
+	record.Set("image_error", "")
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to save image for chapter "+chapterID, err)
+		s.fail(record, err)
+		return
+	}
+
+	logger.Info("Image for chapter %s succeeded", chapterID)
+}
+
+// fail records why a chapter's image could not be generated
+func (s *ImageService) fail(record *core.Record, cause error) {
+	message := truncateRunes(cause.Error(), 2000)
+
+	fresh, err := s.app.FindRecordById("story_chapters", record.Id)
+	if err != nil {
+		return
+	}
+	fresh.Set("image_status", ImageStatusFailed)
+	fresh.Set("image_error", message)
+	if err := s.app.Save(fresh); err != nil {
+		logger.Error("Failed to save image failure for chapter "+record.Id, err)
+	}
+}
+
+// markStoryPending marks the chapters of an approved story that have no
+// image yet pending, so that they are queued once the approval is committed
+func (s *ImageService) markStoryPending(app core.App, storyID string) {
+	chapters, err := app.FindRecordsByFilter(
+		"story_chapters",
+		"story = {:story} && image_prompt != '' && image_status != {:succeeded}",
+		"number",
+		0,
+		0,
+		dbx.Params{"story": storyID, "succeeded": ImageStatusSucceeded},
+	)
+	if err != nil {
+		logger.Error("Failed to load chapters of approved story "+storyID, err)
+		return
+	}
+
+	for _, chapter := range chapters {
+		markImagePending(chapter)
+		if err := app.Save(chapter); err != nil {
+			logger.Error("Failed to queue image of chapter "+chapter.Id, err)
+		}
+	}
+	if len(chapters) > 0 {
+		logger.Info("Queued %d images of approved story %s", len(chapters), storyID)
+	}
+}
+
+// chapterStoryVisible reports whether a chapter's story may be shown, and so
+// illustrated: it was not held back by moderation
+func chapterStoryVisible(app core.App, chapter *core.Record) bool {
+	story, err := app.FindRecordById("stories", chapter.GetString("story"))
+	return err == nil && storyVisible(story)
+}
+
+// markImagePending resets a chapter's image status so that a new image is generated
+func markImagePending(record *core.Record) {
+	record.Set("image_status", ImageStatusPending)
+	record.Set("image_error", "")
+}
+
+// makeThumbnail scales an image to fit a size x size box and encodes it as JPEG
+func makeThumbnail(data []byte, size int) ([]byte, error) {
+	if size < 1 {
+		size = 320
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unreadable image: %w", err)
+	}
+
+	// JPEG has no alpha channel, so flatten transparent images onto white
+	thumb := imaging.Fit(img, size, size, imaging.Lanczos)
+	flat := imaging.New(thumb.Bounds().Dx(), thumb.Bounds().Dy(), image.White)
+	flat = imaging.Overlay(flat, thumb, image.Point{}, 1)
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, flat, imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// imageExtension returns the file extension for an image content type
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ".png"
+	}
+}
+
+// chapterImageURLs returns the file URLs of a chapter's image and thumbnail
+func chapterImageURLs(record *core.Record) (string, string) {
+	var imageURL, thumbURL string
+	if name := record.GetString("image"); name != "" {
+		imageURL = "/api/files/" + record.BaseFilesPath() + "/" + name
+	}
+	if name := record.GetString("image_thumb"); name != "" {
+		thumbURL = "/api/files/" + record.BaseFilesPath() + "/" + name
+	}
+	return imageURL, thumbURL
+}
+
+// chapterImageMap converts a chapter's image state to its API representation
+func chapterImageMap(record *core.Record) map[string]interface{} {
+	imageURL, thumbURL := chapterImageURLs(record)
+
+	return map[string]interface{}{
+		"chapter_id":    record.Id,
+		"number":        record.GetInt("number"),
+		"status":        record.GetString("image_status"),
+		"attempts":      record.GetInt("image_attempts"),
+		"error":         record.GetString("image_error"),
+		"image_url":     imageURL,
+		"thumbnail_url": thumbURL,
+		"updated":       record.GetDateTime("updated"),
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"pocket-app/pkg/logger"
 
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 )
 
 // Manager manages all services
@@ -13,9 +14,20 @@ type Manager struct {
 	config *config.Config
 	
 	// Add your services here
-	User   *UserService
-	Post   *PostService
-	Auth   *AuthService
+	User          *UserService
+	Post          *PostService
+	Auth          *AuthService
+	Story         *StoryService
+	StoryJob      *StoryJobService
+	Quota         *QuotaService
+	Idempotency   *IdempotencyService
+	Image         *ImageService
+	Character     *CharacterService
+	Template      *TemplateService
+	Moderation    *ModerationService
+	Workflow      *WorkflowService
+	GenerationLog *GenerationLogService
+	Share         *ShareService
 }
 
 // New creates a new services manager
@@ -34,6 +46,58 @@ func (m *Manager) Init() error {
 	m.User = NewUserService(m.app, m.config)
 	m.Post = NewPostService(m.app, m.config)
 	m.Auth = NewAuthService(m.app, m.config)
+	generator, err := NewStoryGenerator(m.config)
+	if err != nil {
+		return err
+	}
+	logger.Info("Story generator: %s", generator.Name())
+
+	m.GenerationLog = NewGenerationLogService(m.app, m.config)
+	var moderator Moderator
+	if m.config.Moderation.Enabled {
+		moderator, err = NewModerator(m.config, m.GenerationLog)
+		if err != nil {
+			return err
+		}
+		logger.Info("Content moderation: %s", moderator.Name())
+	}
+	m.Moderation = NewModerationService(m.app, m.config, moderator)
+
+	m.Story = NewStoryService(m.app, m.config, generator, m.Moderation, m.GenerationLog)
+	m.Share = NewShareService(m.app, m.config, m.Story)
+	m.Quota = NewQuotaService(m.app, m.config)
+	m.StoryJob = NewStoryJobService(m.app, m.config, m.Story, m.Quota)
+	m.Idempotency = NewIdempotencyService(m.app, m.config)
+	m.Character = NewCharacterService(m.app, m.config)
+	m.Template = NewTemplateService(m.app, m.config)
+	m.Template.RegisterHooks()
+	imageGenerator, err := NewImageGenerator(m.config, m.GenerationLog)
+	if err != nil {
+		return err
+	}
+	m.Image = NewImageService(m.app, m.config, m.Story, imageGenerator)
+	m.Image.RegisterHooks()
+	workflows, err := LoadWorkflowRegistry(m.config)
+	if err != nil {
+		return err
+	}
+	logger.Info("Workflows registered: %d", len(workflows.List()))
+	m.Workflow = NewWorkflowService(m.app, m.config, workflows, m.GenerationLog)
+
+	m.app.Cron().MustAdd("idempotencyKeysPrune", "0 * * * *", m.Idempotency.Prune)
+	m.app.Cron().MustAdd("generationLogsPrune", "30 * * * *", m.GenerationLog.Prune)
+
+	// Background workers need a bootstrapped app, so start them on serve
+	m.app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		m.StoryJob.Start()
+		m.Image.Start()
+		return se.Next()
+	})
+	m.app.OnTerminate().BindFunc(func(te *core.TerminateEvent) error {
+		m.StoryJob.Stop()
+		m.Image.Stop()
+		return te.Next()
+	})
 	
 	logger.Info("Services initialized successfully")
 	return nil
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Moderation actions taken on a decision; a story's moderation_status is
+// one of the last three
+const (
+	ModerationAllowed     = "allowed"
+	ModerationRejected    = "rejected"
+	ModerationQuarantined = "quarantined"
+	ModerationApproved    = "approved"
+)
+
+// ErrModerationUnavailable is returned when a request could not be moderated;
+// requests are not let through unmoderated
+var ErrModerationUnavailable = errors.New("content moderation is unavailable")
+
+// FlaggedContentError is returned when moderation rejects a request or a
+// generated chapter
+type FlaggedContentError struct {
+	Stage   string
+	Verdict ModerationVerdict
+}
+
+func (e *FlaggedContentError) Error() string {
+	return fmt.Sprintf("%s flagged by content moderation: %s", e.Stage, strings.Join(e.Verdict.Reasons, "; "))
+}
+
+// ModerationDecision is a moderation outcome to be recorded
+type ModerationDecision struct {
+	Stage    string
+	Action   string
+	OwnerID  string
+	StoryID  string
+	Verdict  ModerationVerdict
+	Content  string
+	Err      error
+	Reviewer string
+	Note     string
+}
+
+// Flagged reports whether the content must be held back: it was flagged, or
+// it could not be moderated
+func (d *ModerationDecision) Flagged() bool {
+	return d.Verdict.Flagged || d.Err != nil
+}
+
+// ModerationService screens story requests before generation and generated
+// stories before they are shown, and records every decision in the
+// moderation_decisions collection
+type ModerationService struct {
+	app       *pocketbase.PocketBase
+	config    *config.Config
+	moderator Moderator
+}
+
+// NewModerationService creates a new moderation service; a nil moderator
+// disables moderation
+func NewModerationService(app *pocketbase.PocketBase, cfg *config.Config, moderator Moderator) *ModerationService {
+	return &ModerationService{
+		app:       app,
+		config:    cfg,
+		moderator: moderator,
+	}
+}
+
+// Enabled reports whether content is moderated
+func (s *ModerationService) Enabled() bool {
+	return s.moderator != nil
+}
+
+// CheckRequest moderates the texts of a request before anything is
+// generated. It returns a *FlaggedContentError when the request is flagged
+// and ErrModerationUnavailable when the moderator failed.
+func (s *ModerationService) CheckRequest(ctx context.Context, ownerID string, texts ...string) error {
+	return s.checkInput(ctx, ownerID, "", texts)
+}
+
+// CheckEdit moderates the texts of a manual edit to one of the owner's
+// stories before it is saved, with the same outcomes as CheckRequest
+func (s *ModerationService) CheckEdit(ctx context.Context, ownerID, storyID string, texts ...string) error {
+	return s.checkInput(ctx, ownerID, storyID, texts)
+}
+
+// checkInput moderates and records texts written by the owner
+func (s *ModerationService) checkInput(ctx context.Context, ownerID, storyID string, texts []string) error {
+	content := joinModerationTexts(texts)
+	if !s.Enabled() || content == "" {
+		return nil
+	}
+
+	decision := s.moderate(WithGenerationCaller(ctx, ownerID, GenerationOpModeration), ModerationStageInput, content)
+	decision.OwnerID = ownerID
+	decision.StoryID = storyID
+	decision.Action = ModerationAllowed
+	if decision.Flagged() {
+		decision.Action = ModerationRejected
+	}
+	s.Record(decision)
+
+	if decision.Err != nil {
+		return fmt.Errorf("%w: %v", ErrModerationUnavailable, decision.Err)
+	}
+	if decision.Verdict.Flagged {
+		return &FlaggedContentError{Stage: ModerationStageInput, Verdict: decision.Verdict}
+	}
+	return nil
+}
+
+// CheckStoryRequest moderates the instructions and characters of a story request
+func (s *ModerationService) CheckStoryRequest(ctx context.Context, ownerID string, req StoryRequest) error {
+	return s.CheckRequest(ctx, ownerID, req.StoryInstructions, req.PrimaryCharacters, req.SecondaryCharacters)
+}
+
+// ModerateStory moderates a story generated for the owner. The caller sets
+// the story and action of the returned decision and records it. It returns
+// nil when moderation is disabled.
+func (s *ModerationService) ModerateStory(ctx context.Context, ownerID string, story *Story) *ModerationDecision {
+	if !s.Enabled() {
+		return nil
+	}
+	decision := s.moderate(WithGenerationCaller(ctx, ownerID, GenerationOpModeration), ModerationStageOutput, storyModerationText(story))
+	decision.OwnerID = ownerID
+	return decision
+}
+
+// GateStream wraps a story event sink so that each title, summary and
+// chapter is moderated before it is sent. Once one is flagged, or cannot be
+// moderated, its decision is recorded for the owner and nothing more of the
+// story is sent; the complete story is moderated and recorded when it is
+// saved.
+func (s *ModerationService) GateStream(ctx context.Context, ownerID string, emit func(StoryEvent) error) func(StoryEvent) error {
+	if !s.Enabled() {
+		return emit
+	}
+
+	ctx = WithGenerationCaller(ctx, ownerID, GenerationOpModeration)
+	held := false
+	return func(event StoryEvent) error {
+		if held {
+			return nil
+		}
+
+		var text string
+		switch data := event.Data.(type) {
+		case StoryMeta:
+			text = joinModerationTexts([]string{data.Title, data.Summary})
+		case StoryChapter:
+			text = joinModerationTexts([]string{data.Title, data.Content, data.ImagePrompt})
+		}
+		if text != "" {
+			decision := s.moderate(ctx, ModerationStageOutput, text)
+			if decision.Flagged() {
+				logger.Warn("Holding back the rest of a streamed story after moderation")
+				decision.OwnerID = ownerID
+				decision.Action = ModerationQuarantined
+				s.Record(decision)
+				held = true
+				return nil
+			}
+		}
+		return emit(event)
+	}
+}
+
+// Record stores a moderation decision
+func (s *ModerationService) Record(decision *ModerationDecision) {
+	collection, err := s.app.FindCollectionByNameOrId("moderation_decisions")
+	if err != nil {
+		logger.Error("Failed to record moderation decision", err)
+		return
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("owner", decision.OwnerID)
+	record.Set("story", decision.StoryID)
+	record.Set("stage", decision.Stage)
+	record.Set("action", decision.Action)
+	record.Set("flagged", decision.Verdict.Flagged)
+	record.Set("categories", decision.Verdict.Categories)
+	record.Set("reasons", decision.Verdict.Reasons)
+	record.Set("content", truncateRunes(decision.Content, 200000))
+	record.Set("reviewer", decision.Reviewer)
+	record.Set("note", truncateRunes(decision.Note, 2000))
+	if s.moderator != nil {
+		record.Set("moderator", s.moderator.Name())
+	}
+	if decision.Err != nil {
+		record.Set("error", truncateRunes(decision.Err.Error(), 2000))
+	}
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to record moderation decision", err)
+		return
+	}
+
+	if decision.Flagged() {
+		logger.Warn("Moderation %s %s: %s", decision.Stage, decision.Action, strings.Join(decision.Verdict.Reasons, "; "))
+	}
+}
+
+// StoryDecisions lists the moderation decisions recorded for a story, oldest first
+func (s *ModerationService) StoryDecisions(storyID string) ([]map[string]interface{}, error) {
+	records, err := s.app.FindRecordsByFilter(
+		"moderation_decisions",
+		"story = {:story}",
+		"created",
+		0,
+		0,
+		dbx.Params{"story": storyID},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		decisions[i] = moderationDecisionMap(record)
+	}
+	return decisions, nil
+}
+
+// moderate runs text through the moderator
+func (s *ModerationService) moderate(ctx context.Context, stage, content string) *ModerationDecision {
+	decision := &ModerationDecision{Stage: stage, Content: content}
+
+	verdict, err := s.moderator.Moderate(ctx, stage, content)
+	if err != nil {
+		logger.Warn("Content moderation failed: %v", err)
+		decision.Err = err
+		decision.Verdict.Reasons = []string{"content could not be moderated"}
+		return decision
+	}
+	decision.Verdict = *verdict
+	return decision
+}
+
+// Withhold removes the story from a result whose story is held for review,
+// so that the content is not shown before a reviewer approves it
+func (r *GenerationResult) Withhold() {
+	r.StatusCode = http.StatusAccepted
+	r.Status = ModerationQuarantined
+	r.Message = "The story is being held for review by content moderation"
+	r.Story = nil
+	r.StoryText = ""
+	r.Data = nil
+	r.RawResponse = ""
+}
+
+// storyModerationText joins the title, summary, chapters and themes of a story
+func storyModerationText(story *Story) string {
+	texts := []string{story.Title, story.Summary}
+	for _, chapter := range story.Chapters {
+		texts = append(texts, chapter.Title, chapter.Content, chapter.ImagePrompt)
+	}
+	texts = append(texts, story.ThemesOrLessons...)
+	return joinModerationTexts(texts)
+}
+
+// joinModerationTexts joins the non-empty texts with blank lines
+func joinModerationTexts(texts []string) string {
+	parts := make([]string, 0, len(texts))
+	for _, text := range texts {
+		if text = strings.TrimSpace(text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// truncateRunes shortens text to at most max runes
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max])
+}
+
+// moderationDecisionMap converts a decision record to its API representation
+func moderationDecisionMap(record *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         record.Id,
+		"stage":      record.GetString("stage"),
+		"action":     record.GetString("action"),
+		"moderator":  record.GetString("moderator"),
+		"flagged":    record.GetBool("flagged"),
+		"categories": record.Get("categories"),
+		"reasons":    record.Get("reasons"),
+		"error":      record.GetString("error"),
+		"reviewer":   record.GetString("reviewer"),
+		"note":       record.GetString("note"),
+		"created":    record.GetDateTime("created"),
+	}
+}
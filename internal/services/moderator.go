@@ -0,0 +1,419 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/retry"
+)
+
+// Moderation backend names, selected with MODERATION_BACKEND
+const (
+	ModeratorRules    = "rules"
+	ModeratorWorkflow = "workflow"
+)
+
+// Moderation stages
+const (
+	ModerationStageInput  = "input"
+	ModerationStageOutput = "output"
+	ModerationStageReview = "review"
+)
+
+// ModerationVerdict is a moderator's judgement of a piece of text.
+// Categories holds a score between 0 and 1 for each category the text
+// touches; Reasons explains a flagged verdict.
+type ModerationVerdict struct {
+	Flagged    bool               `json:"flagged"`
+	Categories map[string]float64 `json:"categories,omitempty"`
+	Reasons    []string           `json:"reasons,omitempty"`
+}
+
+// Moderator judges whether text is suitable for the app's young audience
+type Moderator interface {
+	// Name returns the backend name
+	Name() string
+
+	// Moderate judges text at a stage: input for story requests, output for
+	// generated stories
+	Moderate(ctx context.Context, stage, text string) (*ModerationVerdict, error)
+}
+
+// NewModerator creates the moderator selected in the configuration
+func NewModerator(cfg *config.Config, logs *GenerationLogService) (Moderator, error) {
+	switch cfg.Moderation.Backend {
+	case ModeratorRules:
+		return NewRuleModerator(cfg)
+	case ModeratorWorkflow:
+		return NewWorkflowModerator(cfg, logs), nil
+	default:
+		return nil, fmt.Errorf("unknown moderation backend %q", cfg.Moderation.Backend)
+	}
+}
+
+// Term weights of the built-in blocklists: a severe term flags text on its
+// own, a mild one only together with two other terms of its category
+const (
+	moderationSevere = 1.0
+	moderationMild   = 0.2
+)
+
+// blocklistCategory is the category of terms configured without one
+const blocklistCategory = "blocklist"
+
+// defaultModerationTerms are the built-in blocklists by category. A trailing
+// * matches any word ending, so "murder*" matches "murders" and "murderer";
+// words that start harmless ones or phrases ("gun" in "Gunther", "stab" in
+// "stable", "killer whale", "blood-red", "shooting star") are listed in full
+// instead.
+var defaultModerationTerms = map[string]map[string]float64{
+	"violence": {
+		"murder*": moderationSevere, "tortur*": moderationSevere, "behead*": moderationSevere,
+		"decapitat*": moderationSevere, "massacre*": moderationSevere, "gore": moderationSevere,
+		"bloodbath": moderationSevere, "dismember*": moderationSevere,
+		"kill": moderationMild, "kills": moderationMild, "killed": moderationMild, "killing": moderationMild,
+		"killings": moderationMild, "bloody": moderationMild, "bloodied": moderationMild,
+		"bloodshed": moderationMild, "bleeding": moderationMild, "corpse*": moderationMild,
+		"stab": moderationMild, "stabs": moderationMild, "stabbed": moderationMild, "stabbing": moderationMild,
+		"shoot": moderationMild, "shootout*": moderationMild,
+		"gun": moderationMild, "guns": moderationMild, "gunfire": moderationMild, "gunman": moderationMild,
+		"gunmen": moderationMild, "gunpoint": moderationMild, "gunshot*": moderationMild,
+	},
+	"sexual": {
+		"sex": moderationSevere, "sexual*": moderationSevere, "sexy": moderationSevere,
+		"porn*": moderationSevere, "nude*": moderationSevere, "erotic*": moderationSevere,
+		"orgasm*": moderationSevere, "intercourse": moderationSevere,
+		"naked": moderationMild, "undress*": moderationMild,
+	},
+	"self_harm": {
+		"suicid*": moderationSevere, "self harm*": moderationSevere, "kill myself": moderationSevere,
+		"kill himself": moderationSevere, "kill herself": moderationSevere, "kill themselves": moderationSevere,
+		"cut myself": moderationSevere, "hang himself": moderationSevere, "hang herself": moderationSevere,
+	},
+	"hate": {
+		"genocide*": moderationSevere, "ethnic cleansing": moderationSevere, "master race": moderationSevere,
+		"white power": moderationSevere, "nazi*": moderationMild, "racist*": moderationMild,
+	},
+	"drugs": {
+		"cocaine": moderationSevere, "heroin": moderationSevere, "meth": moderationSevere,
+		"methamphetamine": moderationSevere, "overdos*": moderationSevere,
+		"drunk*": moderationMild, "alcohol*": moderationMild, "cigarette*": moderationMild,
+		"marijuana": moderationMild, "vape*": moderationMild,
+	},
+	"profanity": {
+		"fuck*": moderationSevere, "motherfuck*": moderationSevere, "shit*": moderationSevere,
+		"bitch*": moderationSevere, "cunt*": moderationSevere,
+		"damn*": moderationMild, "bastard*": moderationMild, "crap*": moderationMild,
+		"hell": moderationMild,
+	},
+}
+
+// moderationTerm is a blocklist entry split into words; the last word
+// matches as a prefix when the entry ended with *
+type moderationTerm struct {
+	text     string
+	category string
+	weight   float64
+	words    []string
+	prefix   bool
+}
+
+// RuleModerator scores text against blocklists by category. Each term found
+// adds its weight to its category once, however often it occurs, so that a
+// long story is not flagged for repeating a harmless phrase; text is flagged
+// when a category reaches the threshold (MODERATION_THRESHOLD). Terms from
+// MODERATION_BLOCKLIST and MODERATION_BLOCKLIST_FILE are always severe.
+type RuleModerator struct {
+	threshold float64
+	terms     []moderationTerm
+}
+
+// NewRuleModerator creates a rule moderator from the built-in blocklists and
+// the configured extra terms
+func NewRuleModerator(cfg *config.Config) (*RuleModerator, error) {
+	m := &RuleModerator{threshold: cfg.Moderation.Threshold}
+	if m.threshold <= 0 {
+		m.threshold = 0.5
+	}
+
+	for category, terms := range defaultModerationTerms {
+		for term, weight := range terms {
+			m.addTerm(category, term, weight)
+		}
+	}
+	for _, term := range cfg.Moderation.Blocklist {
+		m.addTerm(blocklistCategory, term, moderationSevere)
+	}
+	if cfg.Moderation.BlocklistFile != "" {
+		if err := m.loadBlocklist(cfg.Moderation.BlocklistFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// a stable order keeps reasons deterministic
+	sort.Slice(m.terms, func(i, j int) bool {
+		if m.terms[i].category != m.terms[j].category {
+			return m.terms[i].category < m.terms[j].category
+		}
+		return m.terms[i].text < m.terms[j].text
+	})
+
+	logger.Debug("Rule moderator loaded %d terms", len(m.terms))
+	return m, nil
+}
+
+// Name returns the backend name
+func (m *RuleModerator) Name() string {
+	return ModeratorRules
+}
+
+// Moderate scores the text by the distinct terms it contains in each
+// category and flags it when any category reaches the threshold
+func (m *RuleModerator) Moderate(ctx context.Context, stage, text string) (*ModerationVerdict, error) {
+	words := moderationWords(text)
+
+	scores := make(map[string]float64)
+	matched := make(map[string][]string)
+	for _, term := range m.terms {
+		matches := term.find(words)
+		if len(matches) == 0 {
+			continue
+		}
+		scores[term.category] += term.weight
+		matched[term.category] = append(matched[term.category], matches...)
+	}
+
+	verdict := &ModerationVerdict{Categories: make(map[string]float64, len(scores))}
+	categories := make([]string, 0, len(scores))
+	for category, score := range scores {
+		if score > 1 {
+			score = 1
+		}
+		verdict.Categories[category] = score
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		if verdict.Categories[category] < m.threshold {
+			continue
+		}
+		verdict.Flagged = true
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%s (score %.2f): %s",
+			category, verdict.Categories[category], strings.Join(uniqueStrings(matched[category]), ", ")))
+	}
+
+	return verdict, nil
+}
+
+// addTerm adds a blocklist entry; entries without any word are ignored
+func (m *RuleModerator) addTerm(category, term string, weight float64) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	prefix := strings.HasSuffix(term, "*")
+	words := moderationWords(strings.TrimSuffix(term, "*"))
+	if len(words) == 0 {
+		return
+	}
+
+	m.terms = append(m.terms, moderationTerm{
+		text:     term,
+		category: category,
+		weight:   weight,
+		words:    words,
+		prefix:   prefix,
+	})
+}
+
+// loadBlocklist reads one term per line; "category: term" files the term
+// under a category, and blank lines and lines starting with # are skipped
+func (m *RuleModerator) loadBlocklist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open moderation blocklist: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		category, term := blocklistCategory, line
+		if before, after, ok := strings.Cut(line, ":"); ok {
+			category, term = strings.ToLower(strings.TrimSpace(before)), after
+		}
+		m.addTerm(category, term, moderationSevere)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read moderation blocklist: %w", err)
+	}
+	return nil
+}
+
+// find returns each occurrence of the term in a list of words, as the words
+// that matched
+func (t moderationTerm) find(words []string) []string {
+	var matches []string
+	for i := 0; i+len(t.words) <= len(words); i++ {
+		if t.matchesAt(words, i) {
+			matches = append(matches, strings.Join(words[i:i+len(t.words)], " "))
+			i += len(t.words) - 1
+		}
+	}
+	return matches
+}
+
+func (t moderationTerm) matchesAt(words []string, i int) bool {
+	last := len(t.words) - 1
+	for j, word := range t.words {
+		if j == last && t.prefix {
+			if !strings.HasPrefix(words[i+j], word) {
+				return false
+			}
+		} else if words[i+j] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// moderationWords lowercases text and splits it into words of letters and digits
+func moderationWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// WorkflowModerator runs the content moderation Rivet graph
+// (RIVET_WORKFLOW_CONTENT_MODERATION) through its HTTP endpoint. The graph
+// receives {"stage", "text"} and answers with a verdict, either directly or
+// as the graph output. Every call is recorded in the generation log.
+type WorkflowModerator struct {
+	url    string
+	client *retry.Client
+	logs   *GenerationLogService
+}
+
+// NewWorkflowModerator creates a new workflow moderator; without
+// MODERATION_WORKFLOW_URL the graph is served next to the story graph
+func NewWorkflowModerator(cfg *config.Config, logs *GenerationLogService) *WorkflowModerator {
+	url := cfg.Moderation.WorkflowURL
+	if url == "" {
+		url = strings.TrimRight(cfg.Story.APIURL, "/") + "/" + cfg.Moderation.Workflow
+	}
+
+	policy := storyRetryPolicy(cfg)
+	policy.AttemptTimeout = cfg.Moderation.Timeout
+	policy.OverallTimeout = 0
+
+	return &WorkflowModerator{
+		url:    url,
+		client: retry.NewClient(policy),
+		logs:   logs,
+	}
+}
+
+// Name returns the backend name
+func (m *WorkflowModerator) Name() string {
+	return ModeratorWorkflow
+}
+
+// Moderate posts the text to the workflow, retrying on transport errors and
+// retryable statuses
+func (m *WorkflowModerator) Moderate(ctx context.Context, stage, text string) (*ModerationVerdict, error) {
+	request := map[string]string{"stage": stage, "text": text}
+	call := UpstreamCall{Operation: GenerationOpModeration, Generator: m.Name(), Request: request}
+	started := time.Now()
+
+	verdict, err := m.moderate(ctx, request, &call)
+	call.Err = err
+	call.Latency = time.Since(started)
+	m.logs.RecordUpstream(ctx, call)
+
+	return verdict, err
+}
+
+// moderate makes the moderation request and notes its status, attempts and
+// response on the call
+func (m *WorkflowModerator) moderate(ctx context.Context, request map[string]string, call *UpstreamCall) (*ModerationVerdict, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	resp, attempts, err := m.client.Do(ctx, http.MethodPost, m.url, body, header)
+	call.Attempts = attempts
+	if err != nil {
+		var statusErr *retry.StatusError
+		if errors.As(err, &statusErr) {
+			call.Status = statusErr.Response.StatusCode
+			call.Response = string(statusErr.Response.Body)
+			return nil, fmt.Errorf("moderation workflow returned status %d", statusErr.Response.StatusCode)
+		}
+		return nil, fmt.Errorf("moderation workflow request failed after %d attempts: %w", attempts, err)
+	}
+	call.Status = resp.StatusCode
+	call.Response = string(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("moderation workflow returned status %d", resp.StatusCode)
+	}
+
+	verdict, err := decodeWorkflowVerdict(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid moderation workflow response: %w", err)
+	}
+	if verdict.Flagged && len(verdict.Reasons) == 0 {
+		verdict.Reasons = []string{"flagged by the moderation workflow"}
+	}
+	return verdict, nil
+}
+
+// decodeWorkflowVerdict reads a verdict from a workflow response: the
+// verdict itself, or a Rivet response whose output holds the verdict as an
+// object or as JSON text
+func decodeWorkflowVerdict(body []byte) (*ModerationVerdict, error) {
+	var response struct {
+		Flagged *bool `json:"flagged"`
+		Output  *struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	data := body
+	if response.Flagged == nil && response.Output != nil {
+		data = response.Output.Value
+		if response.Output.Type == "string" {
+			var text string
+			if err := json.Unmarshal(data, &text); err != nil {
+				return nil, err
+			}
+			data = []byte(text)
+		}
+	}
+
+	var verdict ModerationVerdict
+	if err := json.Unmarshal(data, &verdict); err != nil {
+		return nil, err
+	}
+	return &verdict, nil
+}
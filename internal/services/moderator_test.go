@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pocket-app/internal/config"
+)
+
+func TestRuleModerator(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantFlagged  bool
+		wantCategory string // a category the text must score in
+	}{
+		{
+			name: "fairy tale",
+			text: `Once upon a time a girl named Mira saw a shooting star above the stable.
+				She wished on it, and the next night another shooting star fell into the
+				woods. Her friend Gunther, a woodcutter with a blood-red scarf, walked with
+				her past the bamboo shoots to find it, and they carried it home before the
+				wolves could howl.`,
+		},
+		{
+			name: "harmless phrases with violent words",
+			text: "From the boat they watched a killer whale leap against a blood-red sunset, and later a shooting star.",
+		},
+		{
+			name:         "violent words in full",
+			text:         "The soldiers killed the prisoners, and the bloodshed left bleeding men in the road.",
+			wantFlagged:  true,
+			wantCategory: "violence",
+		},
+		{
+			name: "mild term repeated throughout a long story",
+			text: strings.Repeat("The bloodhound followed the trail through the forest all day. ", 200),
+		},
+		{
+			name: "no terms",
+			text: "A little fox learned to share her berries with the crow.",
+		},
+		{
+			name:         "severe term",
+			text:         "The giant wanted to murder everyone in the village.",
+			wantFlagged:  true,
+			wantCategory: "violence",
+		},
+		{
+			name:         "several mild terms of a category",
+			text:         "He stabbed the guard, there was blood everywhere, and he shot a gun at the corpse.",
+			wantFlagged:  true,
+			wantCategory: "violence",
+		},
+		{
+			name:         "severe phrase",
+			text:         "The prince said he would kill himself if she left.",
+			wantFlagged:  true,
+			wantCategory: "self_harm",
+		},
+		{
+			name:         "configured term",
+			text:         "The witch brewed a pot of grumbleweed.",
+			wantFlagged:  true,
+			wantCategory: blocklistCategory,
+		},
+	}
+
+	moderator, err := NewRuleModerator(&config.Config{
+		Moderation: config.ModerationConfig{Threshold: 0.5, Blocklist: []string{"grumbleweed"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := moderator.Moderate(context.Background(), ModerationStageOutput, tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict.Flagged != tt.wantFlagged {
+				t.Errorf("Flagged = %v, want %v (categories %v, reasons %v)", verdict.Flagged, tt.wantFlagged, verdict.Categories, verdict.Reasons)
+			}
+			if tt.wantCategory != "" && verdict.Categories[tt.wantCategory] == 0 {
+				t.Errorf("categories = %v, want a %s score", verdict.Categories, tt.wantCategory)
+			}
+			if verdict.Flagged && len(verdict.Reasons) == 0 {
+				t.Error("flagged without reasons")
+			}
+		})
+	}
+}
+
+func TestRuleModeratorBlocklistFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	blocklist := "# extra terms\n\nspells: dark magic*\nmoonshine\n"
+	if err := os.WriteFile(path, []byte(blocklist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	moderator, err := NewRuleModerator(&config.Config{Moderation: config.ModerationConfig{BlocklistFile: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text     string
+		category string
+	}{
+		{text: "The wizard practised dark magical arts.", category: "spells"},
+		{text: "The farmer made moonshine.", category: blocklistCategory},
+	}
+	for _, tt := range tests {
+		verdict, err := moderator.Moderate(context.Background(), ModerationStageInput, tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verdict.Flagged || verdict.Categories[tt.category] != 1 {
+			t.Errorf("Moderate(%q) = %+v, want flagged in %s", tt.text, verdict, tt.category)
+		}
+	}
+
+	if _, err := NewRuleModerator(&config.Config{Moderation: config.ModerationConfig{BlocklistFile: path + ".missing"}}); err == nil {
+		t.Error("NewRuleModerator() accepted a missing blocklist file")
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Quota periods and units
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+	QuotaUnitStories   = "stories"
+	QuotaUnitChapters  = "chapters"
+)
+
+// QuotaStatus is a user's quota usage in the current period
+type QuotaStatus struct {
+	Period    string    `json:"period"`
+	Unit      string    `json:"unit"`
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	Unlimited bool      `json:"unlimited"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// QuotaExceededError is returned when a request does not fit in the remaining quota
+type QuotaExceededError struct {
+	Status *QuotaStatus
+}
+
+func (e *QuotaExceededError) Error() string {
+	return "story generation quota exceeded"
+}
+
+// QuotaReservation is the usage charged for a single generation request
+type QuotaReservation struct {
+	OwnerID  string
+	Stories  int
+	Chapters int
+	At       time.Time
+}
+
+// QuotaService tracks story generation usage per user in the story_usage collection
+type QuotaService struct {
+	app    *pocketbase.PocketBase
+	config *config.Config
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(app *pocketbase.PocketBase, cfg *config.Config) *QuotaService {
+	return &QuotaService{
+		app:    app,
+		config: cfg,
+	}
+}
+
+// Reservation returns the usage a request charges when made at the given time
+func (s *QuotaService) Reservation(ownerID string, req StoryRequest, at time.Time) QuotaReservation {
+	return QuotaReservation{
+		OwnerID:  ownerID,
+		Stories:  1,
+		Chapters: req.NChapters,
+		At:       at,
+	}
+}
+
+// Status returns the user's usage in the current period
+func (s *QuotaService) Status(ownerID string) (*QuotaStatus, error) {
+	now := time.Now().UTC()
+
+	record, err := s.findUsage(s.app, ownerID, s.periodKey(now))
+	if err != nil {
+		return nil, err
+	}
+	return s.status(record, now), nil
+}
+
+// Reserve charges a request to the user's usage. It returns a
+// *QuotaExceededError, and charges nothing, when the request does not fit in
+// the remaining quota.
+func (s *QuotaService) Reserve(ownerID string, req StoryRequest) (*QuotaReservation, error) {
+	return s.reserve(s.Reservation(ownerID, req, time.Now().UTC()))
+}
+
+// ReserveChapters charges chapters generated for an existing story, such as a
+// regenerated chapter, to the user's usage. They count towards the quota
+// only when its unit is chapters; no story is charged.
+func (s *QuotaService) ReserveChapters(ownerID string, chapters int) (*QuotaReservation, error) {
+	return s.reserve(QuotaReservation{
+		OwnerID:  ownerID,
+		Chapters: chapters,
+		At:       time.Now().UTC(),
+	})
+}
+
+// reserve charges a reservation unless it does not fit in the remaining quota
+func (s *QuotaService) reserve(reservation QuotaReservation) (*QuotaReservation, error) {
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := s.findUsage(txApp, reservation.OwnerID, s.periodKey(reservation.At))
+		if err != nil {
+			return err
+		}
+
+		status := s.status(record, reservation.At)
+		if !status.Unlimited && s.units(reservation) > status.Remaining {
+			return &QuotaExceededError{Status: status}
+		}
+
+		record.Set("stories", record.GetInt("stories")+reservation.Stories)
+		record.Set("chapters", record.GetInt("chapters")+reservation.Chapters)
+		return txApp.Save(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// Release gives back the usage of a request that did not produce a story
+func (s *QuotaService) Release(reservation QuotaReservation) {
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := s.findUsage(txApp, reservation.OwnerID, s.periodKey(reservation.At))
+		if err != nil {
+			return err
+		}
+		if record.IsNew() {
+			return nil
+		}
+
+		record.Set("stories", max(0, record.GetInt("stories")-reservation.Stories))
+		record.Set("chapters", max(0, record.GetInt("chapters")-reservation.Chapters))
+		return txApp.Save(record)
+	})
+	if err != nil {
+		logger.Error("Failed to release story quota", err)
+	}
+}
+
+// findUsage returns the usage record of a user and period, or a new unsaved one
+func (s *QuotaService) findUsage(app core.App, ownerID, period string) (*core.Record, error) {
+	record, err := app.FindFirstRecordByFilter(
+		"story_usage",
+		"owner = {:owner} && period = {:period}",
+		dbx.Params{"owner": ownerID, "period": period},
+	)
+	if err == nil {
+		return record, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	collection, err := app.FindCollectionByNameOrId("story_usage")
+	if err != nil {
+		return nil, err
+	}
+	record = core.NewRecord(collection)
+	record.Set("owner", ownerID)
+	record.Set("period", period)
+	return record, nil
+}
+
+// status builds the quota status from a usage record
+func (s *QuotaService) status(record *core.Record, now time.Time) *QuotaStatus {
+	used := record.GetInt("stories")
+	if s.unit() == QuotaUnitChapters {
+		used = record.GetInt("chapters")
+	}
+
+	status := &QuotaStatus{
+		Period:    s.period(),
+		Unit:      s.unit(),
+		Limit:     s.config.Quota.Limit,
+		Used:      used,
+		Unlimited: s.config.Quota.Limit <= 0,
+		ResetAt:   s.periodEnd(now),
+	}
+	if !status.Unlimited {
+		status.Remaining = max(0, status.Limit-used)
+	}
+	return status
+}
+
+// units returns what a reservation costs in the configured unit
+func (s *QuotaService) units(reservation QuotaReservation) int {
+	if s.unit() == QuotaUnitChapters {
+		return reservation.Chapters
+	}
+	return reservation.Stories
+}
+
+func (s *QuotaService) period() string {
+	if s.config.Quota.Period == QuotaPeriodMonthly {
+		return QuotaPeriodMonthly
+	}
+	return QuotaPeriodDaily
+}
+
+func (s *QuotaService) unit() string {
+	if s.config.Quota.Unit == QuotaUnitChapters {
+		return QuotaUnitChapters
+	}
+	return QuotaUnitStories
+}
+
+// periodKey identifies the quota period containing t, e.g. 2025-07-05 or 2025-07
+func (s *QuotaService) periodKey(t time.Time) string {
+	if s.period() == QuotaPeriodMonthly {
+		return t.UTC().Format("2006-01")
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// periodEnd returns the start of the period after the one containing t
+func (s *QuotaService) periodEnd(t time.Time) time.Time {
+	t = t.UTC()
+	if s.period() == QuotaPeriodMonthly {
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
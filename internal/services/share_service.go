@@ -0,0 +1,387 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/ratelimit"
+	"pocket-app/pkg/validator"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Share link permissions; download also allows viewing
+const (
+	SharePermissionView     = "view"
+	SharePermissionDownload = "download"
+)
+
+// Share link statuses, derived from the expiry and revocation
+const (
+	ShareStatusActive  = "active"
+	ShareStatusExpired = "expired"
+	ShareStatusRevoked = "revoked"
+)
+
+// SharePermissions are the permissions a share link can be created with
+var SharePermissions = []string{SharePermissionView, SharePermissionDownload}
+
+// SharePasswordWindow is the window in which wrong share link passwords are limited
+const SharePasswordWindow = 15 * time.Minute
+
+const (
+	shareTokenLength       = 40
+	minSharePasswordLength = 8
+	maxSharePasswordBytes  = 72 // bcrypt ignores anything longer
+)
+
+var (
+	// ErrShareNotFound is returned when a share link does not exist, is not
+	// owned by the caller, or its story can no longer be shown
+	ErrShareNotFound = errors.New("share link not found")
+
+	// ErrShareUnavailable is returned when a share link expired or was revoked
+	ErrShareUnavailable = errors.New("share link has expired or was revoked")
+
+	// ErrSharePasswordRequired is returned when a protected share link is opened without a password
+	ErrSharePasswordRequired = errors.New("share link requires a password")
+
+	// ErrSharePasswordInvalid is returned when a share link is opened with a wrong password
+	ErrSharePasswordInvalid = errors.New("wrong share link password")
+
+	// ErrSharePasswordAttempts is returned when a client sent too many wrong passwords for a share link
+	ErrSharePasswordAttempts = errors.New("too many wrong share link passwords")
+
+	// ErrShareDownloadForbidden is returned when a view-only share link is used to download
+	ErrShareDownloadForbidden = errors.New("share link does not allow downloads")
+)
+
+// ShareOptions are the settings of a new share link
+type ShareOptions struct {
+	Permission string
+	// ExpiresAt is when the link stops working; zero never expires it
+	ExpiresAt time.Time
+	// Password protects the link when set; only its hash is stored
+	Password string
+}
+
+// ShareService manages public, read-only share links to stories in the
+// story_shares collection. Only a hash of each link's token is stored, so a
+// link can be shown once, when it is created.
+type ShareService struct {
+	app          *pocketbase.PocketBase
+	config       *config.Config
+	story        *StoryService
+	attempts     *ratelimit.Limiter
+	linkAttempts *ratelimit.Limiter
+}
+
+// NewShareService creates a new share service
+func NewShareService(app *pocketbase.PocketBase, cfg *config.Config, story *StoryService) *ShareService {
+	return &ShareService{
+		app:          app,
+		config:       cfg,
+		story:        story,
+		attempts:     ratelimit.New(cfg.Shares.PasswordAttempts, SharePasswordWindow),
+		linkAttempts: ratelimit.New(cfg.Shares.LinkPasswordAttempts, SharePasswordWindow),
+	}
+}
+
+// ValidateOptions checks the permission, expiry and password of a new share
+// link. With SHARE_MAX_EXPIRY set, every link must expire within it.
+func (s *ShareService) ValidateOptions(opts ShareOptions) validator.ValidationErrors {
+	v := validator.New()
+	now := time.Now()
+
+	v.Custom("permission", slices.Contains(SharePermissions, opts.Permission),
+		"Permission must be one of: "+strings.Join(SharePermissions, ", "))
+
+	if !opts.ExpiresAt.IsZero() {
+		v.Custom("expires_at", opts.ExpiresAt.After(now), "Expiry must be in the future")
+	}
+	if maxExpiry := s.config.Shares.MaxExpiry; maxExpiry > 0 {
+		v.Custom("expires_at", !opts.ExpiresAt.IsZero() && !opts.ExpiresAt.After(now.Add(maxExpiry)),
+			fmt.Sprintf("Share links must expire within %s", maxExpiry))
+	}
+
+	if opts.Password != "" {
+		v.Custom("password", utf8.RuneCountInString(opts.Password) >= minSharePasswordLength,
+			fmt.Sprintf("Password must be at least %d characters long", minSharePasswordLength))
+		v.Custom("password", len(opts.Password) <= maxSharePasswordBytes,
+			fmt.Sprintf("Password must be at most %d bytes long", maxSharePasswordBytes))
+	}
+
+	return v.Errors()
+}
+
+// Create creates a share link to a story owned by the user. The returned
+// link holds its token and URL path, which cannot be retrieved later.
+func (s *ShareService) Create(ownerID, storyID string, opts ShareOptions) (map[string]interface{}, error) {
+	story, err := s.story.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("story_shares")
+	if err != nil {
+		return nil, err
+	}
+
+	token := security.RandomString(shareTokenLength)
+	record := core.NewRecord(collection)
+	record.Set("story", story.Id)
+	record.Set("owner", ownerID)
+	record.Set("token_hash", shareTokenHash(token))
+	record.Set("permission", opts.Permission)
+	record.Set("views", 0)
+	record.Set("downloads", 0)
+	if !opts.ExpiresAt.IsZero() {
+		expiresAt, err := types.ParseDateTime(opts.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		record.Set("expires_at", expiresAt)
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		record.Set("password_hash", string(hash))
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+	logger.Info("Created share link %s for story %s", record.Id, story.Id)
+
+	share := shareMap(record)
+	share["token"] = token
+	share["url"] = "/api/shared/" + token
+	return share, nil
+}
+
+// List returns the user's share links to a story, newest first, with their
+// view and download counts
+func (s *ShareService) List(ownerID, storyID string) ([]map[string]interface{}, error) {
+	records, err := s.app.FindRecordsByFilter(
+		"story_shares",
+		"story = {:story} && owner = {:owner}",
+		"-created",
+		0,
+		0,
+		dbx.Params{"story": storyID, "owner": ownerID},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		shares[i] = shareMap(record)
+	}
+	return shares, nil
+}
+
+// Revoke stops a share link from working. The link is kept, with its
+// counts, so that it still shows up as revoked.
+func (s *ShareService) Revoke(ownerID, storyID, shareID string) (map[string]interface{}, error) {
+	record, err := s.app.FindRecordById("story_shares", shareID)
+	if err != nil {
+		return nil, ErrShareNotFound
+	}
+	if record.GetString("owner") != ownerID || record.GetString("story") != storyID {
+		return nil, ErrShareNotFound
+	}
+
+	if record.GetDateTime("revoked_at").IsZero() {
+		record.Set("revoked_at", types.NowDateTime())
+		if err := s.app.Save(record); err != nil {
+			return nil, err
+		}
+		logger.Info("Revoked share link %s of story %s", record.Id, storyID)
+	}
+
+	return shareMap(record), nil
+}
+
+// View opens a share link and returns its story, read-only and without the
+// owner's generation parameters, counting the view
+func (s *ShareService) View(token, password, clientIP string) (map[string]interface{}, error) {
+	share, story, err := s.open(token, password, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters, err := s.story.findChapters(story.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedChapters := make([]map[string]interface{}, len(chapters))
+	for i, chapter := range chapters {
+		imageURL, thumbURL := chapterImageURLs(chapter)
+		sharedChapters[i] = map[string]interface{}{
+			"number":        chapter.GetInt("number"),
+			"title":         chapter.GetString("title"),
+			"content":       chapter.GetString("content"),
+			"image_url":     imageURL,
+			"thumbnail_url": thumbURL,
+		}
+	}
+
+	s.count(share.Id, "views")
+
+	return map[string]interface{}{
+		"title":    story.GetString("title"),
+		"summary":  story.GetString("summary"),
+		"themes":   story.Get("themes"),
+		"chapters": sharedChapters,
+		"created":  story.GetDateTime("created"),
+		"share": map[string]interface{}{
+			"permission": share.GetString("permission"),
+			"expires_at": share.GetDateTime("expires_at"),
+		},
+	}, nil
+}
+
+// Download opens a share link that allows downloads and returns its story
+// for export, without the owner's generation parameters, counting the download
+func (s *ShareService) Download(token, password, clientIP string) (*StoredStory, error) {
+	share, story, err := s.open(token, password, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if share.GetString("permission") != SharePermissionDownload {
+		return nil, ErrShareDownloadForbidden
+	}
+
+	stored, err := s.story.storedStory(story)
+	if err != nil {
+		return nil, err
+	}
+	stored.Request = StoryRequest{}
+
+	s.count(share.Id, "downloads")
+	return stored, nil
+}
+
+// open finds the share link of a token, checks that it is active and its
+// password, and loads its story. Wrong passwords are limited per link and
+// client IP to SHARE_PASSWORD_ATTEMPTS, and per link from all clients to
+// SHARE_LINK_PASSWORD_ATTEMPTS, every 15 minutes. The per-link limit only
+// turns away wrong passwords, so it cannot lock out those who know the right one.
+func (s *ShareService) open(token, password, clientIP string) (*core.Record, *core.Record, error) {
+	if token == "" {
+		return nil, nil, ErrShareNotFound
+	}
+
+	share, err := s.app.FindFirstRecordByFilter(
+		"story_shares",
+		"token_hash = {:hash}",
+		dbx.Params{"hash": shareTokenHash(token)},
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrShareNotFound
+		}
+		return nil, nil, err
+	}
+	if shareStatus(share) != ShareStatusActive {
+		return nil, nil, ErrShareUnavailable
+	}
+
+	if hash := share.GetString("password_hash"); hash != "" {
+		if password == "" {
+			return nil, nil, ErrSharePasswordRequired
+		}
+		// every attempt takes a slot before the compare, and a correct
+		// password gives it back
+		key := share.Id + ":" + clientIP
+		if !s.attempts.Allow(key).Allowed {
+			return nil, nil, ErrSharePasswordAttempts
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			logger.Warn("Wrong password for share link %s from %s", share.Id, clientIP)
+			if !s.linkAttempts.Allow(share.Id).Allowed {
+				return nil, nil, ErrSharePasswordAttempts
+			}
+			return nil, nil, ErrSharePasswordInvalid
+		}
+		s.attempts.Release(key)
+	}
+
+	story, err := s.app.FindRecordById("stories", share.GetString("story"))
+	if err != nil || !storyVisible(story) {
+		return nil, nil, ErrShareNotFound
+	}
+
+	return share, story, nil
+}
+
+// count adds a view or download to a share link
+func (s *ShareService) count(shareID, field string) {
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := txApp.FindRecordById("story_shares", shareID)
+		if err != nil {
+			return err
+		}
+
+		record.Set(field, record.GetInt(field)+1)
+		if field == "views" {
+			record.Set("last_viewed_at", types.NowDateTime())
+		}
+		return txApp.Save(record)
+	})
+	if err != nil {
+		logger.Error("Failed to count share link "+field, err)
+	}
+}
+
+// shareTokenHash is the stored form of a share link token
+func shareTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// shareStatus reports whether a share link is active, expired or revoked
+func shareStatus(record *core.Record) string {
+	if !record.GetDateTime("revoked_at").IsZero() {
+		return ShareStatusRevoked
+	}
+	if expiresAt := record.GetDateTime("expires_at"); !expiresAt.IsZero() && !expiresAt.Time().After(time.Now()) {
+		return ShareStatusExpired
+	}
+	return ShareStatusActive
+}
+
+// shareMap converts a share link record to its API representation, without its token
+func shareMap(record *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             record.Id,
+		"story":          record.GetString("story"),
+		"permission":     record.GetString("permission"),
+		"has_password":   record.GetString("password_hash") != "",
+		"status":         shareStatus(record),
+		"expires_at":     record.GetDateTime("expires_at"),
+		"revoked_at":     record.GetDateTime("revoked_at"),
+		"views":          record.GetInt("views"),
+		"downloads":      record.GetInt("downloads"),
+		"last_viewed_at": record.GetDateTime("last_viewed_at"),
+		"created":        record.GetDateTime("created"),
+	}
+}
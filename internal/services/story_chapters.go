@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"pocket-app/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ErrChapterNotFound is returned when a story has no chapter with the requested number
+var ErrChapterNotFound = errors.New("chapter not found")
+
+// continuationContextChapters is how many of the final chapters are sent as
+// context when continuing a story
+const continuationContextChapters = 2
+
+// ChapterRegeneration is the outcome of regenerating a single chapter. Chapter
+// and Revision are only set when the new chapter passed validation and was
+// saved; Revision is the revision recorded for the new version, and earlier
+// versions stay in the chapter's revision history.
+type ChapterRegeneration struct {
+	Result   *GenerationResult      `json:"result"`
+	Chapter  map[string]interface{} `json:"chapter,omitempty"`
+	Revision map[string]interface{} `json:"revision,omitempty"`
+}
+
+// RegenerateChapter generates a new version of chapter number of a story,
+// giving the upstream the story summary, the surrounding chapters and the
+// characters as context. The chapter is replaced and its previous version is
+// kept as a revision.
+func (s *StoryService) RegenerateChapter(ctx context.Context, ownerID, storyID string, number int, instructions string) (*ChapterRegeneration, error) {
+	logger.Debug("Regenerating chapter %d of story %s for user %s", number, storyID, ownerID)
+
+	story, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+	chapters, err := s.findChapters(story.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i, chapter := range chapters {
+		if chapter.GetInt("number") == number {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, ErrChapterNotFound
+	}
+
+	req := chapterRegenerationRequest(story, chapters, index, instructions)
+	result, err := s.Generate(WithGenerationCaller(ctx, ownerID, GenerationOpRegenerate), req)
+	if err != nil {
+		return nil, err
+	}
+
+	regeneration := &ChapterRegeneration{Result: result}
+	if !result.Valid() {
+		return regeneration, nil
+	}
+	if err := s.moderateChapters(ctx, ownerID, story.Id, result.Story); err != nil {
+		return nil, err
+	}
+
+	chapter := chapters[index]
+	generated := result.Story.Chapters[0]
+	var revision *core.Record
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		chapter.Set("title", generated.Title)
+		chapter.Set("content", generated.Content)
+		chapter.Set("image_prompt", generated.ImagePrompt)
+		if err := txApp.Save(chapter); err != nil {
+			return err
+		}
+
+		revision, err = saveRevision(txApp, chapter, RevisionSourceAI, ownerID, "")
+		return err
+	})
+	if err != nil {
+		logger.Error("Failed to save regenerated chapter", err)
+		return nil, err
+	}
+
+	regeneration.Chapter = chapterMap(chapter)
+	regeneration.Revision = revisionMap(revision)
+	return regeneration, nil
+}
+
+// StoryContinuation is the outcome of continuing a story. Chapters holds the
+// appended chapters and is only set when the new chapters passed validation
+// and were saved.
+type StoryContinuation struct {
+	Result   *GenerationResult        `json:"result"`
+	Chapters []map[string]interface{} `json:"chapters,omitempty"`
+}
+
+// ContinueStory generates count more chapters for a story, giving the
+// upstream the story summary and its final chapters as context, and appends
+// them numbered after the last chapter.
+func (s *StoryService) ContinueStory(ctx context.Context, ownerID, storyID string, count int, instructions string) (*StoryContinuation, error) {
+	logger.Debug("Continuing story %s with %d chapters for user %s", storyID, count, ownerID)
+
+	story, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+	chapters, err := s.findChapters(story.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	req := storyContinuationRequest(story, chapters, count, instructions)
+	result, err := s.Generate(WithGenerationCaller(ctx, ownerID, GenerationOpContinue), req)
+	if err != nil {
+		return nil, err
+	}
+
+	continuation := &StoryContinuation{Result: result}
+	if !result.Valid() {
+		return continuation, nil
+	}
+	if err := s.moderateChapters(ctx, ownerID, story.Id, result.Story); err != nil {
+		return nil, err
+	}
+
+	var records []*core.Record
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		collection, err := txApp.FindCollectionByNameOrId("story_chapters")
+		if err != nil {
+			return err
+		}
+
+		// number after the chapters saved by now, which include those of a
+		// continuation that finished while this one was generating
+		last, err := lastChapterNumber(txApp, story.Id)
+		if err != nil {
+			return err
+		}
+
+		for i, chapter := range result.Story.Chapters {
+			record := core.NewRecord(collection)
+			record.Set("story", story.Id)
+			record.Set("number", last+i+1)
+			record.Set("title", chapter.Title)
+			record.Set("content", chapter.Content)
+			record.Set("image_prompt", chapter.ImagePrompt)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+			if _, err := saveRevision(txApp, record, RevisionSourceAI, ownerID, ""); err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+
+		// n_chapters keeps the originally requested count; saving bumps updated
+		return txApp.Save(story)
+	})
+	if err != nil {
+		logger.Error("Failed to save story continuation", err)
+		return nil, err
+	}
+
+	continuation.Chapters = make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		continuation.Chapters[i] = chapterMap(record)
+	}
+	return continuation, nil
+}
+
+// moderateChapters moderates chapters generated for an existing story
+// before they are saved. Flagged chapters are not saved; their text is kept
+// with the recorded decision for review, and a *FlaggedContentError is
+// returned.
+func (s *StoryService) moderateChapters(ctx context.Context, ownerID, storyID string, generated *Story) error {
+	decision := s.moderation.ModerateStory(ctx, ownerID, &Story{Chapters: generated.Chapters})
+	if decision == nil {
+		return nil
+	}
+
+	decision.StoryID = storyID
+	decision.Action = ModerationAllowed
+	if decision.Flagged() {
+		decision.Action = ModerationRejected
+	}
+	s.moderation.Record(decision)
+
+	if decision.Flagged() {
+		return &FlaggedContentError{Stage: ModerationStageOutput, Verdict: decision.Verdict}
+	}
+	return nil
+}
+
+// findChapters returns the chapters of a story in order
+func (s *StoryService) findChapters(storyID string) ([]*core.Record, error) {
+	return s.app.FindRecordsByFilter(
+		"story_chapters",
+		"story = {:story}",
+		"number",
+		0,
+		0,
+		dbx.Params{"story": storyID},
+	)
+}
+
+// lastChapterNumber returns the highest chapter number of a story, or zero
+// when it has no chapters
+func lastChapterNumber(txApp core.App, storyID string) (int, error) {
+	records, err := txApp.FindRecordsByFilter(
+		"story_chapters",
+		"story = {:story}",
+		"-number",
+		1,
+		0,
+		dbx.Params{"story": storyID},
+	)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	return records[0].GetInt("number"), nil
+}
+
+// findOwnedChapter loads a chapter by number from a story owned by the user
+func (s *StoryService) findOwnedChapter(ownerID, storyID string, number int) (*core.Record, error) {
+	story, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	chapter, err := s.app.FindFirstRecordByFilter(
+		"story_chapters",
+		"story = {:story} && number = {:number}",
+		dbx.Params{"story": story.Id, "number": number},
+	)
+	if err != nil {
+		return nil, ErrChapterNotFound
+	}
+	return chapter, nil
+}
+
+// chapterRegenerationRequest builds a single-chapter request whose
+// instructions carry the story context around the chapter at index
+func chapterRegenerationRequest(story *core.Record, chapters []*core.Record, index int, instructions string) StoryRequest {
+	chapter := chapters[index]
+	number := chapter.GetInt("number")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Rewrite chapter %d of an existing story.\n\n", number)
+	writeStoryContext(&b, story)
+	if index > 0 {
+		writeChapterContext(&b, "Previous chapter", chapters[index-1])
+	}
+	writeChapterContext(&b, "Chapter to rewrite", chapter)
+	if index < len(chapters)-1 {
+		writeChapterContext(&b, "Next chapter", chapters[index+1])
+	}
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		fmt.Fprintf(&b, "Instructions for the new version: %s\n\n", instructions)
+	}
+	fmt.Fprintf(&b, "Write a new version of chapter %d that follows on from the previous chapter and leads into the next one. ", number)
+	b.WriteString("Return the story JSON with the same Title and Summary and exactly one chapter: the new version.")
+
+	return StoryRequest{
+		NChapters:           1,
+		StoryInstructions:   b.String(),
+		PrimaryCharacters:   story.GetString("primary_characters"),
+		SecondaryCharacters: story.GetString("secondary_characters"),
+		LChapter:            story.GetInt("l_chapter"),
+		Fresh:               true,
+	}
+}
+
+// storyContinuationRequest builds a request for count new chapters whose
+// instructions carry the story summary and its final chapters
+func storyContinuationRequest(story *core.Record, chapters []*core.Record, count int, instructions string) StoryRequest {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Continue an existing story with %d new chapters.\n\n", count)
+	writeStoryContext(&b, story)
+	fmt.Fprintf(&b, "The story has %d chapters so far. It ends with:\n\n", len(chapters))
+	for _, chapter := range chapters[max(0, len(chapters)-continuationContextChapters):] {
+		writeChapterContext(&b, "Chapter", chapter)
+	}
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		fmt.Fprintf(&b, "Instructions for the new chapters: %s\n\n", instructions)
+	}
+	b.WriteString("Write what happens next, picking up where the last chapter ends. ")
+	fmt.Fprintf(&b, "Return the story JSON with the same Title and Summary and exactly %d chapters: only the new ones, numbered from 1.", count)
+
+	return StoryRequest{
+		NChapters:           count,
+		StoryInstructions:   b.String(),
+		PrimaryCharacters:   story.GetString("primary_characters"),
+		SecondaryCharacters: story.GetString("secondary_characters"),
+		LChapter:            story.GetInt("l_chapter"),
+		Fresh:               true,
+	}
+}
+
+// writeStoryContext writes the story's title, summary and original instructions
+func writeStoryContext(b *strings.Builder, story *core.Record) {
+	fmt.Fprintf(b, "Title: %s\n", story.GetString("title"))
+	fmt.Fprintf(b, "Summary: %s\n", story.GetString("summary"))
+	if instructions := story.GetString("story_instructions"); instructions != "" {
+		fmt.Fprintf(b, "Original instructions: %s\n", instructions)
+	}
+	b.WriteString("\n")
+}
+
+// writeChapterContext writes a labelled chapter
+func writeChapterContext(b *strings.Builder, label string, chapter *core.Record) {
+	fmt.Fprintf(b, "%s (chapter %d, %q):\n%s\n\n", label, chapter.GetInt("number"), chapter.GetString("title"), chapter.GetString("content"))
+}
+
+func chapterMap(record *core.Record) map[string]interface{} {
+	imageURL, thumbURL := chapterImageURLs(record)
+
+	return map[string]interface{}{
+		"id":            record.Id,
+		"number":        record.GetInt("number"),
+		"title":         record.GetString("title"),
+		"content":       record.GetString("content"),
+		"image_prompt":  record.GetString("image_prompt"),
+		"image_status":  record.GetString("image_status"),
+		"image_url":     imageURL,
+		"thumbnail_url": thumbURL,
+	}
+}
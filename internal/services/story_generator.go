@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/retry"
+)
+
+// Story generator backend names, selected with STORY_GENERATOR
+const (
+	GeneratorRivetHTTP = "rivet-http"
+	GeneratorOpenAI    = "openai"
+	GeneratorRivetCLI  = "rivet-cli"
+	GeneratorFake      = "fake"
+)
+
+// StoryGenerator produces a story for a request
+type StoryGenerator interface {
+	// Name returns the backend name
+	Name() string
+
+	// Generate runs a complete generation, including the backend's own retries
+	Generate(ctx context.Context, req StoryRequest) (*GenerationResult, error)
+}
+
+// StoryStreamer is implemented by generators that can emit story events
+// before the whole story is available
+type StoryStreamer interface {
+	GenerateStream(ctx context.Context, req StoryRequest, emit func(StoryEvent) error) (*GenerationResult, error)
+}
+
+// NewStoryGenerator creates the story generator selected in the configuration
+func NewStoryGenerator(cfg *config.Config) (StoryGenerator, error) {
+	switch cfg.Story.Generator {
+	case GeneratorRivetHTTP:
+		return NewRivetHTTPGenerator(cfg), nil
+	case GeneratorOpenAI:
+		return NewOpenAIGenerator(cfg), nil
+	case GeneratorRivetCLI:
+		return NewRivetCLIGenerator(cfg), nil
+	case GeneratorFake:
+		return NewFakeGenerator(), nil
+	default:
+		return nil, fmt.Errorf("unknown story generator %q", cfg.Story.Generator)
+	}
+}
+
+// storyRetryPolicy builds the upstream retry policy from the configuration
+func storyRetryPolicy(cfg *config.Config) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:       cfg.Retry.MaxAttempts,
+		InitialBackoff:    cfg.Retry.InitialDelay,
+		MaxBackoff:        cfg.Retry.MaxDelay,
+		Multiplier:        cfg.Retry.Multiplier,
+		Jitter:            cfg.Retry.Jitter,
+		AttemptTimeout:    cfg.Retry.AttemptTimeout,
+		OverallTimeout:    cfg.Retry.OverallTimeout,
+		RetryableStatuses: cfg.Retry.RetryableStatuses,
+	}
+}
+
+// errRetryableAttempt tells retry.Do that a generation attempt is worth repeating
+var errRetryableAttempt = errors.New("retryable generation attempt")
+
+// generationAttempt makes one generation attempt. It returns the result or
+// error to report if no further attempt is made, and whether another attempt
+// is worthwhile.
+type generationAttempt func(ctx context.Context, attempt int) (*GenerationResult, bool, error)
+
+// retryGeneration runs attempts under the policy and returns the outcome of
+// the last one, or the context's error once the caller has gone away
+func retryGeneration(ctx context.Context, policy retry.Policy, attempt generationAttempt) (*GenerationResult, error) {
+	var result *GenerationResult
+	var resultErr error
+
+	_, err := retry.Do(ctx, policy, func(ctx context.Context, n int) error {
+		var retryable bool
+		result, retryable, resultErr = attempt(ctx, n)
+		if retryable {
+			return errRetryableAttempt
+		}
+		return nil
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if result == nil && resultErr == nil {
+		return nil, err
+	}
+	return result, resultErr
+}
+
+// storyPrompt renders the story prompt used by backends that talk to a model
+// directly; it mirrors the prompt of the Rivet story graph
+func storyPrompt(req StoryRequest) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Please generate an engaging and age-appropriate children's story in %d chapters using the information below.\n\n", req.NChapters)
+	b.WriteString("### Target Audience\n- Children aged 5–8\n\n")
+	fmt.Fprintf(&b, "### Story Instructions\n%s\n\n", req.StoryInstructions)
+	fmt.Fprintf(&b, "### Characters\n\n**Primary Characters**\n%s\n\n**Secondary Characters**\n%s\n\n", req.PrimaryCharacters, req.SecondaryCharacters)
+	b.WriteString("### Requirements\n")
+	b.WriteString("- The story should have:\n")
+	b.WriteString("  - A **title**\n")
+	b.WriteString("  - A **summary** (50–100 words)\n")
+	fmt.Fprintf(&b, "  - %d chapters, each with:\n", req.NChapters)
+	b.WriteString("    - A **subtitle** (short and creative)\n")
+	fmt.Fprintf(&b, "    - A **content** section of about %d words\n", req.LChapter)
+	b.WriteString("    - A **suggested image prompt** for illustration generation\n")
+	b.WriteString("- Keep the language simple, clear, and engaging\n")
+	b.WriteString("- The story must be consistent with the characters' personalities\n")
+	b.WriteString("- Include imaginative elements and a positive lesson\n")
+	b.WriteString("- Avoid violence or anything inappropriate\n\n")
+	b.WriteString("Return the story in valid JSON format with this structure:\n\n")
+	b.WriteString(`{
+  "Title": string,
+  "Summary": string,
+  "Chapters": [
+    {
+      "Number": number,
+      "Title": string,
+      "ImagePrompt": string,
+      "Content": string
+    }
+  ],
+  "ThemesOrLessons": [string]
+}`)
+
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FakeGenerator returns a deterministic story built from the request, for
+// development without a model or Rivet server
+type FakeGenerator struct{}
+
+// NewFakeGenerator creates a new fake story generator
+func NewFakeGenerator() *FakeGenerator {
+	return &FakeGenerator{}
+}
+
+// Name returns the backend name
+func (g *FakeGenerator) Name() string {
+	return GeneratorFake
+}
+
+// Generate builds the same story every time for the same request
+func (g *FakeGenerator) Generate(ctx context.Context, req StoryRequest) (*GenerationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hero := firstCharacter(req.PrimaryCharacters, "Pip the Fox")
+	friend := firstCharacter(req.SecondaryCharacters, "Olive the Owl")
+
+	nChapters := req.NChapters
+	if nChapters < 1 {
+		nChapters = 1
+	}
+
+	chapters := make([]StoryChapter, nChapters)
+	for i := range chapters {
+		number := i + 1
+		chapters[i] = StoryChapter{
+			Number: number,
+			Title:  fmt.Sprintf("%s and the %s Adventure", hero, ordinal(number)),
+			Content: fmt.Sprintf(
+				"In chapter %d, %s set off with %s. %s They learned something new together and smiled all the way home.",
+				number, hero, friend, strings.TrimSpace(req.StoryInstructions),
+			),
+			ImagePrompt: fmt.Sprintf("A friendly watercolor illustration of %s and %s, scene %d", hero, friend, number),
+		}
+	}
+
+	return &GenerationResult{
+		StatusCode: http.StatusOK,
+		Message:    "Story generation completed successfully",
+		Status:     "success",
+		Story: &Story{
+			Title:           fmt.Sprintf("The Adventures of %s", hero),
+			Summary:         fmt.Sprintf("%s and %s go on %d small adventures and discover the value of friendship.", hero, friend, nChapters),
+			Chapters:        chapters,
+			ThemesOrLessons: []string{"Friendship", "Curiosity"},
+		},
+		Attempts: 1,
+	}, nil
+}
+
+// firstCharacter returns the first comma-separated name in a character list
+func firstCharacter(characters, fallback string) string {
+	name := strings.TrimSpace(strings.Split(characters, ",")[0])
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+func ordinal(n int) string {
+	switch n {
+	case 1:
+		return "First"
+	case 2:
+		return "Second"
+	case 3:
+		return "Third"
+	default:
+		return fmt.Sprintf("%dth", n)
+	}
+}
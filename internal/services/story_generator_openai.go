@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/retry"
+)
+
+// storySystemPrompt is sent as the system message to chat-completions backends
+const storySystemPrompt = "You are a professional children's story writer. Reply with the story JSON only."
+
+// OpenAIGenerator generates stories with an OpenAI-compatible chat-completions API
+type OpenAIGenerator struct {
+	config *config.Config
+	client *retry.Client
+}
+
+// NewOpenAIGenerator creates a new chat-completions story generator
+func NewOpenAIGenerator(cfg *config.Config) *OpenAIGenerator {
+	return &OpenAIGenerator{
+		config: cfg,
+		client: retry.NewClient(storyRetryPolicy(cfg)),
+	}
+}
+
+// Name returns the backend name
+func (g *OpenAIGenerator) Name() string {
+	return GeneratorOpenAI
+}
+
+type chatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// Generate sends the story prompt as a chat completion, retrying on transport
+// errors, retryable statuses and malformed responses
+func (g *OpenAIGenerator) Generate(ctx context.Context, req StoryRequest) (*GenerationResult, error) {
+	apiURL := strings.TrimRight(g.config.OpenAI.BaseURL, "/") + "/chat/completions"
+	policy := g.client.Policy()
+
+	jsonData, err := json.Marshal(chatCompletionRequest{
+		Model: g.config.OpenAI.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: storySystemPrompt},
+			{Role: "user", Content: storyPrompt(req)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if g.config.OpenAI.APIKey != "" {
+		header.Set("Authorization", "Bearer "+g.config.OpenAI.APIKey)
+	}
+
+	return retryGeneration(ctx, policy, func(ctx context.Context, attempt int) (*GenerationResult, bool, error) {
+		logger.Info("Attempt %d/%d: Requesting chat completion from: %s", attempt, policy.Attempts(), apiURL)
+
+		resp, err := g.client.Send(ctx, http.MethodPost, apiURL, jsonData, header)
+		if err != nil {
+			logger.Warn("Attempt %d: Error making chat completion request: %v", attempt, err)
+			return nil, true, &UpstreamError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "Failed to make request to chat completions API after all retries",
+				Attempts:   attempt,
+			}
+		}
+
+		if resp.StatusCode >= 400 {
+			logger.Warn("Attempt %d: Chat completions API returned error status %d", attempt, resp.StatusCode)
+			return nil, policy.IsRetryableStatus(resp.StatusCode), &UpstreamError{
+				StatusCode:     http.StatusBadGateway,
+				Message:        "Chat completions API returned an error",
+				UpstreamStatus: resp.StatusCode,
+				Body:           string(resp.Body),
+				TargetURL:      apiURL,
+				Attempts:       attempt,
+			}
+		}
+
+		var completion chatCompletionResponse
+		if err := json.Unmarshal(resp.Body, &completion); err != nil || len(completion.Choices) == 0 {
+			logger.Warn("Attempt %d: Unexpected chat completion response", attempt)
+			return &GenerationResult{
+				StatusCode:  http.StatusOK,
+				Message:     "Story generation completed but response parsing failed",
+				Status:      "success",
+				RawResponse: string(resp.Body),
+				Attempts:    attempt,
+			}, true, nil
+		}
+
+		return parseStoryText(http.StatusOK, completion.Choices[0].Message.Content, nil, attempt), false, nil
+	})
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/retry"
+)
+
+// RivetHTTPGenerator runs the story graph through a Rivet HTTP endpoint (STORY_API_URL)
+type RivetHTTPGenerator struct {
+	config *config.Config
+	client *retry.Client
+}
+
+// NewRivetHTTPGenerator creates a new Rivet HTTP story generator
+func NewRivetHTTPGenerator(cfg *config.Config) *RivetHTTPGenerator {
+	return &RivetHTTPGenerator{
+		config: cfg,
+		client: retry.NewClient(storyRetryPolicy(cfg)),
+	}
+}
+
+// Name returns the backend name
+func (g *RivetHTTPGenerator) Name() string {
+	return GeneratorRivetHTTP
+}
+
+// Generate calls the Rivet endpoint, retrying on transport errors, retryable
+// statuses and "control-flow-excluded" outputs
+func (g *RivetHTTPGenerator) Generate(ctx context.Context, req StoryRequest) (*GenerationResult, error) {
+	apiURL := g.config.Story.APIURL
+	policy := g.client.Policy()
+
+	jsonData, err := json.Marshal(req.inputs())
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Story request payload: %s", logger.Body(jsonData))
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	return retryGeneration(ctx, policy, func(ctx context.Context, attempt int) (*GenerationResult, bool, error) {
+		logger.Info("Attempt %d/%d: Making request to: %s", attempt, policy.Attempts(), apiURL)
+
+		resp, err := g.client.Send(ctx, http.MethodPost, apiURL, jsonData, header)
+		if err != nil {
+			logger.Warn("Attempt %d: Error making HTTP request: %v", attempt, err)
+			return nil, true, &UpstreamError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "Failed to make request to story API after all retries",
+				Attempts:   attempt,
+			}
+		}
+		logger.Debug("Attempt %d: Story API response headers: %v", attempt, logger.Headers(resp.Header))
+
+		return evaluateRivetAttempt(g.config, policy, resp.StatusCode, resp.Body, apiURL, attempt)
+	})
+}
+
+// GenerateStream asks the Rivet endpoint for an event stream. Responses with
+// text/event-stream are parsed incrementally; any other response is handled
+// like Generate and replayed as events once complete. A stream is only
+// retried if it failed before any event was emitted.
+func (g *RivetHTTPGenerator) GenerateStream(ctx context.Context, req StoryRequest, emit func(StoryEvent) error) (*GenerationResult, error) {
+	apiURL := g.config.Story.APIURL
+
+	// a stream may legitimately outlast a single attempt; the overall
+	// timeout still applies
+	policy := g.client.Policy()
+	policy.AttemptTimeout = 0
+
+	jsonData, err := json.Marshal(req.inputs())
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Accept", "text/event-stream, application/json")
+
+	return retryGeneration(ctx, policy, func(ctx context.Context, attempt int) (*GenerationResult, bool, error) {
+		logger.Info("Stream attempt %d/%d: Making request to: %s", attempt, policy.Attempts(), apiURL)
+
+		resp, err := g.client.Open(ctx, http.MethodPost, apiURL, jsonData, header)
+		if err != nil {
+			logger.Warn("Stream attempt %d: Error making HTTP request: %v", attempt, err)
+			return nil, true, &UpstreamError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "Failed to make request to story API after all retries",
+				Attempts:   attempt,
+			}
+		}
+		defer resp.Body.Close()
+		logger.Debug("Stream attempt %d: Story API response headers: %v", attempt, logger.Headers(resp.Header))
+
+		parser := newStoryStreamParser(emit)
+
+		if resp.StatusCode < 400 && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			result, err := parser.consume(resp.Body, attempt)
+			if err != nil && !parser.started() {
+				logger.Warn("Stream attempt %d: Upstream stream failed before any output: %v", attempt, err)
+				return nil, true, err
+			}
+			return result, false, err
+		}
+
+		responseBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			logger.Warn("Stream attempt %d: Error reading response: %v", attempt, err)
+			return nil, true, &UpstreamError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "Failed to read response from story API after all retries",
+				Attempts:   attempt,
+			}
+		}
+
+		result, retryable, err := evaluateRivetAttempt(g.config, policy, resp.StatusCode, responseBody, apiURL, attempt)
+		if retryable || err != nil {
+			return result, retryable, err
+		}
+		if result.Story != nil {
+			if err := parser.flushStory(result.Story); err != nil {
+				return nil, false, err
+			}
+		}
+		return result, false, nil
+	})
+}
+
+// evaluateRivetAttempt evaluates a Rivet response and decides with the retry
+// policy and configuration whether another attempt is worthwhile
+func evaluateRivetAttempt(cfg *config.Config, policy retry.Policy, statusCode int, responseBody []byte, targetURL string, attempt int) (*GenerationResult, bool, error) {
+	result, reason, err := evaluateRivetResponse(statusCode, responseBody, targetURL, attempt)
+
+	switch reason {
+	case retryReasonStatus:
+		return result, policy.IsRetryableStatus(statusCode), err
+	case retryReasonControlFlowExcluded:
+		return result, cfg.Retry.RetryControlFlowExcluded, err
+	case retryReasonMalformed:
+		return result, true, err
+	default:
+		return result, false, err
+	}
+}
+
+// Reasons a single upstream response may deserve another attempt
+const (
+	retryReasonNone = iota
+	retryReasonStatus
+	retryReasonMalformed
+	retryReasonControlFlowExcluded
+)
+
+// evaluateRivetResponse turns a single Rivet response into the result or
+// error to report if no further attempt is made, and the reason another
+// attempt may help
+func evaluateRivetResponse(statusCode int, responseBody []byte, targetURL string, attempt int) (*GenerationResult, int, error) {
+	logger.Info("Attempt %d: Story API response status: %d", attempt, statusCode)
+	logger.Debug("Attempt %d: Story API response body: %s", attempt, logger.Body(responseBody))
+
+	if statusCode >= 400 {
+		logger.Warn("Attempt %d: Target API returned error status %d", attempt, statusCode)
+		return nil, retryReasonStatus, &UpstreamError{
+			StatusCode:     http.StatusBadGateway,
+			Message:        "Target API returned an error",
+			UpstreamStatus: statusCode,
+			Body:           string(responseBody),
+			TargetURL:      targetURL,
+			Attempts:       attempt,
+		}
+	}
+
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(responseBody, &responseData); err != nil {
+		logger.Warn("Attempt %d: Error parsing response JSON: %v", attempt, err)
+		return &GenerationResult{
+			StatusCode:  statusCode,
+			Message:     "Story generation completed but response parsing failed",
+			Status:      "success",
+			RawResponse: string(responseBody),
+			ParseError:  err.Error(),
+			Attempts:    attempt,
+		}, retryReasonMalformed, nil
+	}
+
+	if isControlFlowExcluded(responseData) {
+		logger.Warn("Attempt %d: Received control-flow-excluded", attempt)
+		return &GenerationResult{
+			StatusCode: http.StatusOK,
+			Message:    "Story generation completed but returned control-flow-excluded",
+			Status:     "control_flow_excluded",
+			Data:       responseData,
+			Attempts:   attempt,
+			Info:       "The Rivet flow returned control-flow-excluded. This might indicate a configuration issue with the flow.",
+		}, retryReasonControlFlowExcluded, nil
+	}
+
+	logger.Info("Attempt %d: Success! Parsing story output", attempt)
+	return parseStoryResponse(statusCode, responseData, attempt), retryReasonNone, nil
+}
+
+// isControlFlowExcluded reports whether the Rivet output was excluded by the graph's control flow
+func isControlFlowExcluded(responseData map[string]interface{}) bool {
+	outputMap, ok := responseData["output"].(map[string]interface{})
+	return ok && outputMap["type"] == "control-flow-excluded"
+}
+
+// parseStoryResponse extracts the story JSON from a successful Rivet response
+func parseStoryResponse(statusCode int, responseData map[string]interface{}, attempt int) *GenerationResult {
+	outputMap, ok := responseData["output"].(map[string]interface{})
+	if !ok || outputMap["type"] != "string" {
+		return &GenerationResult{
+			StatusCode: statusCode,
+			Message:    "Story generation completed successfully",
+			Status:     "success",
+			Data:       responseData,
+			Attempts:   attempt,
+		}
+	}
+
+	valueString, ok := outputMap["value"].(string)
+	if !ok {
+		return &GenerationResult{
+			StatusCode: statusCode,
+			Message:    "Story generation completed successfully",
+			Status:     "success",
+			Data:       responseData,
+			Attempts:   attempt,
+		}
+	}
+
+	return parseStoryText(statusCode, valueString, responseData, attempt)
+}
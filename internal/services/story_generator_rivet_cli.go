@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+)
+
+// RivetCLIGenerator runs the story graph locally with the Rivet CLI
+// (`rivet run <project> [graph] --inputs-stdin`), using RIVET_PROJECT_PATH
+// and RIVET_TIMEOUT
+type RivetCLIGenerator struct {
+	config *config.Config
+}
+
+// NewRivetCLIGenerator creates a new Rivet CLI story generator
+func NewRivetCLIGenerator(cfg *config.Config) *RivetCLIGenerator {
+	return &RivetCLIGenerator{
+		config: cfg,
+	}
+}
+
+// Name returns the backend name
+func (g *RivetCLIGenerator) Name() string {
+	return GeneratorRivetCLI
+}
+
+// Generate runs the graph with the request as stdin inputs and parses the
+// graph outputs printed on stdout. Each run is bounded by RIVET_TIMEOUT.
+func (g *RivetCLIGenerator) Generate(ctx context.Context, req StoryRequest) (*GenerationResult, error) {
+	policy := storyRetryPolicy(g.config)
+	policy.AttemptTimeout = g.config.Rivet.Timeout
+
+	inputs, err := json.Marshal(req.inputs())
+	if err != nil {
+		return nil, err
+	}
+
+	command := strings.Fields(g.config.Rivet.Command)
+	if len(command) == 0 {
+		return nil, errors.New("rivet CLI command is not configured")
+	}
+	args := append(command[1:], "run", g.config.Rivet.ProjectPath)
+	if g.config.Rivet.Graph != "" {
+		args = append(args, g.config.Rivet.Graph)
+	}
+	args = append(args, "--inputs-stdin")
+
+	return retryGeneration(ctx, policy, func(ctx context.Context, attempt int) (*GenerationResult, bool, error) {
+		logger.Info("Attempt %d/%d: Running Rivet graph from: %s", attempt, policy.Attempts(), g.config.Rivet.ProjectPath)
+
+		cmd := exec.CommandContext(ctx, command[0], args...)
+		cmd.Stdin = bytes.NewReader(inputs)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			timedOut := ctx.Err() == context.DeadlineExceeded
+			logger.Warn("Attempt %d: Rivet CLI failed (timed out: %t): %v: %s", attempt, timedOut, err, logger.Body(stderr.Bytes()))
+			message := "Rivet CLI failed after all retries"
+			if timedOut {
+				message = "Rivet CLI timed out after all retries"
+			}
+			return nil, true, &UpstreamError{
+				StatusCode: http.StatusBadGateway,
+				Message:    message,
+				Body:       stderr.String(),
+				Attempts:   attempt,
+			}
+		}
+
+		return evaluateRivetAttempt(g.config, policy, http.StatusOK, stdout.Bytes(), g.config.Rivet.ProjectPath, attempt)
+	})
+}
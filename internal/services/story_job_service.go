@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Story job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+var (
+	// ErrJobNotFound is returned when a job does not exist or is not visible to the caller
+	ErrJobNotFound = errors.New("story job not found")
+
+	// ErrJobQueueFull is returned when no more jobs can be accepted
+	ErrJobQueueFull = errors.New("story job queue is full")
+)
+
+// StoryJobService runs story generation in background workers backed by the story_jobs collection
+type StoryJobService struct {
+	app    *pocketbase.PocketBase
+	config *config.Config
+	story  *StoryService
+	quota  *QuotaService
+
+	queue     chan string
+	stop      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewStoryJobService creates a new story job service
+func NewStoryJobService(app *pocketbase.PocketBase, cfg *config.Config, story *StoryService, quota *QuotaService) *StoryJobService {
+	queueSize := cfg.Story.JobQueueSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &StoryJobService{
+		app:    app,
+		config: cfg,
+		story:  story,
+		quota:  quota,
+		queue:  make(chan string, queueSize),
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start launches the workers and re-queues jobs left unfinished by a previous run
+func (s *StoryJobService) Start() {
+	s.startOnce.Do(func() {
+		workers := s.config.Story.JobWorkers
+		if workers < 1 {
+			workers = 1
+		}
+
+		for i := 0; i < workers; i++ {
+			s.wg.Add(1)
+			go s.worker()
+		}
+
+		logger.Info("Story job workers started: %d", workers)
+
+		s.recoverPendingJobs()
+	})
+}
+
+// Stop signals the workers to exit and cancels in-flight generations; their
+// jobs stay "running" and are re-queued on the next start
+func (s *StoryJobService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.cancel()
+		s.wg.Wait()
+		logger.Info("Story job workers stopped")
+	})
+}
+
+// Enqueue stores a new queued job and hands it to the workers
+func (s *StoryJobService) Enqueue(ownerID string, req StoryRequest) (*core.Record, error) {
+	collection, err := s.app.FindCollectionByNameOrId("story_jobs")
+	if err != nil {
+		return nil, err
+	}
+
+	reservation, err := s.quota.Reserve(ownerID, req)
+	if err != nil {
+		return nil, err
+	}
+	release := func() {
+		s.quota.Release(*reservation)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("owner", ownerID)
+	record.Set("status", JobStatusQueued)
+	record.Set("attempts", 0)
+	record.Set("request", req)
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to create story job", err)
+		release()
+		return nil, err
+	}
+
+	select {
+	case s.queue <- record.Id:
+	default:
+		s.finish(record, nil, ErrJobQueueFull)
+		release()
+		return nil, ErrJobQueueFull
+	}
+
+	logger.Info("Story job %s queued", record.Id)
+	return record, nil
+}
+
+// GetJob retrieves a job; jobs are only visible to the user who created them
+func (s *StoryJobService) GetJob(authID, jobID string) (map[string]interface{}, error) {
+	record, err := s.app.FindRecordById("story_jobs", jobID)
+	if err != nil {
+		return nil, ErrJobNotFound
+	}
+	if record.GetString("owner") != authID {
+		return nil, ErrJobNotFound
+	}
+
+	return storyJobMap(record), nil
+}
+
+// recoverPendingJobs puts jobs that were queued or running at shutdown back on the queue
+func (s *StoryJobService) recoverPendingJobs() {
+	records, err := s.app.FindRecordsByFilter(
+		"story_jobs",
+		"status = {:queued} || status = {:running}",
+		"created",
+		0,
+		0,
+		dbx.Params{"queued": JobStatusQueued, "running": JobStatusRunning},
+	)
+	if err != nil {
+		logger.Error("Failed to load pending story jobs", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	logger.Info("Re-queueing %d pending story jobs", len(records))
+
+	go func() {
+		for _, record := range records {
+			select {
+			case s.queue <- record.Id:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// worker processes queued jobs until the service is stopped
+func (s *StoryJobService) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case jobID := <-s.queue:
+			s.run(jobID)
+		}
+	}
+}
+
+// run executes a single job and records its outcome
+func (s *StoryJobService) run(jobID string) {
+	record, err := s.app.FindRecordById("story_jobs", jobID)
+	if err != nil {
+		logger.Error("Failed to load story job "+jobID, err)
+		return
+	}
+
+	var req StoryRequest
+	if err := record.UnmarshalJSONField("request", &req); err != nil {
+		s.finish(record, nil, err)
+		return
+	}
+
+	record.Set("status", JobStatusRunning)
+	record.Set("started_at", types.NowDateTime())
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to mark story job as running", err)
+		return
+	}
+
+	logger.Info("Story job %s running", jobID)
+
+	ownerID := record.GetString("owner")
+	result, err := s.story.Generate(WithGenerationCaller(s.ctx, ownerID, GenerationOpJob), req)
+	if s.ctx.Err() != nil {
+		logger.Info("Story job %s interrupted by shutdown", jobID)
+		return
+	}
+	if err == nil && !result.Valid() {
+		err = storyValidationError(result)
+	}
+	if err == nil {
+		story, saveErr := s.story.SaveStory(s.ctx, ownerID, req, result.Story)
+		if saveErr != nil {
+			logger.Error("Failed to persist story for job "+jobID, saveErr)
+			err = fmt.Errorf("failed to save story: %w", saveErr)
+		} else {
+			result.StoryID = story.Id
+			if !storyVisible(story) {
+				result.Withhold()
+			}
+		}
+	}
+	if err != nil || result.StoryID == "" {
+		// only stories that were produced and saved count towards the quota
+		s.quota.Release(s.quota.Reservation(ownerID, req, record.GetDateTime("created").Time()))
+	}
+
+	s.finish(record, result, err)
+}
+
+// finish stores the final status, attempt count and result of a job. A job
+// fails when err is set, even if the generation produced a result.
+func (s *StoryJobService) finish(record *core.Record, result *GenerationResult, err error) {
+	if result != nil {
+		record.Set("attempts", result.Attempts)
+		record.Set("result", result)
+	}
+	if err != nil {
+		record.Set("status", JobStatusFailed)
+		record.Set("error", err.Error())
+
+		var upstreamErr *UpstreamError
+		if errors.As(err, &upstreamErr) {
+			record.Set("attempts", upstreamErr.Attempts)
+		}
+	} else {
+		record.Set("status", JobStatusSucceeded)
+		record.Set("story", result.StoryID)
+	}
+	record.Set("finished_at", types.NowDateTime())
+
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to save story job result", err)
+		return
+	}
+
+	logger.Info("Story job %s %s", record.Id, record.GetString("status"))
+}
+
+// storyValidationError describes why a generated story was rejected
+func storyValidationError(result *GenerationResult) error {
+	if !result.ValidationProblems.HasErrors() {
+		return errors.New(result.Message)
+	}
+
+	problems := make([]string, len(result.ValidationProblems))
+	for i, problem := range result.ValidationProblems {
+		problems[i] = problem.Field + ": " + problem.Message
+	}
+	return fmt.Errorf("%s: %s", result.Message, strings.Join(problems, "; "))
+}
+
+// storyJobMap converts a job record to its API representation
+func storyJobMap(record *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          record.Id,
+		"status":      record.GetString("status"),
+		"attempts":    record.GetInt("attempts"),
+		"result":      record.Get("result"),
+		"error":       record.GetString("error"),
+		"story_id":    record.GetString("story"),
+		"created":     record.GetDateTime("created"),
+		"started_at":  record.GetDateTime("started_at"),
+		"finished_at": record.GetDateTime("finished_at"),
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ModerateEdit moderates the text fields of a story or chapter that a
+// records API request creates or changes, before they are saved
+func (s *StoryService) ModerateEdit(ctx context.Context, ownerID string, record *core.Record) error {
+	kind := revisionKind(record)
+	storyID := record.Id
+	if kind == RevisionKindChapter {
+		storyID = record.GetString("story")
+	}
+
+	var texts []string
+	for _, field := range revisionFields[kind] {
+		text := revisionText(record, field)
+		if record.IsNew() || text != revisionText(record.Original(), field) {
+			texts = append(texts, text)
+		}
+	}
+	return s.moderation.CheckEdit(ctx, ownerID, storyID, texts...)
+}
+
+// ListQuarantinedStories lists the stories held for review by content
+// moderation, oldest first, with the reasons they were held
+func (s *StoryService) ListQuarantinedStories(page, perPage int) ([]map[string]interface{}, int, error) {
+	records, err := s.app.FindRecordsByFilter(
+		"stories",
+		"moderation_status = {:status}",
+		"created",
+		perPage,
+		(page-1)*perPage,
+		dbx.Params{"status": ModerationQuarantined},
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.app.CountRecords("stories", dbx.HashExp{"moderation_status": ModerationQuarantined})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stories := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		story := reviewSummaryMap(record)
+		decisions, err := s.moderation.StoryDecisions(record.Id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(decisions) > 0 {
+			story["decision"] = decisions[len(decisions)-1]
+		}
+		stories[i] = story
+	}
+
+	return stories, int(total), nil
+}
+
+// GetStoryForReview returns any story with its chapters and the moderation
+// decisions recorded for it
+func (s *StoryService) GetStoryForReview(storyID string) (map[string]interface{}, error) {
+	record, err := s.app.FindRecordById("stories", storyID)
+	if err != nil {
+		return nil, ErrStoryNotFound
+	}
+
+	return s.reviewStoryMap(record)
+}
+
+// ReviewStory approves a story, showing it to its owner, or rejects it,
+// keeping it hidden. The review is recorded as a moderation decision.
+func (s *StoryService) ReviewStory(storyID, reviewerID string, approve bool, note string) (map[string]interface{}, error) {
+	record, err := s.app.FindRecordById("stories", storyID)
+	if err != nil {
+		return nil, ErrStoryNotFound
+	}
+
+	action := ModerationRejected
+	if approve {
+		action = ModerationApproved
+	}
+	record.Set("moderation_status", action)
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+
+	s.moderation.Record(&ModerationDecision{
+		Stage:    ModerationStageReview,
+		Action:   action,
+		OwnerID:  record.GetString("owner"),
+		StoryID:  record.Id,
+		Reviewer: reviewerID,
+		Note:     note,
+	})
+
+	return s.reviewStoryMap(record)
+}
+
+// reviewStoryMap converts a story to its API representation for reviewers
+func (s *StoryService) reviewStoryMap(record *core.Record) (map[string]interface{}, error) {
+	story, err := s.storyWithChapters(record)
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := s.moderation.StoryDecisions(record.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	story["owner"] = record.GetString("owner")
+	story["moderation_status"] = record.GetString("moderation_status")
+	story["decisions"] = decisions
+	return story, nil
+}
+
+// reviewSummaryMap converts a story record to its summary for reviewers
+func reviewSummaryMap(record *core.Record) map[string]interface{} {
+	story := storySummaryMap(record)
+	story["owner"] = record.GetString("owner")
+	story["moderation_status"] = record.GetString("moderation_status")
+	return story
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/worddiff"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Revision sources
+const (
+	RevisionSourceAI     = "ai"
+	RevisionSourceManual = "manual"
+)
+
+// Revision kinds
+const (
+	RevisionKindStory   = "story"
+	RevisionKindChapter = "chapter"
+)
+
+var (
+	// ErrRevisionNotFound is returned when a story has no revision with the requested id
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrRevisionsNotComparable is returned when diffing revisions of different chapters or kinds
+	ErrRevisionsNotComparable = errors.New("revisions belong to different chapters")
+)
+
+// revisionFields are the fields a revision snapshots, by kind
+var revisionFields = map[string][]string{
+	RevisionKindStory:   {"title", "summary", "themes"},
+	RevisionKindChapter: {"title", "content", "image_prompt"},
+}
+
+// FieldDiff is the word-level diff of one field between two revisions
+type FieldDiff struct {
+	Field    string        `json:"field"`
+	Changed  bool          `json:"changed"`
+	Inserted int           `json:"inserted"`
+	Deleted  int           `json:"deleted"`
+	Ops      []worddiff.Op `json:"ops"`
+}
+
+// RevisionDiff compares two revisions of the same story or chapter
+type RevisionDiff struct {
+	From   map[string]interface{} `json:"from"`
+	To     map[string]interface{} `json:"to"`
+	Fields []FieldDiff            `json:"fields"`
+}
+
+// RecordRevision stores an immutable snapshot of a story or chapter record
+func (s *StoryService) RecordRevision(record *core.Record, authorID, source string) error {
+	_, err := saveRevision(s.app, record, source, authorID, "")
+	return err
+}
+
+// RevisionChanged reports whether saving the record changes any of the
+// fields a revision snapshots
+func RevisionChanged(record *core.Record) bool {
+	if record.IsNew() {
+		return true
+	}
+
+	original := record.Original()
+	for _, field := range revisionFields[revisionKind(record)] {
+		if revisionText(record, field) != revisionText(original, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListRevisions returns the revisions of a story, newest first. A chapter
+// number above zero limits the list to that chapter.
+func (s *StoryService) ListRevisions(ownerID, storyID string, chapterNumber int) ([]map[string]interface{}, error) {
+	story, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := "story = {:story}"
+	params := dbx.Params{"story": story.Id}
+	if chapterNumber > 0 {
+		chapter, err := s.findOwnedChapter(ownerID, storyID, chapterNumber)
+		if err != nil {
+			return nil, err
+		}
+		filter += " && chapter = {:chapter}"
+		params["chapter"] = chapter.Id
+	}
+
+	records, err := s.app.FindRecordsByFilter("story_revisions", filter, "-created,-@rowid", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		revisions[i] = revisionMap(record)
+	}
+	return revisions, nil
+}
+
+// DiffRevisions returns a word-level diff of every snapshotted field between
+// two revisions of the same story or chapter
+func (s *StoryService) DiffRevisions(ownerID, storyID, fromID, toID string) (*RevisionDiff, error) {
+	story, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := findRevision(s.app, story.Id, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := findRevision(s.app, story.Id, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := from.GetString("kind")
+	if kind != to.GetString("kind") || from.GetString("chapter") != to.GetString("chapter") {
+		return nil, ErrRevisionsNotComparable
+	}
+
+	diff := &RevisionDiff{
+		From: revisionMap(from),
+		To:   revisionMap(to),
+	}
+	for _, field := range revisionFields[kind] {
+		ops := worddiff.Words(revisionText(from, field), revisionText(to, field))
+		inserted, deleted := worddiff.Stats(ops)
+		diff.Fields = append(diff.Fields, FieldDiff{
+			Field:    field,
+			Changed:  len(ops) > 1 || (len(ops) == 1 && ops[0].Type != worddiff.Equal),
+			Inserted: inserted,
+			Deleted:  deleted,
+			Ops:      ops,
+		})
+	}
+	return diff, nil
+}
+
+// RestoreRevision copies a revision back onto its story or chapter. The
+// restore is itself recorded as a new manual revision.
+func (s *StoryService) RestoreRevision(ownerID, storyID, revisionID, authorID string) (map[string]interface{}, error) {
+	story, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored *core.Record
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		revision, err := findRevision(txApp, story.Id, revisionID)
+		if err != nil {
+			return err
+		}
+
+		target := story
+		if revision.GetString("kind") == RevisionKindChapter {
+			target, err = txApp.FindRecordById("story_chapters", revision.GetString("chapter"))
+			if err != nil {
+				return ErrChapterNotFound
+			}
+		}
+
+		for _, field := range revisionFields[revision.GetString("kind")] {
+			target.Set(field, revision.Get(field))
+		}
+		if err := txApp.Save(target); err != nil {
+			return err
+		}
+
+		restored, err = saveRevision(txApp, target, RevisionSourceManual, authorID, revision.Id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Restored revision %s of story %s", revisionID, storyID)
+	return revisionMap(restored), nil
+}
+
+// findRevision loads a revision that belongs to the story
+func findRevision(app core.App, storyID, revisionID string) (*core.Record, error) {
+	revision, err := app.FindFirstRecordByFilter(
+		"story_revisions",
+		"id = {:id} && story = {:story}",
+		dbx.Params{"id": revisionID, "story": storyID},
+	)
+	if err != nil {
+		return nil, ErrRevisionNotFound
+	}
+	return revision, nil
+}
+
+// saveRevision stores a snapshot of a saved story or chapter record
+func saveRevision(app core.App, record *core.Record, source, authorID, restoredFrom string) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId("story_revisions")
+	if err != nil {
+		return nil, err
+	}
+
+	kind := revisionKind(record)
+	revision := core.NewRecord(collection)
+	revision.Set("kind", kind)
+	revision.Set("source", source)
+	revision.Set("author", authorID)
+	revision.Set("restored_from", restoredFrom)
+	if kind == RevisionKindStory {
+		revision.Set("story", record.Id)
+	} else {
+		revision.Set("story", record.GetString("story"))
+		revision.Set("chapter", record.Id)
+		revision.Set("number", record.GetInt("number"))
+	}
+	for _, field := range revisionFields[kind] {
+		revision.Set(field, record.Get(field))
+	}
+
+	if err := app.Save(revision); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// revisionKind returns the revision kind of a stories or story_chapters record
+func revisionKind(record *core.Record) string {
+	if record.Collection().Name == "stories" {
+		return RevisionKindStory
+	}
+	return RevisionKindChapter
+}
+
+// revisionText returns a snapshotted field as text; themes are joined into a list
+func revisionText(record *core.Record, field string) string {
+	if field == "themes" {
+		var themes []string
+		_ = record.UnmarshalJSONField(field, &themes)
+		return strings.Join(themes, ", ")
+	}
+	return record.GetString(field)
+}
+
+func revisionMap(record *core.Record) map[string]interface{} {
+	revision := map[string]interface{}{
+		"id":            record.Id,
+		"kind":          record.GetString("kind"),
+		"source":        record.GetString("source"),
+		"author":        record.GetString("author"),
+		"restored_from": record.GetString("restored_from"),
+		"created":       record.GetDateTime("created"),
+	}
+	if record.GetString("kind") == RevisionKindChapter {
+		revision["chapter"] = record.GetString("chapter")
+		revision["number"] = record.GetInt("number")
+	}
+	for _, field := range revisionFields[record.GetString("kind")] {
+		revision[field] = record.Get(field)
+	}
+	return revision
+}
@@ -0,0 +1,712 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/breaker"
+	"pocket-app/pkg/llmjson"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/ttlcache"
+	"pocket-app/pkg/validator"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/sync/singleflight"
+)
+
+// StoryRequest holds the parameters of a story generation request
+type StoryRequest struct {
+	NChapters           int    `json:"n_chapters"`
+	StoryInstructions   string `json:"story_instructions"`
+	PrimaryCharacters   string `json:"primary_characters"`
+	SecondaryCharacters string `json:"secondary_characters"`
+	LChapter            int    `json:"l_chapter"`
+
+	// PrimaryCharacterIDs and SecondaryCharacterIDs reference characters
+	// from the user's library; they are expanded into the character text
+	// before generation
+	PrimaryCharacterIDs   []string `json:"primary_character_ids,omitempty"`
+	SecondaryCharacterIDs []string `json:"secondary_character_ids,omitempty"`
+
+	// TemplateID selects a story template whose body, rendered with
+	// Variables, becomes the story instructions. TemplateVersion and
+	// TemplateInstructions are set by the server to the version that was
+	// rendered and its rendered text, which the story keeps even after the
+	// template changes.
+	TemplateID           string            `json:"template_id,omitempty"`
+	Variables            map[string]string `json:"variables,omitempty"`
+	TemplateVersion      int               `json:"template_version,omitempty"`
+	TemplateInstructions string            `json:"template_instructions,omitempty"`
+
+	// Fresh skips the result cache and in-flight deduplication; it is
+	// always set for users with skip_story_cache
+	Fresh bool `json:"fresh,omitempty"`
+}
+
+// storyInputs are the inputs of the story graph: the request's story fields,
+// without the references and options that the server resolves itself
+type storyInputs struct {
+	NChapters           int    `json:"n_chapters"`
+	StoryInstructions   string `json:"story_instructions"`
+	PrimaryCharacters   string `json:"primary_characters"`
+	SecondaryCharacters string `json:"secondary_characters"`
+	LChapter            int    `json:"l_chapter"`
+}
+
+// inputs returns the story graph inputs of the request
+func (r StoryRequest) inputs() storyInputs {
+	return storyInputs{
+		NChapters:           r.NChapters,
+		StoryInstructions:   r.StoryInstructions,
+		PrimaryCharacters:   r.PrimaryCharacters,
+		SecondaryCharacters: r.SecondaryCharacters,
+		LChapter:            r.LChapter,
+	}
+}
+
+// Hash returns a hex SHA-256 of the request's canonical form: text fields
+// with surrounding whitespace trimmed and inner whitespace collapsed. Fresh
+// and the character and template references are not part of the hash; they
+// count through the text they expand to.
+func (r StoryRequest) Hash() string {
+	canonical := storyInputs{
+		NChapters:           r.NChapters,
+		StoryInstructions:   strings.Join(strings.Fields(r.StoryInstructions), " "),
+		PrimaryCharacters:   strings.Join(strings.Fields(r.PrimaryCharacters), " "),
+		SecondaryCharacters: strings.Join(strings.Fields(r.SecondaryCharacters), " "),
+		LChapter:            r.LChapter,
+	}
+
+	data, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// StoryChapter is a single chapter of a generated story
+type StoryChapter struct {
+	Number      int    `json:"Number"`
+	Title       string `json:"Title"`
+	Content     string `json:"Content"`
+	ImagePrompt string `json:"ImagePrompt"`
+}
+
+// Story is the structured story returned by the upstream workflow
+type Story struct {
+	Title           string         `json:"Title"`
+	Summary         string         `json:"Summary"`
+	Chapters        []StoryChapter `json:"Chapters"`
+	ThemesOrLessons []string       `json:"ThemesOrLessons"`
+}
+
+// GenerationResult is the outcome of a completed story generation
+type GenerationResult struct {
+	StatusCode         int                        `json:"-"`
+	Message            string                     `json:"message"`
+	Status             string                     `json:"status"`
+	Story              *Story                     `json:"story,omitempty"`
+	StoryText          string                     `json:"story_text,omitempty"`
+	Data               map[string]interface{}     `json:"data,omitempty"`
+	RawResponse        string                     `json:"raw_response,omitempty"`
+	ModelOutput        string                     `json:"-"` // the model's text, as the story was extracted from it
+	ParseError         string                     `json:"parse_error,omitempty"`
+	ParseNote          string                     `json:"parse_note,omitempty"`
+	ParseStrategy      string                     `json:"parse_strategy,omitempty"`
+	Info               string                     `json:"info,omitempty"`
+	Attempts           int                        `json:"attempts"`
+	StoryID            string                     `json:"story_id,omitempty"`
+	ValidationProblems validator.ValidationErrors `json:"validation_problems,omitempty"`
+	Repairs            []string                   `json:"repairs,omitempty"`
+	Cached             bool                       `json:"cached,omitempty"`
+	Shared             bool                       `json:"shared,omitempty"`
+}
+
+// clone returns a copy of the result whose story can be changed without
+// changing the original's
+func (r *GenerationResult) clone() *GenerationResult {
+	result := *r
+	if r.Story != nil {
+		story := *r.Story
+		story.Chapters = slices.Clone(r.Story.Chapters)
+		story.ThemesOrLessons = slices.Clone(r.Story.ThemesOrLessons)
+		result.Story = &story
+	}
+	return &result
+}
+
+// UpstreamError is returned when the story upstream could not produce a response
+type UpstreamError struct {
+	StatusCode     int
+	Message        string
+	UpstreamStatus int
+	Body           string
+	TargetURL      string
+	Attempts       int
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s (attempts: %d)", e.Message, e.Attempts)
+}
+
+// StoredStory is a saved story with the request that generated it
+type StoredStory struct {
+	ID      string
+	Story   Story
+	Request StoryRequest
+	Created time.Time
+	Updated time.Time
+}
+
+// ErrStoryNotFound is returned when a story does not exist or is not owned by the caller
+var ErrStoryNotFound = errors.New("story not found")
+
+// StoryService handles story generation and persistence
+type StoryService struct {
+	app        *pocketbase.PocketBase
+	config     *config.Config
+	generator  StoryGenerator
+	moderation *ModerationService
+	logs       *GenerationLogService
+	breaker    *breaker.Breaker
+	cache      *ttlcache.Cache
+	flight     singleflight.Group
+	shared     atomic.Int64
+}
+
+// NewStoryService creates a new story service
+func NewStoryService(app *pocketbase.PocketBase, cfg *config.Config, generator StoryGenerator, moderation *ModerationService, logs *GenerationLogService) *StoryService {
+	s := &StoryService{
+		app:        app,
+		config:     cfg,
+		generator:  generator,
+		moderation: moderation,
+		logs:       logs,
+	}
+	if cfg.Breaker.Enabled {
+		s.breaker = breaker.New(breaker.Settings{
+			FailureThreshold: cfg.Breaker.FailureThreshold,
+			OpenTimeout:      cfg.Breaker.OpenTimeout,
+			HalfOpenProbes:   cfg.Breaker.HalfOpenProbes,
+		})
+	}
+	if cfg.Cache.Enabled {
+		s.cache = ttlcache.New(cfg.Cache.TTL, cfg.Cache.MaxEntries)
+	}
+	return s
+}
+
+// ValidateRequest checks a generation request against the configured limits
+func (s *StoryService) ValidateRequest(req StoryRequest) validator.ValidationErrors {
+	return req.Validate(s.config.StoryLimits)
+}
+
+// Generate produces a story for the request. A valid story cached for an
+// identical request is returned without calling the upstream, and identical
+// requests that arrive while one is running share its result. Requests with
+// Fresh set always generate a new story.
+func (s *StoryService) Generate(ctx context.Context, req StoryRequest) (*GenerationResult, error) {
+	key := req.Hash()
+	if !req.Fresh {
+		if result, ok := s.cachedResult(key); ok {
+			return result, nil
+		}
+	}
+
+	if req.Fresh || !s.config.Cache.Dedupe {
+		result, err := s.generate(ctx, req)
+		if err == nil {
+			s.cacheResult(key, result)
+		}
+		return result, err
+	}
+
+	for {
+		leader := false
+		ch := s.flight.DoChan(key, func() (interface{}, error) {
+			leader = true
+			result, err := s.generate(ctx, req)
+			if err == nil {
+				s.cacheResult(key, result)
+			}
+			return result, err
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case shared := <-ch:
+			if shared.Err != nil {
+				if !leader && errors.Is(shared.Err, context.Canceled) && ctx.Err() == nil {
+					// the request that started the generation went away, start over
+					continue
+				}
+				return nil, shared.Err
+			}
+
+			// every caller gets its own copy, which it may save and change
+			result := shared.Val.(*GenerationResult).clone()
+			if !leader {
+				s.shared.Add(1)
+				result.Shared = true
+				logger.Debug("Shared an in-flight story generation")
+			}
+			return result, nil
+		}
+	}
+}
+
+// generate produces a story with the configured generator. The story is
+// repaired and validated; when problems remain, generation is retried with a
+// corrective prompt up to STORY_VALIDATION_RETRIES times. Every call to the
+// generator is recorded in the generation log.
+func (s *StoryService) generate(ctx context.Context, req StoryRequest) (*GenerationResult, error) {
+	logger.Debug("Generating story with the %s backend", s.generator.Name())
+
+	attemptReq := req
+	attempts := 0
+	for round := 0; ; round++ {
+		started := time.Now()
+		result, err := s.guard(ctx, func() (*GenerationResult, error) {
+			return s.generator.Generate(ctx, attemptReq)
+		})
+		call := GenerationCall{Generator: s.generator.Name(), Round: round, Request: attemptReq, Latency: time.Since(started)}
+		if err != nil {
+			call.Err = err
+			s.logs.Record(ctx, call)
+
+			var upstreamErr *UpstreamError
+			if errors.As(err, &upstreamErr) {
+				upstreamErr.Attempts += attempts
+			}
+			return nil, err
+		}
+
+		checkStoryResult(result, req)
+		call.Result = result
+		s.logs.Record(ctx, call)
+		attempts += result.Attempts
+		result.Attempts = attempts
+
+		if !result.ValidationProblems.HasErrors() || round >= s.config.Story.ValidationRetries {
+			return result, nil
+		}
+
+		logger.Warn("Story failed validation with %d problems, retrying with a corrective prompt", len(result.ValidationProblems))
+		attemptReq = correctiveRequest(req, result.ValidationProblems)
+	}
+}
+
+// GenerateStream produces a story and calls emit with a meta event and one
+// chapter event per chapter as soon as they are available. Generators that
+// cannot stream, and cached stories, have their complete story replayed as
+// events. Streamed stories are validated once complete but never regenerated,
+// and are not deduplicated.
+func (s *StoryService) GenerateStream(ctx context.Context, req StoryRequest, emit func(StoryEvent) error) (*GenerationResult, error) {
+	if streamer, ok := s.generator.(StoryStreamer); ok {
+		key := req.Hash()
+		if !req.Fresh {
+			if result, ok := s.cachedResult(key); ok {
+				return result, newStoryStreamParser(emit).flushStory(result.Story)
+			}
+		}
+
+		started := time.Now()
+		result, err := s.guard(ctx, func() (*GenerationResult, error) {
+			return streamer.GenerateStream(ctx, req, emit)
+		})
+		call := GenerationCall{Generator: s.generator.Name(), Request: req, Result: result, Err: err, Latency: time.Since(started)}
+		if err != nil {
+			s.logs.Record(ctx, call)
+			return nil, err
+		}
+		checkStoryResult(result, req)
+		s.logs.Record(ctx, call)
+		s.cacheResult(key, result)
+		return result, nil
+	}
+
+	result, err := s.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if result.Story != nil {
+		if err := newStoryStreamParser(emit).flushStory(result.Story); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// guard runs a generator call through the circuit breaker, failing fast with
+// a *breaker.OpenError while the upstream is considered down
+func (s *StoryService) guard(ctx context.Context, call func() (*GenerationResult, error)) (*GenerationResult, error) {
+	if s.breaker == nil {
+		return call()
+	}
+
+	if err := s.breaker.Allow(); err != nil {
+		logger.Warn("Story upstream circuit is open, rejecting generation: %v", err)
+		return nil, err
+	}
+
+	result, err := call()
+
+	var upstreamErr *UpstreamError
+	switch {
+	case err == nil:
+		s.breaker.Success()
+	case ctx.Err() != nil:
+		s.breaker.Cancel()
+	case errors.As(err, &upstreamErr) && upstreamErr.UpstreamStatus >= 400 && upstreamErr.UpstreamStatus < 500 && upstreamErr.UpstreamStatus != http.StatusTooManyRequests:
+		// the upstream is up, it rejected this particular request
+		s.breaker.Success()
+	default:
+		s.breaker.Failure(err)
+	}
+
+	return result, err
+}
+
+// cachedResult returns a copy of the cached result for a request hash
+func (s *StoryService) cachedResult(key string) (*GenerationResult, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	logger.Debug("Serving story generation from cache")
+	result := value.(*GenerationResult).clone()
+	result.Attempts = 0
+	result.Cached = true
+	return result, true
+}
+
+// cacheResult caches a copy of a valid result under a request hash
+func (s *StoryService) cacheResult(key string, result *GenerationResult) {
+	if s.cache == nil || !result.Valid() {
+		return
+	}
+
+	cached := result.clone()
+	cached.StoryID = ""
+	s.cache.Set(key, cached)
+}
+
+// UpstreamStatus returns the generator backend, the circuit breaker state and
+// the deduplication and cache counters
+func (s *StoryService) UpstreamStatus() map[string]interface{} {
+	status := map[string]interface{}{
+		"generator":       s.generator.Name(),
+		"breaker_enabled": s.breaker != nil,
+		"dedupe_enabled":  s.config.Cache.Dedupe,
+		"deduplicated":    s.shared.Load(),
+		"cache_enabled":   s.cache != nil,
+	}
+	if s.breaker != nil {
+		status["breaker"] = s.breaker.Status()
+	}
+	if s.cache != nil {
+		status["cache"] = s.cache.Stats()
+	}
+	return status
+}
+
+// parseStoryText decodes the story JSON from the model's text output
+func parseStoryText(statusCode int, valueString string, responseData map[string]interface{}, attempt int) *GenerationResult {
+	var story *Story
+	var repairs []string
+	extracted, err := llmjson.Extract(valueString)
+	if err == nil {
+		story, repairs, err = decodeStory(extracted.JSON)
+	}
+	if err != nil {
+		logger.Warn("Attempt %d: Failed to parse JSON, returning as text: %v", attempt, err)
+		result := &GenerationResult{
+			StatusCode:  statusCode,
+			Message:     "Story generation completed successfully",
+			Status:      "success",
+			StoryText:   valueString,
+			ModelOutput: valueString,
+			Data:        responseData,
+			Attempts:    attempt,
+			ParseNote:   "Story content returned as raw text (JSON parse failed)",
+			Repairs:     repairs,
+		}
+		result.ValidationProblems.Add("Story", "Upstream output is not valid story JSON: "+err.Error())
+		return result
+	}
+
+	return &GenerationResult{
+		StatusCode:    statusCode,
+		Message:       "Story generation completed successfully",
+		Status:        "success",
+		Story:         story,
+		ModelOutput:   valueString,
+		Attempts:      attempt,
+		ParseStrategy: extracted.Describe(),
+		Repairs:       repairs,
+	}
+}
+
+// SaveStory moderates a generated story and stores it and its chapters under
+// the given owner. A story flagged by moderation is stored quarantined: it
+// stays hidden from its owner until a reviewer approves it.
+func (s *StoryService) SaveStory(ctx context.Context, ownerID string, req StoryRequest, story *Story) (*core.Record, error) {
+	logger.Debug("Saving story for user %s", ownerID)
+
+	decision := s.moderation.ModerateStory(ctx, ownerID, story)
+
+	var record *core.Record
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		storiesCollection, err := txApp.FindCollectionByNameOrId("stories")
+		if err != nil {
+			return err
+		}
+		chaptersCollection, err := txApp.FindCollectionByNameOrId("story_chapters")
+		if err != nil {
+			return err
+		}
+
+		record = core.NewRecord(storiesCollection)
+		record.Set("title", story.Title)
+		record.Set("summary", story.Summary)
+		record.Set("themes", story.ThemesOrLessons)
+		record.Set("owner", ownerID)
+		record.Set("n_chapters", req.NChapters)
+		record.Set("l_chapter", req.LChapter)
+		record.Set("story_instructions", req.StoryInstructions)
+		record.Set("primary_characters", req.PrimaryCharacters)
+		record.Set("secondary_characters", req.SecondaryCharacters)
+		record.Set("characters", req.characterIDs())
+		if decision != nil && decision.Flagged() {
+			record.Set("moderation_status", ModerationQuarantined)
+		}
+		if req.TemplateID != "" {
+			// the template may have been deleted while the story was generated
+			if _, err := txApp.FindRecordById("story_templates", req.TemplateID); err == nil {
+				record.Set("template", req.TemplateID)
+			}
+			record.Set("template_version", req.TemplateVersion)
+			record.Set("template_instructions", req.TemplateInstructions)
+		}
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+		if _, err := saveRevision(txApp, record, RevisionSourceAI, ownerID, ""); err != nil {
+			return err
+		}
+
+		for _, chapter := range story.Chapters {
+			chapterRecord := core.NewRecord(chaptersCollection)
+			chapterRecord.Set("story", record.Id)
+			chapterRecord.Set("number", chapter.Number)
+			chapterRecord.Set("title", chapter.Title)
+			chapterRecord.Set("content", chapter.Content)
+			chapterRecord.Set("image_prompt", chapter.ImagePrompt)
+			if err := txApp.Save(chapterRecord); err != nil {
+				return err
+			}
+			if _, err := saveRevision(txApp, chapterRecord, RevisionSourceAI, ownerID, ""); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to save story", err)
+		return nil, err
+	}
+
+	if decision != nil {
+		decision.StoryID = record.Id
+		decision.Action = ModerationAllowed
+		if decision.Flagged() {
+			decision.Action = ModerationQuarantined
+		}
+		s.moderation.Record(decision)
+	}
+
+	return record, nil
+}
+
+// ListStories retrieves the stories owned by a user, newest first
+func (s *StoryService) ListStories(ownerID string, page, perPage int) ([]map[string]interface{}, int, error) {
+	logger.Debug("Listing stories for user %s (page %d)", ownerID, page)
+
+	records, err := s.app.FindRecordsByFilter(
+		"stories",
+		"owner = {:owner} && (moderation_status = '' || moderation_status = {:approved})",
+		"-created",
+		perPage,
+		(page-1)*perPage,
+		dbx.Params{"owner": ownerID, "approved": ModerationApproved},
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.app.CountRecords("stories", dbx.HashExp{
+		"owner":             ownerID,
+		"moderation_status": []interface{}{"", ModerationApproved},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stories := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		stories[i] = storySummaryMap(record)
+	}
+
+	return stories, int(total), nil
+}
+
+// GetStory retrieves a story with its chapters if it is owned by the user
+func (s *StoryService) GetStory(ownerID, storyID string) (map[string]interface{}, error) {
+	logger.Debug("Getting story %s for user %s", storyID, ownerID)
+
+	record, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storyWithChapters(record)
+}
+
+// storyWithChapters converts a story record and its chapters to their API representation
+func (s *StoryService) storyWithChapters(record *core.Record) (map[string]interface{}, error) {
+	chapters, err := s.findChapters(record.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	story := storySummaryMap(record)
+	storyChapters := make([]map[string]interface{}, len(chapters))
+	for i, chapter := range chapters {
+		storyChapters[i] = chapterMap(chapter)
+	}
+	story["chapters"] = storyChapters
+
+	return story, nil
+}
+
+// LoadStory loads a saved story and its chapters as a Story if it is owned by the user
+func (s *StoryService) LoadStory(ownerID, storyID string) (*StoredStory, error) {
+	record, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storedStory(record)
+}
+
+// storedStory loads the chapters of a story record and converts both to a StoredStory
+func (s *StoryService) storedStory(record *core.Record) (*StoredStory, error) {
+	chapters, err := s.findChapters(record.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &StoredStory{
+		ID: record.Id,
+		Story: Story{
+			Title:   record.GetString("title"),
+			Summary: record.GetString("summary"),
+		},
+		Request: StoryRequest{
+			NChapters:           record.GetInt("n_chapters"),
+			StoryInstructions:   record.GetString("story_instructions"),
+			PrimaryCharacters:   record.GetString("primary_characters"),
+			SecondaryCharacters: record.GetString("secondary_characters"),
+			LChapter:            record.GetInt("l_chapter"),
+		},
+		Created: record.GetDateTime("created").Time(),
+		Updated: record.GetDateTime("updated").Time(),
+	}
+	if err := record.UnmarshalJSONField("themes", &stored.Story.ThemesOrLessons); err != nil {
+		logger.Warn("Story %s has invalid themes: %v", record.Id, err)
+	}
+	for _, chapter := range chapters {
+		stored.Story.Chapters = append(stored.Story.Chapters, StoryChapter{
+			Number:      chapter.GetInt("number"),
+			Title:       chapter.GetString("title"),
+			Content:     chapter.GetString("content"),
+			ImagePrompt: chapter.GetString("image_prompt"),
+		})
+	}
+
+	return stored, nil
+}
+
+// DeleteStory deletes a story owned by the user; chapters are removed by cascade
+func (s *StoryService) DeleteStory(ownerID, storyID string) error {
+	logger.Debug("Deleting story %s for user %s", storyID, ownerID)
+
+	record, err := s.findOwnedStory(ownerID, storyID)
+	if err != nil {
+		return err
+	}
+
+	return s.app.Delete(record)
+}
+
+// findOwnedStory loads a story record and checks that it belongs to the user;
+// stories held or rejected by moderation are not found
+func (s *StoryService) findOwnedStory(ownerID, storyID string) (*core.Record, error) {
+	record, err := s.app.FindRecordById("stories", storyID)
+	if err != nil {
+		return nil, ErrStoryNotFound
+	}
+	if record.GetString("owner") != ownerID || !storyVisible(record) {
+		return nil, ErrStoryNotFound
+	}
+	return record, nil
+}
+
+// storyVisible reports whether a story may be shown to its owner: it was
+// not flagged by moderation, or a reviewer approved it
+func storyVisible(record *core.Record) bool {
+	status := record.GetString("moderation_status")
+	return status == "" || status == ModerationApproved
+}
+
+// storySummaryMap converts a story record to its API representation without chapters
+func storySummaryMap(record *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         record.Id,
+		"title":      record.GetString("title"),
+		"summary":    record.GetString("summary"),
+		"themes":     record.Get("themes"),
+		"characters": record.GetStringSlice("characters"),
+		"template": map[string]interface{}{
+			"id":           record.GetString("template"),
+			"version":      record.GetInt("template_version"),
+			"instructions": record.GetString("template_instructions"),
+		},
+		"parameters": map[string]interface{}{
+			"n_chapters":           record.GetInt("n_chapters"),
+			"l_chapter":            record.GetInt("l_chapter"),
+			"story_instructions":   record.GetString("story_instructions"),
+			"primary_characters":   record.GetString("primary_characters"),
+			"secondary_characters": record.GetString("secondary_characters"),
+		},
+		"created": record.GetDateTime("created"),
+		"updated": record.GetDateTime("updated"),
+	}
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"pocket-app/pkg/llmjson"
+)
+
+// Story stream event types
+const (
+	StoryEventMeta    = "meta"
+	StoryEventChapter = "chapter"
+	StoryEventDone    = "done"
+	StoryEventError   = "error"
+)
+
+// StoryEvent is a single event emitted while a story is being generated
+type StoryEvent struct {
+	Type string
+	Data interface{}
+}
+
+// StoryMeta is the payload of a meta event
+type StoryMeta struct {
+	Title   string `json:"Title"`
+	Summary string `json:"Summary"`
+}
+
+// maxStreamLineSize bounds a single line of an upstream event stream
+const maxStreamLineSize = 1024 * 1024
+
+var (
+	chaptersArrayRegex = regexp.MustCompile(`(?i)"chapters"\s*:\s*\[`)
+	titleFieldRegex    = regexp.MustCompile(`(?i)"title"\s*:\s*("(?:[^"\\]|\\.)*")`)
+	summaryFieldRegex  = regexp.MustCompile(`(?i)"summary"\s*:\s*("(?:[^"\\]|\\.)*")`)
+)
+
+// storyStreamParser accumulates streamed story text and emits events for the
+// parts of the story JSON that are already complete. Each scan only looks at
+// the text appended since the previous one, so a story streamed in many small
+// deltas is parsed in linear time.
+type storyStreamParser struct {
+	text         strings.Builder
+	emit         func(StoryEvent) error
+	metaSent     bool
+	metaChecked  bool
+	scanned      int
+	searchPos    int
+	chapters     jsonObjectScanner
+	chapterIndex int
+	sent         map[int]bool
+}
+
+func newStoryStreamParser(emit func(StoryEvent) error) *storyStreamParser {
+	p := &storyStreamParser{emit: emit, sent: make(map[int]bool)}
+	p.reset()
+	return p
+}
+
+// reset restarts scanning from the beginning of the text; chapters that were
+// already sent are not sent again
+func (p *storyStreamParser) reset() {
+	p.metaChecked = false
+	p.scanned = 0
+	p.searchPos = 0
+	p.chapters = jsonObjectScanner{pos: -1, start: -1}
+	p.chapterIndex = 0
+}
+
+// started reports whether any event has been emitted
+func (p *storyStreamParser) started() bool {
+	return p.metaSent || len(p.sent) > 0
+}
+
+// consume reads an upstream event stream until it ends. Each event's data is
+// either a JSON object with a "delta" text piece, a complete Rivet response
+// with an "output" value, or raw text.
+func (p *storyStreamParser) consume(body io.Reader, attempt int) (*GenerationResult, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+
+	var eventName string
+	var data []string
+
+	dispatch := func() (bool, error) {
+		defer func() {
+			eventName = ""
+			data = data[:0]
+		}()
+		if len(data) == 0 {
+			return false, nil
+		}
+
+		payload := strings.Join(data, "\n")
+		if payload == "[DONE]" {
+			return true, nil
+		}
+		if eventName == "error" {
+			return true, errors.New("upstream stream error: " + payload)
+		}
+
+		return false, p.write(payload)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			done, err := dispatch()
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				return p.finish(attempt)
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			eventName = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := dispatch(); err != nil {
+		return nil, err
+	}
+
+	return p.finish(attempt)
+}
+
+// write handles a single upstream event payload
+func (p *storyStreamParser) write(payload string) error {
+	var message map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		p.text.WriteString(payload)
+		return p.scan()
+	}
+
+	if isControlFlowExcluded(message) {
+		return errors.New("upstream returned control-flow-excluded")
+	}
+
+	if outputMap, ok := message["output"].(map[string]interface{}); ok {
+		if value, ok := outputMap["value"].(string); ok {
+			p.text.Reset()
+			p.text.WriteString(value)
+			p.reset()
+			return p.scan()
+		}
+	}
+
+	if delta, ok := message["delta"].(string); ok {
+		p.text.WriteString(delta)
+		return p.scan()
+	}
+
+	return nil
+}
+
+// scan emits the meta event and any chapter objects completed since the last scan
+func (p *storyStreamParser) scan() error {
+	text := p.text.String()
+	appended := text[p.scanned:]
+	p.scanned = len(text)
+
+	if p.chapters.pos == -1 {
+		p.findChapters(text)
+	}
+
+	// a title or summary value is only complete once its closing quote arrives
+	if !p.metaSent && !p.metaChecked && (p.chapters.pos != -1 || strings.Contains(appended, `"`)) {
+		head := text
+		if p.chapters.pos != -1 {
+			head = text[:p.chapters.pos]
+			p.metaChecked = true
+		}
+		title, hasTitle := jsonStringField(titleFieldRegex, head)
+		summary, hasSummary := jsonStringField(summaryFieldRegex, head)
+
+		if (hasTitle && hasSummary) || (p.chapters.pos != -1 && (hasTitle || hasSummary)) {
+			if err := p.emitMeta(title, summary); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.chapters.pos == -1 {
+		return nil
+	}
+
+	for {
+		object, ok := p.chapters.next(text)
+		if !ok {
+			return nil
+		}
+		index := p.chapterIndex
+		p.chapterIndex++
+
+		extracted, err := llmjson.Extract(object)
+		if err != nil {
+			continue
+		}
+		chapter, err := decodeStoryChapter(extracted.JSON)
+		if err != nil {
+			continue
+		}
+		if err := p.emitChapter(index, chapter); err != nil {
+			return err
+		}
+	}
+}
+
+// findChapters looks for the start of the chapters array in the text not
+// searched yet. A match cut off by the end of the text starts at one of its
+// last two quotes, so the next search resumes from there.
+func (p *storyStreamParser) findChapters(text string) {
+	if loc := chaptersArrayRegex.FindStringIndex(text[p.searchPos:]); loc != nil {
+		p.chapters.pos = p.searchPos + loc[1]
+		return
+	}
+
+	if last := strings.LastIndexByte(text[p.searchPos:], '"'); last != -1 {
+		if prev := strings.LastIndexByte(text[p.searchPos:p.searchPos+last], '"'); prev != -1 {
+			p.searchPos += prev
+		} else {
+			p.searchPos += last
+		}
+	} else {
+		p.searchPos = len(text)
+	}
+}
+
+// finish parses the accumulated text as a whole and emits whatever the
+// incremental scan could not
+func (p *storyStreamParser) finish(attempt int) (*GenerationResult, error) {
+	result := parseStoryText(http.StatusOK, p.text.String(), nil, attempt)
+	if result.Story != nil {
+		if err := p.flushStory(result.Story); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// flushStory emits the meta event and, in order, the chapters that have not
+// been sent yet. A chapter the incremental scan could not decode is sent here
+// even when later chapters already were.
+func (p *storyStreamParser) flushStory(story *Story) error {
+	if !p.metaSent {
+		if err := p.emitMeta(story.Title, story.Summary); err != nil {
+			return err
+		}
+	}
+	for i, chapter := range story.Chapters {
+		if err := p.emitChapter(i, chapter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *storyStreamParser) emitMeta(title, summary string) error {
+	p.metaSent = true
+	return p.emit(StoryEvent{Type: StoryEventMeta, Data: StoryMeta{Title: title, Summary: summary}})
+}
+
+// emitChapter emits the chapter at the given position in the chapters array
+// unless it has already been sent
+func (p *storyStreamParser) emitChapter(index int, chapter StoryChapter) error {
+	if p.sent[index] {
+		return nil
+	}
+	p.sent[index] = true
+	return p.emit(StoryEvent{Type: StoryEventChapter, Data: chapter})
+}
+
+// jsonStringField finds a complete JSON string value matched by the regex
+func jsonStringField(re *regexp.Regexp, text string) (string, bool) {
+	match := re.FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+
+	var value string
+	if err := json.Unmarshal([]byte(match[1]), &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// jsonObjectScanner finds consecutive JSON objects, separated by whitespace
+// and commas, in text that grows between calls. It keeps its place inside an
+// unfinished object, so every byte is read once.
+type jsonObjectScanner struct {
+	pos      int // next byte to read; -1 before the objects start
+	start    int // start of the unfinished object, or -1
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+// next returns the next complete object, or false when the text ends first
+// or something other than an object follows
+func (s *jsonObjectScanner) next(text string) (string, bool) {
+	for ; s.pos < len(text); s.pos++ {
+		c := text[s.pos]
+		if s.start == -1 {
+			if strings.ContainsRune(" \t\r\n,", rune(c)) {
+				continue
+			}
+			if c != '{' {
+				return "", false
+			}
+			s.start = s.pos
+		}
+
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case s.inString && c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.inString = !s.inString
+		case s.inString:
+		case c == '{':
+			s.depth++
+		case c == '}':
+			s.depth--
+			if s.depth == 0 {
+				object := text[s.start : s.pos+1]
+				s.start = -1
+				s.pos++
+				return object, true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const streamTestStory = `{"Title": "Pip", "Summary": "A fox finds home.", "Chapters": [` +
+	`{"Number": 1, "Title": "One", "Content": "Pip wakes.", "ImagePrompt": "a fox",},` +
+	`{"Number": 2, "Title": "Two", "Content": "Pip walks {far}.", "ImagePrompt": "a road"},` +
+	`{"Number": 3, "Title": "Three", "Content": "Pip is home.", "ImagePrompt": "a den"}` +
+	`], "ThemesOrLessons": ["home"]}`
+
+// TestStoryStreamParser streams a story through the parser and checks that
+// every chapter is emitted exactly once and in order
+func TestStoryStreamParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string // data payloads, one event each
+	}{
+		{
+			name:   "chapter deltas with a malformed chapter mid-stream",
+			events: deltaEvents(strings.SplitAfter(streamTestStory, "},")...),
+		},
+		{
+			name:   "token-sized deltas",
+			events: deltaEvents(splitEvery(streamTestStory, 3)...),
+		},
+		{
+			name: "complete output after deltas",
+			events: append(
+				deltaEvents(strings.SplitAfter(streamTestStory, "},")[:2]...),
+				outputEvent(streamTestStory),
+			),
+		},
+		{
+			name:   "raw text",
+			events: strings.SplitAfter(streamTestStory, "},"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body strings.Builder
+			for _, event := range tt.events {
+				fmt.Fprintf(&body, "data: %s\n\n", event)
+			}
+			body.WriteString("data: [DONE]\n\n")
+
+			var got []string
+			parser := newStoryStreamParser(func(event StoryEvent) error {
+				switch data := event.Data.(type) {
+				case StoryMeta:
+					got = append(got, "meta:"+data.Title)
+				case StoryChapter:
+					got = append(got, fmt.Sprintf("%d:%s", data.Number, data.Title))
+				}
+				return nil
+			})
+
+			result, err := parser.consume(strings.NewReader(body.String()), 1)
+			if err != nil {
+				t.Fatalf("consume: %v", err)
+			}
+			if result.Story == nil {
+				t.Fatalf("no story parsed: %s", result.ParseNote)
+			}
+
+			want := []string{"meta:Pip", "1:One", "2:Two", "3:Three"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("events = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestStoryStreamParserFlush checks that a chapter the incremental scan
+// skipped is sent by flushStory without resending the chapters after it
+func TestStoryStreamParserFlush(t *testing.T) {
+	var got []int
+	parser := newStoryStreamParser(func(event StoryEvent) error {
+		if chapter, ok := event.Data.(StoryChapter); ok {
+			got = append(got, chapter.Number)
+		}
+		return nil
+	})
+
+	story := &Story{Title: "Pip", Summary: "A fox finds home."}
+	for i := 1; i <= 4; i++ {
+		story.Chapters = append(story.Chapters, StoryChapter{Number: i, Title: fmt.Sprint(i), Content: "text"})
+	}
+	for _, i := range []int{1, 2} {
+		if err := parser.emitChapter(i, story.Chapters[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := parser.flushStory(story); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2, 3, 1, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chapters = %v, want %v", got, want)
+	}
+}
+
+func deltaEvents(pieces ...string) []string {
+	events := make([]string, len(pieces))
+	for i, piece := range pieces {
+		data, _ := json.Marshal(map[string]string{"delta": piece})
+		events[i] = string(data)
+	}
+	return events
+}
+
+func outputEvent(text string) string {
+	data, _ := json.Marshal(map[string]interface{}{"output": map[string]string{"type": "string", "value": text}})
+	return string(data)
+}
+
+func splitEvery(text string, n int) []string {
+	var pieces []string
+	for len(text) > n {
+		pieces = append(pieces, text[:n])
+		text = text[n:]
+	}
+	return append(pieces, text)
+}
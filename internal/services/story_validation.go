@@ -0,0 +1,284 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/validator"
+)
+
+// storyKeys maps normalized story keys to their canonical names
+var storyKeys = map[string]string{
+	"title":            "Title",
+	"storytitle":       "Title",
+	"summary":          "Summary",
+	"chapters":         "Chapters",
+	"themesorlessons":  "ThemesOrLessons",
+	"themesandlessons": "ThemesOrLessons",
+	"themes":           "ThemesOrLessons",
+	"lessons":          "ThemesOrLessons",
+}
+
+// chapterKeys maps normalized chapter keys to their canonical names
+var chapterKeys = map[string]string{
+	"number":               "Number",
+	"chapternumber":        "Number",
+	"chapter":              "Number",
+	"title":                "Title",
+	"subtitle":             "Title",
+	"chaptertitle":         "Title",
+	"content":              "Content",
+	"text":                 "Content",
+	"body":                 "Content",
+	"imageprompt":          "ImagePrompt",
+	"suggestedimageprompt": "ImagePrompt",
+	"image":                "ImagePrompt",
+}
+
+// decodeStory decodes story JSON, normalizing key casing and spelling and
+// coercing loosely typed values. It returns the repairs it made.
+func decodeStory(text string) (*Story, []string, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, nil, err
+	}
+
+	var repairs []string
+	normalized := normalizeKeys(raw, storyKeys, "", &repairs)
+
+	if themes, ok := normalized["ThemesOrLessons"].(string); ok {
+		normalized["ThemesOrLessons"] = []interface{}{themes}
+		repairs = append(repairs, "converted ThemesOrLessons to a list")
+	}
+
+	chapters, ok := normalized["Chapters"].([]interface{})
+	if !ok && normalized["Chapters"] != nil {
+		return nil, repairs, errors.New("Chapters is not a list")
+	}
+	for i, item := range chapters {
+		chapter, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, repairs, fmt.Errorf("Chapters[%d] is not an object", i)
+		}
+		chapters[i] = normalizeChapter(chapter, fmt.Sprintf("Chapters[%d].", i), &repairs)
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, repairs, err
+	}
+	var story Story
+	if err := json.Unmarshal(data, &story); err != nil {
+		return nil, repairs, err
+	}
+	return &story, repairs, nil
+}
+
+// decodeStoryChapter decodes a single chapter object with the same key
+// normalization as decodeStory
+func decodeStoryChapter(text string) (StoryChapter, error) {
+	var chapter StoryChapter
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return chapter, err
+	}
+
+	var repairs []string
+	data, err := json.Marshal(normalizeChapter(raw, "", &repairs))
+	if err != nil {
+		return chapter, err
+	}
+	err = json.Unmarshal(data, &chapter)
+	return chapter, err
+}
+
+// normalizeChapter normalizes chapter keys and converts a numeric string
+// chapter number to a number
+func normalizeChapter(raw map[string]interface{}, path string, repairs *[]string) map[string]interface{} {
+	chapter := normalizeKeys(raw, chapterKeys, path, repairs)
+
+	if number, ok := chapter["Number"].(string); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(number)); err == nil {
+			chapter["Number"] = n
+			*repairs = append(*repairs, fmt.Sprintf("converted %sNumber to a number", path))
+		} else {
+			delete(chapter, "Number")
+		}
+	}
+	return chapter
+}
+
+// normalizeKeys renames known keys to their canonical names; a key that is
+// already canonical wins over a variant of it
+func normalizeKeys(raw map[string]interface{}, keys map[string]string, path string, repairs *[]string) map[string]interface{} {
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	normalized := make(map[string]interface{}, len(raw))
+	for _, name := range names {
+		canonical, ok := keys[normalizeKey(name)]
+		if !ok || canonical == name {
+			normalized[name] = raw[name]
+			continue
+		}
+		if _, exists := raw[canonical]; exists {
+			continue
+		}
+		if _, exists := normalized[canonical]; exists {
+			continue
+		}
+		normalized[canonical] = raw[name]
+		*repairs = append(*repairs, fmt.Sprintf("renamed %s%s to %s", path, name, canonical))
+	}
+	return normalized
+}
+
+// normalizeKey lower-cases a key and drops everything but letters and digits
+func normalizeKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Validate checks a generation request against the configured limits
+func (r StoryRequest) Validate(limits config.StoryLimitsConfig) validator.ValidationErrors {
+	v := validator.New()
+
+	v.Range("n_chapters", r.NChapters, limits.MinChapters, limits.MaxChapters,
+		fmt.Sprintf("Number of chapters must be between %d and %d", limits.MinChapters, limits.MaxChapters))
+	v.Range("l_chapter", r.LChapter, limits.MinChapterLength, limits.MaxChapterLength,
+		fmt.Sprintf("Chapter length must be between %d and %d words", limits.MinChapterLength, limits.MaxChapterLength))
+
+	v.Required("story_instructions", r.StoryInstructions, "Story instructions are required")
+	v.Custom("story_instructions", utf8.RuneCountInString(r.StoryInstructions) <= limits.MaxInstructionsLength,
+		fmt.Sprintf("Story instructions must be at most %d characters", limits.MaxInstructionsLength))
+	v.Custom("primary_characters", utf8.RuneCountInString(r.PrimaryCharacters) <= limits.MaxCharactersLength,
+		fmt.Sprintf("Primary characters must be at most %d characters", limits.MaxCharactersLength))
+	v.Custom("secondary_characters", utf8.RuneCountInString(r.SecondaryCharacters) <= limits.MaxCharactersLength,
+		fmt.Sprintf("Secondary characters must be at most %d characters", limits.MaxCharactersLength))
+	v.Custom("primary_character_ids", len(r.PrimaryCharacterIDs) <= maxCharacterRefs,
+		fmt.Sprintf("At most %d primary characters can be referenced", maxCharacterRefs))
+	v.Custom("secondary_character_ids", len(r.SecondaryCharacterIDs) <= maxCharacterRefs,
+		fmt.Sprintf("At most %d secondary characters can be referenced", maxCharacterRefs))
+
+	return v.Errors()
+}
+
+// Repair fixes problems that do not need a new generation: it trims text,
+// drops empty chapters and renumbers chapters in order. It returns the repairs
+// it made.
+func (s *Story) Repair() []string {
+	var repairs []string
+
+	s.Title = strings.TrimSpace(s.Title)
+	s.Summary = strings.TrimSpace(s.Summary)
+
+	chapters := make([]StoryChapter, 0, len(s.Chapters))
+	for i, chapter := range s.Chapters {
+		chapter.Title = strings.TrimSpace(chapter.Title)
+		chapter.Content = strings.TrimSpace(chapter.Content)
+		chapter.ImagePrompt = strings.TrimSpace(chapter.ImagePrompt)
+		if chapter.Title == "" && chapter.Content == "" && chapter.ImagePrompt == "" {
+			repairs = append(repairs, fmt.Sprintf("dropped empty chapter at position %d", i+1))
+			continue
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	for i := range chapters {
+		if chapters[i].Number != i+1 {
+			repairs = append(repairs, fmt.Sprintf("renumbered chapter %d to %d", chapters[i].Number, i+1))
+			chapters[i].Number = i + 1
+		}
+	}
+	s.Chapters = chapters
+
+	return repairs
+}
+
+// Validate checks the story against the requested chapter count. Chapters
+// must be numbered 1..n in order and have a title and content.
+func (s *Story) Validate(nChapters int) validator.ValidationErrors {
+	v := validator.New()
+
+	v.Required("Title", s.Title, "Story title is required")
+	v.Required("Summary", s.Summary, "Story summary is required")
+
+	if nChapters > 0 {
+		v.Custom("Chapters", len(s.Chapters) == nChapters,
+			fmt.Sprintf("Expected %d chapters, got %d", nChapters, len(s.Chapters)))
+	} else {
+		v.Custom("Chapters", len(s.Chapters) > 0, "Story has no chapters")
+	}
+
+	for i, chapter := range s.Chapters {
+		field := fmt.Sprintf("Chapters[%d]", i)
+		v.Custom(field+".Number", chapter.Number == i+1,
+			fmt.Sprintf("Chapter number %d is out of sequence, expected %d", chapter.Number, i+1))
+		v.Required(field+".Title", chapter.Title, "Chapter title is required")
+		v.Required(field+".Content", chapter.Content, "Chapter content is required")
+	}
+
+	return v.Errors()
+}
+
+// Valid reports whether the result holds a story that passed validation
+func (r *GenerationResult) Valid() bool {
+	return r.Story != nil && !r.ValidationProblems.HasErrors()
+}
+
+// checkStoryResult repairs and validates the story of a successful result.
+// A result without a story is reported as a validation problem rather than
+// passed on as plain text.
+func checkStoryResult(result *GenerationResult, req StoryRequest) {
+	if result.Status != "success" {
+		return
+	}
+
+	if result.Story != nil {
+		result.Repairs = append(result.Repairs, result.Story.Repair()...)
+		result.ValidationProblems = result.Story.Validate(req.NChapters)
+	} else if !result.ValidationProblems.HasErrors() {
+		result.ValidationProblems.Add("Story", "Upstream output is not valid story JSON")
+	}
+
+	if result.ValidationProblems.HasErrors() {
+		result.Status = "invalid"
+		result.Message = "Story generation completed but the story failed validation"
+	}
+}
+
+// correctiveRequest returns the request with instructions that tell the model
+// what was wrong with its previous answer
+func correctiveRequest(req StoryRequest, problems validator.ValidationErrors) StoryRequest {
+	var b strings.Builder
+
+	b.WriteString(req.StoryInstructions)
+	b.WriteString("\n\nYour previous answer was rejected because of these problems:\n")
+	for _, problem := range problems {
+		fmt.Fprintf(&b, "- %s: %s\n", problem.Field, problem.Message)
+	}
+	if req.NChapters > 0 {
+		fmt.Fprintf(&b, "Return only valid JSON with exactly %d chapters numbered 1 to %d, each with a non-empty Title and Content.", req.NChapters, req.NChapters)
+	} else {
+		b.WriteString("Return only valid JSON with chapters numbered from 1, each with a non-empty Title and Content.")
+	}
+
+	corrected := req
+	corrected.StoryInstructions = b.String()
+	return corrected
+}
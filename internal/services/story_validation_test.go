@@ -0,0 +1,267 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"pocket-app/pkg/validator"
+)
+
+func TestDecodeStory(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		want        *Story
+		wantRepairs []string
+		wantErr     string
+	}{
+		{
+			name: "canonical keys",
+			text: `{"Title": "Pip", "Summary": "A fox.", "Chapters": [{"Number": 1, "Title": "One", "Content": "Text.", "ImagePrompt": "a fox"}], "ThemesOrLessons": ["home"]}`,
+			want: &Story{
+				Title: "Pip", Summary: "A fox.",
+				Chapters:        []StoryChapter{{Number: 1, Title: "One", Content: "Text.", ImagePrompt: "a fox"}},
+				ThemesOrLessons: []string{"home"},
+			},
+		},
+		{
+			name: "key variants",
+			text: `{"story_title": "Pip", "summary": "A fox.", "chapters": [{"chapter_number": 1, "chapter title": "One", "text": "Text.", "Suggested Image Prompt": "a fox"}], "themes": ["home"]}`,
+			want: &Story{
+				Title: "Pip", Summary: "A fox.",
+				Chapters:        []StoryChapter{{Number: 1, Title: "One", Content: "Text.", ImagePrompt: "a fox"}},
+				ThemesOrLessons: []string{"home"},
+			},
+			wantRepairs: []string{
+				"renamed chapters to Chapters",
+				"renamed story_title to Title",
+				"renamed summary to Summary",
+				"renamed themes to ThemesOrLessons",
+				"renamed Chapters[0].Suggested Image Prompt to ImagePrompt",
+				"renamed Chapters[0].chapter title to Title",
+				"renamed Chapters[0].chapter_number to Number",
+				"renamed Chapters[0].text to Content",
+			},
+		},
+		{
+			name: "canonical key wins over a variant",
+			text: `{"Title": "Pip", "title": "Other", "Chapters": []}`,
+			want: &Story{Title: "Pip", Chapters: []StoryChapter{}},
+		},
+		{
+			name: "loosely typed values",
+			text: `{"Title": "Pip", "Chapters": [{"Number": " 2 ", "Title": "Two"}, {"Number": "two", "Title": "Bad"}], "ThemesOrLessons": "home"}`,
+			want: &Story{
+				Title:           "Pip",
+				Chapters:        []StoryChapter{{Number: 2, Title: "Two"}, {Title: "Bad"}},
+				ThemesOrLessons: []string{"home"},
+			},
+			wantRepairs: []string{
+				"converted ThemesOrLessons to a list",
+				"converted Chapters[0].Number to a number",
+			},
+		},
+		{
+			name:    "chapters not a list",
+			text:    `{"Title": "Pip", "Chapters": "none"}`,
+			wantErr: "Chapters is not a list",
+		},
+		{
+			name:    "chapter not an object",
+			text:    `{"Title": "Pip", "Chapters": ["one"]}`,
+			wantErr: "Chapters[0] is not an object",
+		},
+		{
+			name:    "not JSON",
+			text:    `Once upon a time`,
+			wantErr: "invalid character",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			story, repairs, err := decodeStory(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeStory() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeStory() error = %v", err)
+			}
+			if !reflect.DeepEqual(story, tt.want) {
+				t.Errorf("story = %+v, want %+v", story, tt.want)
+			}
+			if !reflect.DeepEqual(repairs, tt.wantRepairs) {
+				t.Errorf("repairs = %q, want %q", repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
+
+func TestStoryRepair(t *testing.T) {
+	tests := []struct {
+		name         string
+		chapters     []StoryChapter
+		wantChapters []StoryChapter
+		wantRepairs  []string
+	}{
+		{
+			name:         "already in order",
+			chapters:     []StoryChapter{{Number: 1, Title: "One", Content: "a"}, {Number: 2, Title: "Two", Content: "b"}},
+			wantChapters: []StoryChapter{{Number: 1, Title: "One", Content: "a"}, {Number: 2, Title: "Two", Content: "b"}},
+		},
+		{
+			name:         "trims text",
+			chapters:     []StoryChapter{{Number: 1, Title: " One ", Content: "\na\n", ImagePrompt: " fox "}},
+			wantChapters: []StoryChapter{{Number: 1, Title: "One", Content: "a", ImagePrompt: "fox"}},
+		},
+		{
+			name:         "drops empty chapters and renumbers",
+			chapters:     []StoryChapter{{Number: 1, Title: "One", Content: "a"}, {Number: 2, Title: "  "}, {Number: 3, Title: "Three", Content: "c"}},
+			wantChapters: []StoryChapter{{Number: 1, Title: "One", Content: "a"}, {Number: 2, Title: "Three", Content: "c"}},
+			wantRepairs:  []string{"dropped empty chapter at position 2", "renumbered chapter 3 to 2"},
+		},
+		{
+			name:         "renumbers missing and zero-based numbers",
+			chapters:     []StoryChapter{{Number: 0, Title: "One", Content: "a"}, {Number: 0, Title: "Two", Content: "b"}},
+			wantChapters: []StoryChapter{{Number: 1, Title: "One", Content: "a"}, {Number: 2, Title: "Two", Content: "b"}},
+			wantRepairs:  []string{"renumbered chapter 0 to 1", "renumbered chapter 0 to 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			story := &Story{Title: " Pip ", Summary: "A fox. ", Chapters: tt.chapters}
+			repairs := story.Repair()
+
+			if story.Title != "Pip" || story.Summary != "A fox." {
+				t.Errorf("title, summary = %q, %q; want them trimmed", story.Title, story.Summary)
+			}
+			if !reflect.DeepEqual(story.Chapters, tt.wantChapters) {
+				t.Errorf("chapters = %+v, want %+v", story.Chapters, tt.wantChapters)
+			}
+			if !reflect.DeepEqual(repairs, tt.wantRepairs) {
+				t.Errorf("repairs = %q, want %q", repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
+
+func TestStoryValidate(t *testing.T) {
+	valid := func() *Story {
+		return &Story{
+			Title:    "Pip",
+			Summary:  "A fox.",
+			Chapters: []StoryChapter{{Number: 1, Title: "One", Content: "a"}, {Number: 2, Title: "Two", Content: "b"}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		story      func() *Story
+		nChapters  int
+		wantFields []string
+	}{
+		{
+			name:      "valid",
+			story:     valid,
+			nChapters: 2,
+		},
+		{
+			name:      "any chapter count when none was requested",
+			story:     valid,
+			nChapters: 0,
+		},
+		{
+			name:       "wrong chapter count",
+			story:      valid,
+			nChapters:  3,
+			wantFields: []string{"Chapters"},
+		},
+		{
+			name:       "no chapters",
+			story:      func() *Story { return &Story{Title: "Pip", Summary: "A fox."} },
+			wantFields: []string{"Chapters"},
+		},
+		{
+			name: "missing title, summary and chapter text",
+			story: func() *Story {
+				s := valid()
+				s.Title, s.Summary = "", ""
+				s.Chapters[1].Title, s.Chapters[1].Content = "", ""
+				return s
+			},
+			nChapters:  2,
+			wantFields: []string{"Title", "Summary", "Chapters[1].Title", "Chapters[1].Content"},
+		},
+		{
+			name: "chapter out of sequence",
+			story: func() *Story {
+				s := valid()
+				s.Chapters[0].Number = 2
+				return s
+			},
+			nChapters:  2,
+			wantFields: []string{"Chapters[0].Number"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, problem := range tt.story().Validate(tt.nChapters) {
+				fields = append(fields, problem.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("problem fields = %q, want %q", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestCorrectiveRequest(t *testing.T) {
+	var problems validator.ValidationErrors
+	problems.Add("Chapters", "Expected 3 chapters, got 2")
+	problems.Add("Chapters[1].Title", "Chapter title is required")
+
+	tests := []struct {
+		name      string
+		nChapters int
+		wantTail  string
+	}{
+		{
+			name:      "requested chapter count",
+			nChapters: 3,
+			wantTail:  "Return only valid JSON with exactly 3 chapters numbered 1 to 3, each with a non-empty Title and Content.",
+		},
+		{
+			name:     "no chapter count",
+			wantTail: "Return only valid JSON with chapters numbered from 1, each with a non-empty Title and Content.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := StoryRequest{StoryInstructions: "A fox finds home.", NChapters: tt.nChapters, LChapter: 100}
+			corrected := correctiveRequest(req, problems)
+
+			want := "A fox finds home.\n\n" +
+				"Your previous answer was rejected because of these problems:\n" +
+				"- Chapters: Expected 3 chapters, got 2\n" +
+				"- Chapters[1].Title: Chapter title is required\n" +
+				tt.wantTail
+			if corrected.StoryInstructions != want {
+				t.Errorf("instructions = %q, want %q", corrected.StoryInstructions, want)
+			}
+			if req.StoryInstructions != "A fox finds home." {
+				t.Error("correctiveRequest changed the original request")
+			}
+			if corrected.NChapters != req.NChapters || corrected.LChapter != req.LChapter {
+				t.Errorf("corrected request changed other fields: %+v", corrected)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/validator"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Story template limits
+const (
+	maxTemplateVariables      = 20
+	maxTemplateVariableLength = 1000
+)
+
+// templateVariableName matches names usable as {{.name}} in a template body
+var templateVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// templateVersionFields are the fields whose changes produce a new template version
+var templateVersionFields = []string{"body", "n_chapters", "l_chapter", "variables"}
+
+// TemplateVariable is a variable a story template accepts
+type TemplateVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+// TemplateService renders story templates: named presets whose text/template
+// body produces the story instructions of a request
+type TemplateService struct {
+	app    *pocketbase.PocketBase
+	config *config.Config
+}
+
+// NewTemplateService creates a new template service
+func NewTemplateService(app *pocketbase.PocketBase, cfg *config.Config) *TemplateService {
+	return &TemplateService{
+		app:    app,
+		config: cfg,
+	}
+}
+
+// Validate checks that a template record's body parses and its variables are well formed
+func (s *TemplateService) Validate(record *core.Record) validator.ValidationErrors {
+	v := validator.New()
+
+	if _, err := parseStoryTemplate(record); err != nil {
+		v.Custom("body", false, "Template body does not parse: "+err.Error())
+	}
+
+	var variables []TemplateVariable
+	if err := unmarshalOptionalJSON(record, "variables", &variables); err != nil {
+		v.Custom("variables", false, `Variables must be a list of {"name", "description", "required", "default"} objects`)
+		return v.Errors()
+	}
+	v.Custom("variables", len(variables) <= maxTemplateVariables,
+		fmt.Sprintf("A template can have at most %d variables", maxTemplateVariables))
+	seen := make(map[string]bool, len(variables))
+	for _, variable := range variables {
+		if !templateVariableName.MatchString(variable.Name) {
+			v.Custom("variables", false, fmt.Sprintf("Variable name %q must be a letter or underscore followed by letters, digits or underscores", variable.Name))
+			break
+		}
+		if seen[variable.Name] {
+			v.Custom("variables", false, fmt.Sprintf("Variable %q is declared twice", variable.Name))
+			break
+		}
+		seen[variable.Name] = true
+	}
+
+	return v.Errors()
+}
+
+// RegisterHooks keeps template versions current: a new template starts at
+// version 1 and every change to its body, defaults or variables adds one
+func (s *TemplateService) RegisterHooks() {
+	s.app.OnRecordCreate("story_templates").BindFunc(func(e *core.RecordEvent) error {
+		e.Record.Set("version", 1)
+		return e.Next()
+	})
+
+	s.app.OnRecordUpdate("story_templates").BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+		version := original.GetInt("version")
+		for _, field := range templateVersionFields {
+			if fmt.Sprint(e.Record.Get(field)) != fmt.Sprint(original.Get(field)) {
+				version++
+				break
+			}
+		}
+		e.Record.Set("version", version)
+		return e.Next()
+	})
+}
+
+// Apply renders the template a request references into its story
+// instructions; instructions sent with the request are appended to the
+// rendered text. The template's chapter count and length fill in values the
+// request leaves out, and the template version and its rendered text are
+// recorded on the request.
+// Requests without a template are left unchanged.
+func (s *TemplateService) Apply(req *StoryRequest) (validator.ValidationErrors, error) {
+	req.TemplateVersion = 0
+	req.TemplateInstructions = ""
+	if req.TemplateID == "" {
+		return nil, nil
+	}
+
+	v := validator.New()
+
+	record, err := s.app.FindRecordById("story_templates", req.TemplateID)
+	if err != nil {
+		v.Custom("template_id", false, "Story template not found")
+		return v.Errors(), nil
+	}
+
+	instructions, errs := renderStoryTemplate(record, req.Variables)
+	if errs.HasErrors() {
+		return errs, nil
+	}
+	req.TemplateInstructions = instructions
+	if extra := strings.TrimSpace(req.StoryInstructions); extra != "" {
+		instructions += "\n\n" + extra
+	}
+
+	req.StoryInstructions = instructions
+	if req.NChapters == 0 {
+		req.NChapters = record.GetInt("n_chapters")
+	}
+	if req.LChapter == 0 {
+		req.LChapter = record.GetInt("l_chapter")
+	}
+	req.TemplateVersion = record.GetInt("version")
+
+	return nil, nil
+}
+
+// Render previews a template with the given variables and returns the
+// request it would produce
+func (s *TemplateService) Render(templateID string, variables map[string]string) (*StoryRequest, validator.ValidationErrors, error) {
+	req := &StoryRequest{TemplateID: templateID, Variables: variables}
+	errs, err := s.Apply(req)
+	if err != nil || errs.HasErrors() {
+		return nil, errs, err
+	}
+	return req, nil, nil
+}
+
+// renderStoryTemplate executes a template body with the request variables,
+// after checking them against the variables the template declares
+func renderStoryTemplate(record *core.Record, values map[string]string) (string, validator.ValidationErrors) {
+	v := validator.New()
+
+	var variables []TemplateVariable
+	if err := unmarshalOptionalJSON(record, "variables", &variables); err != nil {
+		v.Custom("template_id", false, "Story template has invalid variables")
+		return "", v.Errors()
+	}
+
+	declared := make(map[string]bool, len(variables))
+	data := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		declared[variable.Name] = true
+		value := strings.TrimSpace(values[variable.Name])
+		if value == "" {
+			value = variable.Default
+		}
+		v.Custom("variables."+variable.Name, !variable.Required || value != "",
+			fmt.Sprintf("Variable %q is required", variable.Name))
+		v.Custom("variables."+variable.Name, utf8.RuneCountInString(value) <= maxTemplateVariableLength,
+			fmt.Sprintf("Variable %q must be at most %d characters", variable.Name, maxTemplateVariableLength))
+		data[variable.Name] = value
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v.Custom("variables."+name, declared[name], fmt.Sprintf("Variable %q is not accepted by this template", name))
+	}
+	if v.HasErrors() {
+		return "", v.Errors()
+	}
+
+	tmpl, err := parseStoryTemplate(record)
+	if err != nil {
+		v.Custom("template_id", false, "Story template does not parse: "+err.Error())
+		return "", v.Errors()
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		v.Custom("template_id", false, "Story template could not be rendered: "+err.Error())
+		return "", v.Errors()
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// parseStoryTemplate parses a template body; variables the body uses but
+// the request does not set render as empty text
+func parseStoryTemplate(record *core.Record) (*template.Template, error) {
+	return template.New(record.GetString("name")).
+		Option("missingkey=zero").
+		Parse(record.GetString("body"))
+}
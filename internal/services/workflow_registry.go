@@ -0,0 +1,314 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/retry"
+	"pocket-app/pkg/validator"
+)
+
+// Workflow backends
+const (
+	WorkflowBackendHTTP = "http"
+	WorkflowBackendCLI  = "cli"
+)
+
+// Workflow access levels; superusers can run every workflow
+const (
+	WorkflowAuthPublic    = "public"
+	WorkflowAuthUser      = "user"
+	WorkflowAuthSuperuser = "superuser"
+)
+
+// Workflow input types
+const (
+	WorkflowInputString  = "string"
+	WorkflowInputNumber  = "number"
+	WorkflowInputInteger = "integer"
+	WorkflowInputBoolean = "boolean"
+	WorkflowInputObject  = "object"
+	WorkflowInputArray   = "array"
+)
+
+// workflowName matches the names usable in /api/workflows/{name}/run
+var workflowName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,99}$`)
+
+// WorkflowInput describes an input a workflow accepts
+type WorkflowInput struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	MaxLength   int      `json:"max_length,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// WorkflowRetry overrides the default retry policy of a workflow
+type WorkflowRetry struct {
+	Attempts int    `json:"attempts,omitempty"`
+	Delay    string `json:"delay,omitempty"`
+	MaxDelay string `json:"max_delay,omitempty"`
+}
+
+// Workflow is a registered Rivet workflow: where it runs, what inputs it
+// takes, how patiently it is retried and who may run it
+type Workflow struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Backend     string                   `json:"backend"`
+	URL         string                   `json:"url,omitempty"`
+	Graph       string                   `json:"graph,omitempty"`
+	Inputs      map[string]WorkflowInput `json:"inputs,omitempty"`
+	Timeout     string                   `json:"timeout,omitempty"`
+	Retry       WorkflowRetry            `json:"retry,omitempty"`
+	Auth        string                   `json:"auth,omitempty"`
+	// Users limits a "user" workflow to these user ids or emails
+	Users []string `json:"users,omitempty"`
+
+	policy retry.Policy
+}
+
+// Policy returns the retry policy of the workflow; each attempt is bounded
+// by the workflow timeout
+func (w *Workflow) Policy() retry.Policy {
+	return w.policy
+}
+
+// ValidateInputs checks run inputs against the workflow's input schema.
+// Workflows without a schema accept any inputs.
+func (w *Workflow) ValidateInputs(inputs map[string]interface{}) validator.ValidationErrors {
+	if len(w.Inputs) == 0 {
+		return nil
+	}
+
+	v := validator.New()
+
+	names := make([]string, 0, len(w.Inputs))
+	for name := range w.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		input := w.Inputs[name]
+		field := "inputs." + name
+		value, ok := inputs[name]
+		if !ok || value == nil {
+			v.Custom(field, !input.Required, fmt.Sprintf("Input %q is required", name))
+			continue
+		}
+		if !workflowInputHasType(value, input.Type) {
+			v.Custom(field, false, fmt.Sprintf("Input %q must be of type %s", name, input.Type))
+			continue
+		}
+		if text, ok := value.(string); ok {
+			if input.Required {
+				v.Custom(field, strings.TrimSpace(text) != "", fmt.Sprintf("Input %q is required", name))
+			}
+			if input.MaxLength > 0 {
+				v.Custom(field, utf8.RuneCountInString(text) <= input.MaxLength,
+					fmt.Sprintf("Input %q must be at most %d characters", name, input.MaxLength))
+			}
+			if len(input.Enum) > 0 {
+				v.Custom(field, slices.Contains(input.Enum, text),
+					fmt.Sprintf("Input %q must be one of: %s", name, strings.Join(input.Enum, ", ")))
+			}
+		}
+	}
+
+	unknown := make([]string, 0)
+	for name := range inputs {
+		if _, ok := w.Inputs[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		v.Custom("inputs."+name, false, fmt.Sprintf("Input %q is not accepted by this workflow", name))
+	}
+
+	return v.Errors()
+}
+
+// WorkflowRegistry holds the workflows that can be run through the API
+type WorkflowRegistry struct {
+	workflows map[string]*Workflow
+	names     []string
+}
+
+// LoadWorkflowRegistry reads the registry from WORKFLOWS_FILE, a JSON object
+// mapping workflow names to their definitions. Without a file, the
+// RIVET_WORKFLOW_* graphs are registered as HTTP workflows at
+// STORY_API_URL/<name> that only superusers can run.
+func LoadWorkflowRegistry(cfg *config.Config) (*WorkflowRegistry, error) {
+	definitions := make(map[string]*Workflow)
+
+	if cfg.Workflows.File != "" {
+		data, err := os.ReadFile(cfg.Workflows.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read workflow registry: %w", err)
+		}
+		if err := json.Unmarshal(data, &definitions); err != nil {
+			return nil, fmt.Errorf("invalid workflow registry %s: %w", cfg.Workflows.File, err)
+		}
+	} else {
+		for _, name := range cfg.Workflows.Defaults {
+			definitions[name] = &Workflow{
+				Backend: WorkflowBackendHTTP,
+				Auth:    WorkflowAuthSuperuser,
+			}
+		}
+	}
+
+	registry := &WorkflowRegistry{workflows: make(map[string]*Workflow, len(definitions))}
+	for name, workflow := range definitions {
+		if workflow == nil {
+			workflow = &Workflow{}
+		}
+		workflow.Name = name
+		if err := workflow.init(cfg); err != nil {
+			return nil, fmt.Errorf("workflow %q: %w", name, err)
+		}
+		registry.workflows[name] = workflow
+		registry.names = append(registry.names, name)
+	}
+	sort.Strings(registry.names)
+
+	return registry, nil
+}
+
+// Get returns a workflow by name
+func (r *WorkflowRegistry) Get(name string) (*Workflow, bool) {
+	workflow, ok := r.workflows[name]
+	return workflow, ok
+}
+
+// List returns the registered workflows by name
+func (r *WorkflowRegistry) List() []*Workflow {
+	workflows := make([]*Workflow, len(r.names))
+	for i, name := range r.names {
+		workflows[i] = r.workflows[name]
+	}
+	return workflows
+}
+
+// init checks a workflow definition and fills in its defaults
+func (w *Workflow) init(cfg *config.Config) error {
+	if !workflowName.MatchString(w.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits, dashes or underscores")
+	}
+
+	if w.Backend == "" {
+		w.Backend = WorkflowBackendHTTP
+	}
+	if w.Graph == "" && (w.Backend == WorkflowBackendCLI || w.URL == "") {
+		w.Graph = w.Name
+	}
+	switch w.Backend {
+	case WorkflowBackendHTTP:
+		if w.URL == "" {
+			w.URL = strings.TrimRight(cfg.Story.APIURL, "/") + "/" + w.Graph
+		}
+	case WorkflowBackendCLI:
+		if w.URL != "" {
+			return fmt.Errorf("url is not used by the cli backend")
+		}
+	default:
+		return fmt.Errorf("unknown backend %q (expected http or cli)", w.Backend)
+	}
+
+	if w.Auth == "" {
+		w.Auth = WorkflowAuthSuperuser
+	}
+	switch w.Auth {
+	case WorkflowAuthPublic, WorkflowAuthUser, WorkflowAuthSuperuser:
+	default:
+		return fmt.Errorf("unknown auth %q (expected public, user or superuser)", w.Auth)
+	}
+	if len(w.Users) > 0 && w.Auth != WorkflowAuthUser {
+		return fmt.Errorf("users can only be listed for user workflows")
+	}
+
+	for name, input := range w.Inputs {
+		switch input.Type {
+		case WorkflowInputString, WorkflowInputNumber, WorkflowInputInteger,
+			WorkflowInputBoolean, WorkflowInputObject, WorkflowInputArray:
+		default:
+			return fmt.Errorf("input %q has unknown type %q", name, input.Type)
+		}
+		if (input.MaxLength > 0 || len(input.Enum) > 0) && input.Type != WorkflowInputString {
+			return fmt.Errorf("input %q: max_length and enum only apply to strings", name)
+		}
+	}
+
+	timeout := cfg.Workflows.Timeout
+	if w.Timeout != "" {
+		parsed, err := time.ParseDuration(w.Timeout)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid timeout %q", w.Timeout)
+		}
+		timeout = parsed
+	}
+	w.Timeout = timeout.String()
+
+	w.policy = storyRetryPolicy(cfg)
+	w.policy.AttemptTimeout = timeout
+	w.policy.OverallTimeout = 0
+	if w.Retry.Attempts > 0 {
+		w.policy.MaxAttempts = w.Retry.Attempts
+	}
+	if w.Retry.Delay != "" {
+		delay, err := time.ParseDuration(w.Retry.Delay)
+		if err != nil || delay < 0 {
+			return fmt.Errorf("invalid retry delay %q", w.Retry.Delay)
+		}
+		w.policy.InitialBackoff = delay
+	}
+	if w.Retry.MaxDelay != "" {
+		maxDelay, err := time.ParseDuration(w.Retry.MaxDelay)
+		if err != nil || maxDelay < 0 {
+			return fmt.Errorf("invalid retry max_delay %q", w.Retry.MaxDelay)
+		}
+		w.policy.MaxBackoff = maxDelay
+	}
+	w.Retry = WorkflowRetry{
+		Attempts: w.policy.Attempts(),
+		Delay:    w.policy.InitialBackoff.String(),
+		MaxDelay: w.policy.MaxBackoff.String(),
+	}
+
+	return nil
+}
+
+// workflowInputHasType reports whether a decoded JSON value has an input type
+func workflowInputHasType(value interface{}, inputType string) bool {
+	switch inputType {
+	case WorkflowInputString:
+		_, ok := value.(string)
+		return ok
+	case WorkflowInputNumber:
+		_, ok := value.(float64)
+		return ok
+	case WorkflowInputInteger:
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case WorkflowInputBoolean:
+		_, ok := value.(bool)
+		return ok
+	case WorkflowInputObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case WorkflowInputArray:
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
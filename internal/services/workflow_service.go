@@ -0,0 +1,343 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"pocket-app/internal/config"
+	"pocket-app/pkg/logger"
+	"pocket-app/pkg/retry"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Workflow run statuses
+const (
+	WorkflowRunRunning   = "running"
+	WorkflowRunSucceeded = "succeeded"
+	WorkflowRunFailed    = "failed"
+	WorkflowRunTimedOut  = "timed_out"
+)
+
+// Workflow access errors
+var (
+	ErrWorkflowNotFound     = errors.New("workflow not found")
+	ErrWorkflowAuthRequired = errors.New("authentication is required to run this workflow")
+	ErrWorkflowForbidden    = errors.New("you are not allowed to run this workflow")
+)
+
+// WorkflowService runs the registered Rivet workflows and keeps their run
+// history in the workflow_runs collection; every run is also recorded in the
+// generation log
+type WorkflowService struct {
+	app      *pocketbase.PocketBase
+	config   *config.Config
+	registry *WorkflowRegistry
+	logs     *GenerationLogService
+}
+
+// NewWorkflowService creates a new workflow service
+func NewWorkflowService(app *pocketbase.PocketBase, cfg *config.Config, registry *WorkflowRegistry, logs *GenerationLogService) *WorkflowService {
+	return &WorkflowService{
+		app:      app,
+		config:   cfg,
+		registry: registry,
+		logs:     logs,
+	}
+}
+
+// workflowOutcome is the result of running a workflow
+type workflowOutcome struct {
+	output         interface{}
+	response       string // the raw response body or CLI output
+	upstreamStatus int
+	attempts       int
+	timedOut       bool
+	err            error
+}
+
+// Find returns the named workflow if the caller may run it. It returns
+// ErrWorkflowNotFound, ErrWorkflowAuthRequired or ErrWorkflowForbidden.
+func (s *WorkflowService) Find(name string, auth *core.Record) (*Workflow, error) {
+	workflow, ok := s.registry.Get(name)
+	if !ok {
+		return nil, ErrWorkflowNotFound
+	}
+	if err := authorizeWorkflow(workflow, auth); err != nil {
+		return nil, err
+	}
+	return workflow, nil
+}
+
+// Available lists the workflows the caller may run
+func (s *WorkflowService) Available(auth *core.Record) []*Workflow {
+	var workflows []*Workflow
+	for _, workflow := range s.registry.List() {
+		if authorizeWorkflow(workflow, auth) == nil {
+			workflows = append(workflows, workflow)
+		}
+	}
+	return workflows
+}
+
+// Run runs a workflow with the given inputs, recording the run as running
+// first and with its outcome once it finishes. Runs by users are linked to
+// them; runs by superusers and guests are not.
+func (s *WorkflowService) Run(ctx context.Context, workflow *Workflow, auth *core.Record, inputs map[string]interface{}) (map[string]interface{}, error) {
+	if inputs == nil {
+		inputs = map[string]interface{}{}
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("workflow_runs")
+	if err != nil {
+		return nil, err
+	}
+
+	userID := ""
+	if auth != nil && !auth.IsSuperuser() {
+		userID = auth.Id
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("workflow", workflow.Name)
+	record.Set("user", userID)
+	record.Set("status", WorkflowRunRunning)
+	record.Set("inputs", inputs)
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Running workflow %s (%s backend), run %s", workflow.Name, workflow.Backend, record.Id)
+	started := time.Now()
+
+	var outcome *workflowOutcome
+	switch workflow.Backend {
+	case WorkflowBackendCLI:
+		outcome = s.runCLI(ctx, workflow, inputs)
+	default:
+		outcome = s.runHTTP(ctx, workflow, inputs)
+	}
+
+	status := WorkflowRunSucceeded
+	switch {
+	case outcome.timedOut:
+		status = WorkflowRunTimedOut
+	case outcome.err != nil:
+		status = WorkflowRunFailed
+	}
+	record.Set("status", status)
+	record.Set("output", outcome.output)
+	record.Set("attempts", outcome.attempts)
+	record.Set("upstream_status", outcome.upstreamStatus)
+	record.Set("duration_ms", time.Since(started).Milliseconds())
+	if outcome.err != nil {
+		logger.Warn("Workflow %s run %s %s: %v", workflow.Name, record.Id, status, outcome.err)
+		record.Set("error", truncateRunes(outcome.err.Error(), 2000))
+	}
+	if err := s.app.Save(record); err != nil {
+		logger.Error("Failed to record workflow run "+record.Id, err)
+	}
+
+	s.logs.RecordUpstream(WithGenerationCaller(ctx, userID, GenerationOpWorkflow), UpstreamCall{
+		Operation: GenerationOpWorkflow,
+		Generator: workflow.Backend,
+		Request:   map[string]interface{}{"workflow": workflow.Name, "inputs": inputs},
+		Status:    outcome.upstreamStatus,
+		Response:  outcome.response,
+		Attempts:  outcome.attempts,
+		Err:       outcome.err,
+		Latency:   time.Since(started),
+	})
+
+	return workflowRunMap(record), nil
+}
+
+// ListRuns lists the runs of a workflow, newest first: all of them for
+// superusers, the caller's own for users
+func (s *WorkflowService) ListRuns(workflow *Workflow, auth *core.Record, page, perPage int) ([]map[string]interface{}, int, error) {
+	filter := "workflow = {:workflow}"
+	where := dbx.HashExp{"workflow": workflow.Name}
+	params := dbx.Params{"workflow": workflow.Name}
+	if !auth.IsSuperuser() {
+		filter += " && user = {:user}"
+		where["user"] = auth.Id
+		params["user"] = auth.Id
+	}
+
+	records, err := s.app.FindRecordsByFilter("workflow_runs", filter, "-created", perPage, (page-1)*perPage, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.app.CountRecords("workflow_runs", where)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	runs := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		runs[i] = workflowRunMap(record)
+	}
+	return runs, int(total), nil
+}
+
+// runHTTP posts the inputs as JSON to the workflow URL under its retry policy
+func (s *WorkflowService) runHTTP(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) *workflowOutcome {
+	outcome := &workflowOutcome{}
+
+	body, err := json.Marshal(inputs)
+	if err != nil {
+		outcome.err = err
+		return outcome
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Accept", "application/json")
+
+	client := retry.NewClient(workflow.Policy())
+	resp, attempts, err := client.Do(ctx, http.MethodPost, workflow.URL, body, header)
+	outcome.attempts = attempts
+	if resp != nil {
+		outcome.upstreamStatus = resp.StatusCode
+		outcome.response = string(resp.Body)
+	}
+
+	var statusErr *retry.StatusError
+	switch {
+	case err != nil && !errors.As(err, &statusErr):
+		outcome.timedOut = errors.Is(err, context.DeadlineExceeded)
+		outcome.err = fmt.Errorf("workflow request failed after %d attempts: %w", attempts, err)
+	case resp.StatusCode >= 400:
+		outcome.err = fmt.Errorf("workflow returned status %d: %s", resp.StatusCode, truncateRunes(strings.TrimSpace(string(resp.Body)), 500))
+	default:
+		outcome.output = decodeWorkflowOutput(resp.Body)
+	}
+	return outcome
+}
+
+// runCLI runs the workflow graph with the Rivet CLI (`rivet run <project>
+// <graph> --inputs-stdin`), using RIVET_CLI_COMMAND and RIVET_PROJECT_PATH
+func (s *WorkflowService) runCLI(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) *workflowOutcome {
+	outcome := &workflowOutcome{}
+
+	stdin, err := json.Marshal(inputs)
+	if err != nil {
+		outcome.err = err
+		return outcome
+	}
+
+	command := strings.Fields(s.config.Rivet.Command)
+	if len(command) == 0 {
+		outcome.err = errors.New("rivet CLI command is not configured")
+		return outcome
+	}
+	args := append(command[1:], "run", s.config.Rivet.ProjectPath, workflow.Graph, "--inputs-stdin")
+
+	var stdout []byte
+	attempts, err := retry.Do(ctx, workflow.Policy(), func(ctx context.Context, attempt int) error {
+		cmd := exec.CommandContext(ctx, command[0], args...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		var out, stderr bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			outcome.timedOut = ctx.Err() == context.DeadlineExceeded
+			logger.Warn("Attempt %d: Workflow %s failed (timed out: %t): %v: %s", attempt, workflow.Name, outcome.timedOut, err, logger.Body(stderr.Bytes()))
+			return fmt.Errorf("%v: %s", err, truncateRunes(strings.TrimSpace(stderr.String()), 500))
+		}
+		outcome.timedOut = false
+		stdout = out.Bytes()
+		return nil
+	})
+	outcome.attempts = attempts
+	if err != nil {
+		outcome.err = fmt.Errorf("rivet CLI failed after %d attempts: %w", attempts, err)
+		return outcome
+	}
+
+	outcome.response = string(stdout)
+	outcome.output = decodeWorkflowOutput(stdout)
+	return outcome
+}
+
+// authorizeWorkflow checks the workflow's auth rule against the caller
+func authorizeWorkflow(workflow *Workflow, auth *core.Record) error {
+	if auth != nil && auth.IsSuperuser() {
+		return nil
+	}
+
+	switch workflow.Auth {
+	case WorkflowAuthPublic:
+		return nil
+	case WorkflowAuthUser:
+		if auth == nil {
+			return ErrWorkflowAuthRequired
+		}
+		if len(workflow.Users) > 0 && !slices.Contains(workflow.Users, auth.Id) && !slices.Contains(workflow.Users, auth.Email()) {
+			return ErrWorkflowForbidden
+		}
+		return nil
+	default:
+		if auth == nil {
+			return ErrWorkflowAuthRequired
+		}
+		return ErrWorkflowForbidden
+	}
+}
+
+// decodeWorkflowOutput reads the outputs of a workflow run. Rivet's typed
+// outputs ({"type": ..., "value": ...}) are reduced to their values, and
+// outputs that are not JSON are kept as text.
+func decodeWorkflowOutput(body []byte) interface{} {
+	var output interface{}
+	if err := json.Unmarshal(body, &output); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	outputs, ok := output.(map[string]interface{})
+	if !ok {
+		return output
+	}
+	for name, value := range outputs {
+		typed, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		outputType, hasType := typed["type"].(string)
+		if _, hasValue := typed["value"]; !hasType || (!hasValue && outputType != "control-flow-excluded") {
+			continue
+		}
+		outputs[name] = typed["value"]
+	}
+	return outputs
+}
+
+// workflowRunMap converts a workflow run record to its API representation
+func workflowRunMap(record *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              record.Id,
+		"workflow":        record.GetString("workflow"),
+		"user":            record.GetString("user"),
+		"status":          record.GetString("status"),
+		"inputs":          record.Get("inputs"),
+		"output":          record.Get("output"),
+		"error":           record.GetString("error"),
+		"attempts":        record.GetInt("attempts"),
+		"upstream_status": record.GetInt("upstream_status"),
+		"duration_ms":     record.GetInt("duration_ms"),
+		"created":         record.GetDateTime("created"),
+		"updated":         record.GetDateTime("updated"),
+	}
+}
@@ -11,7 +11,8 @@ func init() {
 	m.Register(func(app core.App) error {
 		collection, err := app.FindCollectionByNameOrId("pbc_1125843985")
 		if err != nil {
-			return err
+			// the collection never existed on a fresh database
+			return nil
 		}
 
 		return app.Delete(collection)
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3301203437")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(5, []byte(`{
+			"hidden": false,
+			"id": "file3309110367",
+			"maxSelect": 1,
+			"maxSize": 10485760,
+			"mimeTypes": [
+				"image/png",
+				"image/jpeg",
+				"image/webp",
+				"image/gif"
+			],
+			"name": "image",
+			"presentable": false,
+			"protected": false,
+			"required": false,
+			"system": false,
+			"thumbs": [],
+			"type": "file"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(6, []byte(`{
+			"hidden": false,
+			"id": "file41047410",
+			"maxSelect": 1,
+			"maxSize": 5242880,
+			"mimeTypes": [
+				"image/png",
+				"image/jpeg"
+			],
+			"name": "image_thumb",
+			"presentable": false,
+			"protected": false,
+			"required": false,
+			"system": false,
+			"thumbs": [],
+			"type": "file"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"hidden": false,
+			"id": "select3558685652",
+			"maxSelect": 1,
+			"name": "image_status",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"pending",
+				"generating",
+				"succeeded",
+				"failed"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1251490008",
+			"max": 2000,
+			"min": 0,
+			"name": "image_error",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(9, []byte(`{
+			"hidden": false,
+			"id": "number808937932",
+			"max": null,
+			"min": 0,
+			"name": "image_attempts",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3301203437")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("file3309110367")
+
+		// remove field
+		collection.Fields.RemoveById("file41047410")
+
+		// remove field
+		collection.Fields.RemoveById("select3558685652")
+
+		// remove field
+		collection.Fields.RemoveById("text1251490008")
+
+		// remove field
+		collection.Fields.RemoveById("number808937932")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Links stories to the library characters they were generated with, and
+// makes room in the character fields for the expanded character descriptions.
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(10, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_975782158",
+			"hidden": false,
+			"id": "relation975782158",
+			"maxSelect": 100,
+			"minSelect": 0,
+			"name": "characters",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		// update fields
+		for _, name := range []string{"primary_characters", "secondary_characters"} {
+			collection.Fields.GetByName(name).(*core.TextField).Max = 20000
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("relation975782158")
+
+		// update fields
+		for _, name := range []string{"primary_characters", "secondary_characters"} {
+			collection.Fields.GetByName(name).(*core.TextField).Max = 5000
+		}
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"listRule": "owner = @request.auth.id && (moderation_status = \"\" || moderation_status = \"approved\")",
+			"updateRule": "owner = @request.auth.id && (moderation_status = \"\" || moderation_status = \"approved\") && @request.body.moderation_status:isset = false",
+			"viewRule": "owner = @request.auth.id && (moderation_status = \"\" || moderation_status = \"approved\")"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(13, []byte(`{
+			"hidden": false,
+			"id": "select2358339750",
+			"maxSelect": 1,
+			"name": "moderation_status",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"quarantined",
+				"approved",
+				"rejected"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"listRule": "owner = @request.auth.id",
+			"updateRule": "owner = @request.auth.id",
+			"viewRule": "owner = @request.auth.id"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("select2358339750")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3301203437")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"listRule": "story.owner = @request.auth.id && (story.moderation_status = \"\" || story.moderation_status = \"approved\")",
+			"updateRule": "story.owner = @request.auth.id && (story.moderation_status = \"\" || story.moderation_status = \"approved\")",
+			"viewRule": "story.owner = @request.auth.id && (story.moderation_status = \"\" || story.moderation_status = \"approved\")"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3301203437")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"listRule": "story.owner = @request.auth.id",
+			"updateRule": "story.owner = @request.auth.id",
+			"viewRule": "story.owner = @request.auth.id"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"updateRule": "owner = @request.auth.id && (moderation_status = \"\" || moderation_status = \"approved\") && @request.body.moderation_status:isset = false && @request.body.template:isset = false && @request.body.template_version:isset = false && @request.body.template_instructions:isset = false"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(13, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text3551124862",
+			"max": 0,
+			"min": 0,
+			"name": "template_instructions",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"updateRule": "owner = @request.auth.id && (moderation_status = \"\" || moderation_status = \"approved\") && @request.body.moderation_status:isset = false"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text3551124862")
+
+		return app.Save(collection)
+	})
+}
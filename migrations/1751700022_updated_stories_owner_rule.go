@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"updateRule": "owner = @request.auth.id && (moderation_status = \"\" || moderation_status = \"approved\") && @request.body.moderation_status:isset = false && (@request.body.owner:isset = false || @request.body.owner = @request.auth.id) && @request.body.template:isset = false && @request.body.template_version:isset = false && @request.body.template_instructions:isset = false"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2626395487")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"updateRule": "owner = @request.auth.id && (moderation_status = \"\" || moderation_status = \"approved\") && @request.body.moderation_status:isset = false && @request.body.template:isset = false && @request.body.template_version:isset = false && @request.body.template_instructions:isset = false"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	})
+}
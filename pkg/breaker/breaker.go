@@ -0,0 +1,201 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit states
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Settings configures a circuit breaker
+type Settings struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before probing
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of concurrent probe calls allowed while half-open
+	HalfOpenProbes int
+}
+
+// OpenError is returned by Allow while the circuit is open
+type OpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit open, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// Status is a snapshot of a circuit breaker
+type Status struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAfterSeconds   int        `json:"retry_after_seconds,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	TotalSuccesses      int64      `json:"total_successes"`
+	TotalFailures       int64      `json:"total_failures"`
+	TotalRejected       int64      `json:"total_rejected"`
+}
+
+// Breaker is a circuit breaker. Callers ask Allow before a call and report
+// its outcome with Success, Failure or Cancel.
+type Breaker struct {
+	settings Settings
+
+	mu                  sync.Mutex
+	state               string
+	consecutiveFailures int
+	openedAt            time.Time
+	probes              int
+	lastError           string
+	lastFailureAt       time.Time
+	lastSuccessAt       time.Time
+	totalSuccesses      int64
+	totalFailures       int64
+	totalRejected       int64
+}
+
+// New creates a new closed circuit breaker
+func New(settings Settings) *Breaker {
+	if settings.FailureThreshold < 1 {
+		settings.FailureThreshold = 1
+	}
+	if settings.HalfOpenProbes < 1 {
+		settings.HalfOpenProbes = 1
+	}
+	return &Breaker{
+		settings: settings,
+		state:    StateClosed,
+	}
+}
+
+// Allow reports whether a call may proceed. While the circuit is open it
+// returns an *OpenError; once the open timeout has passed, a limited number
+// of probe calls are let through.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+		b.state = StateHalfOpen
+		b.probes = 0
+	}
+
+	switch b.state {
+	case StateOpen:
+		b.totalRejected++
+		return &OpenError{RetryAfter: b.retryAfter(now)}
+	case StateHalfOpen:
+		if b.probes >= b.settings.HalfOpenProbes {
+			b.totalRejected++
+			return &OpenError{RetryAfter: b.settings.OpenTimeout}
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Success records a successful call and closes the circuit
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.release()
+	b.state = StateClosed
+	b.consecutiveFailures = 0
+	b.lastSuccessAt = time.Now()
+	b.totalSuccesses++
+}
+
+// Failure records a failed call. The circuit opens when the failure
+// threshold is reached, or at once when a probe fails.
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbe := b.state == StateHalfOpen
+	b.release()
+
+	b.consecutiveFailures++
+	b.totalFailures++
+	b.lastFailureAt = time.Now()
+	if err != nil {
+		b.lastError = err.Error()
+	}
+
+	if wasProbe || b.consecutiveFailures >= b.settings.FailureThreshold {
+		b.state = StateOpen
+		b.openedAt = b.lastFailureAt
+	}
+}
+
+// Cancel records a call that ended without telling anything about the
+// protected service, e.g. because the caller went away
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.release()
+}
+
+// Status returns a snapshot of the breaker
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	state := b.state
+	if state == StateOpen && now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+		state = StateHalfOpen
+	}
+
+	status := Status{
+		State:               state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		FailureThreshold:    b.settings.FailureThreshold,
+		LastError:           b.lastError,
+		TotalSuccesses:      b.totalSuccesses,
+		TotalFailures:       b.totalFailures,
+		TotalRejected:       b.totalRejected,
+	}
+	if state == StateOpen {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+		status.RetryAfterSeconds = int(b.retryAfter(now).Round(time.Second) / time.Second)
+	}
+	if !b.lastFailureAt.IsZero() {
+		lastFailureAt := b.lastFailureAt
+		status.LastFailureAt = &lastFailureAt
+	}
+	if !b.lastSuccessAt.IsZero() {
+		lastSuccessAt := b.lastSuccessAt
+		status.LastSuccessAt = &lastSuccessAt
+	}
+	return status
+}
+
+// release frees a probe slot taken by Allow in the half-open state
+func (b *Breaker) release() {
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *Breaker) retryAfter(now time.Time) time.Duration {
+	remaining := b.settings.OpenTimeout - now.Sub(b.openedAt)
+	if remaining < time.Second {
+		return time.Second
+	}
+	return remaining
+}
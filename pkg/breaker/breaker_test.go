@@ -0,0 +1,147 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// step is one call on a breaker and the state expected after it
+type step struct {
+	op        string // allow, success, failure, cancel or expire
+	wantOpen  bool   // for allow: whether it must be rejected
+	wantState string
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	settings := Settings{FailureThreshold: 2, OpenTimeout: time.Minute, HalfOpenProbes: 1}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below the threshold",
+			steps: []step{
+				{op: "allow", wantState: StateClosed},
+				{op: "failure", wantState: StateClosed},
+				{op: "allow", wantState: StateClosed},
+				{op: "success", wantState: StateClosed},
+				{op: "allow", wantState: StateClosed},
+				{op: "failure", wantState: StateClosed},
+			},
+		},
+		{
+			name: "opens at the threshold and rejects",
+			steps: []step{
+				{op: "failure", wantState: StateClosed},
+				{op: "failure", wantState: StateOpen},
+				{op: "allow", wantOpen: true, wantState: StateOpen},
+			},
+		},
+		{
+			name: "half-open after the timeout, closed by a successful probe",
+			steps: []step{
+				{op: "failure", wantState: StateClosed},
+				{op: "failure", wantState: StateOpen},
+				{op: "expire", wantState: StateHalfOpen},
+				{op: "allow", wantState: StateHalfOpen},
+				{op: "success", wantState: StateClosed},
+				{op: "allow", wantState: StateClosed},
+			},
+		},
+		{
+			name: "failed probe reopens at once",
+			steps: []step{
+				{op: "failure", wantState: StateClosed},
+				{op: "failure", wantState: StateOpen},
+				{op: "expire", wantState: StateHalfOpen},
+				{op: "allow", wantState: StateHalfOpen},
+				{op: "failure", wantState: StateOpen},
+				{op: "allow", wantOpen: true, wantState: StateOpen},
+			},
+		},
+		{
+			name: "half-open limits concurrent probes",
+			steps: []step{
+				{op: "failure", wantState: StateClosed},
+				{op: "failure", wantState: StateOpen},
+				{op: "expire", wantState: StateHalfOpen},
+				{op: "allow", wantState: StateHalfOpen},
+				{op: "allow", wantOpen: true, wantState: StateHalfOpen},
+			},
+		},
+		{
+			name: "canceled probe frees its slot",
+			steps: []step{
+				{op: "failure", wantState: StateClosed},
+				{op: "failure", wantState: StateOpen},
+				{op: "expire", wantState: StateHalfOpen},
+				{op: "allow", wantState: StateHalfOpen},
+				{op: "cancel", wantState: StateHalfOpen},
+				{op: "allow", wantState: StateHalfOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(settings)
+			for i, s := range tt.steps {
+				switch s.op {
+				case "allow":
+					err := b.Allow()
+					var openErr *OpenError
+					if s.wantOpen != errors.As(err, &openErr) {
+						t.Fatalf("step %d: Allow() = %v, want rejected: %v", i, err, s.wantOpen)
+					}
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure(errors.New("upstream failed"))
+				case "cancel":
+					b.Cancel()
+				case "expire":
+					expire(b)
+				}
+
+				if got := b.Status().State; got != s.wantState {
+					t.Fatalf("step %d (%s): state = %s, want %s", i, s.op, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerStatus(t *testing.T) {
+	b := New(Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	b.Failure(errors.New("upstream failed"))
+	if err := b.Allow(); err == nil {
+		t.Fatal("Allow() on an open circuit returned nil")
+	}
+
+	status := b.Status()
+	if status.State != StateOpen || status.OpenedAt == nil {
+		t.Errorf("State = %s, OpenedAt = %v, want open with a time", status.State, status.OpenedAt)
+	}
+	if status.RetryAfterSeconds < 59 || status.RetryAfterSeconds > 60 {
+		t.Errorf("RetryAfterSeconds = %d, want about 60", status.RetryAfterSeconds)
+	}
+	if status.LastError != "upstream failed" || status.TotalFailures != 1 || status.TotalRejected != 1 {
+		t.Errorf("status = %+v, want the last error, one failure and one rejection", status)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	b := New(Settings{})
+	if b.settings.FailureThreshold != 1 || b.settings.HalfOpenProbes != 1 {
+		t.Errorf("settings = %+v, want a threshold and probe limit of 1", b.settings)
+	}
+}
+
+// expire moves an open breaker's open time back past its timeout
+func expire(b *Breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.openedAt = b.openedAt.Add(-b.settings.OpenTimeout)
+}
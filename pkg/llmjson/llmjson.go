@@ -0,0 +1,172 @@
+package llmjson
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Extraction strategies, in order of preference
+const (
+	// StrategyDirect means the whole output is JSON
+	StrategyDirect = "direct"
+	// StrategyFenced means the JSON was inside a ``` fenced block
+	StrategyFenced = "fenced"
+	// StrategyEmbedded means the JSON was a bracketed value inside prose
+	StrategyEmbedded = "embedded"
+)
+
+// Repairs applied to a candidate that was not valid JSON as-is
+const (
+	RepairSmartQuotes       = "smart_quotes"
+	RepairTrailingCommas    = "trailing_commas"
+	RepairControlCharacters = "control_characters"
+)
+
+// ErrNoJSON is returned when the output contains no usable JSON value
+var ErrNoJSON = errors.New("no JSON object found in model output")
+
+// Result is the JSON extracted from model output
+type Result struct {
+	// JSON is the extracted, valid JSON text
+	JSON string
+	// Strategy is the strategy that found the JSON
+	Strategy string
+	// Repairs lists the fixes needed to make the JSON valid
+	Repairs []string
+}
+
+// Describe returns the strategy followed by any repairs, e.g. "fenced+trailing_commas"
+func (r *Result) Describe() string {
+	return strings.Join(append([]string{r.Strategy}, r.Repairs...), "+")
+}
+
+// Extract finds the best JSON object or array in model output. The whole
+// text, fenced blocks and bracketed values in prose are tried; candidates
+// that are not valid are repaired when possible, and the largest valid
+// candidate wins.
+func Extract(text string) (*Result, error) {
+	text = strings.TrimSpace(strings.TrimPrefix(text, "\ufeff"))
+
+	best := evaluate(text, StrategyDirect)
+	if best != nil && len(best.Repairs) == 0 {
+		return best, nil
+	}
+
+	consider := func(candidate, strategy string) {
+		result := evaluate(candidate, strategy)
+		if result != nil && (best == nil || len(result.JSON) > len(best.JSON)) {
+			best = result
+		}
+	}
+
+	for _, block := range fencedBlocks(text) {
+		consider(block, StrategyFenced)
+	}
+	for _, value := range embeddedValues(text) {
+		consider(value, StrategyEmbedded)
+	}
+
+	if best == nil {
+		return nil, ErrNoJSON
+	}
+	return best, nil
+}
+
+// evaluate returns the candidate as a result if it is, or can be repaired
+// into, a JSON object or array
+func evaluate(candidate, strategy string) *Result {
+	candidate = strings.TrimSpace(candidate)
+	if candidate == "" || (candidate[0] != '{' && candidate[0] != '[') {
+		return nil
+	}
+
+	if json.Valid([]byte(candidate)) {
+		return &Result{JSON: candidate, Strategy: strategy}
+	}
+
+	repaired, repairs := repair(candidate)
+	if len(repairs) > 0 && json.Valid([]byte(repaired)) {
+		return &Result{JSON: repaired, Strategy: strategy, Repairs: repairs}
+	}
+	return nil
+}
+
+// fencedBlocks returns the contents of ``` fenced blocks. The opening fence
+// may carry a language tag and need not be followed by a newline; an
+// unterminated last block runs to the end of the text.
+func fencedBlocks(text string) []string {
+	var blocks []string
+
+	rest := text
+	for {
+		start := strings.Index(rest, "```")
+		if start == -1 {
+			return blocks
+		}
+		rest = rest[start+3:]
+
+		// skip the language tag
+		tag := 0
+		for tag < len(rest) && isTagChar(rest[tag]) {
+			tag++
+		}
+		body := rest[tag:]
+
+		end := strings.Index(body, "```")
+		if end == -1 {
+			return append(blocks, body)
+		}
+		blocks = append(blocks, body[:end])
+		rest = body[end+3:]
+	}
+}
+
+func isTagChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '+'
+}
+
+// maxEmbeddedValues caps the bracketed values that are tried, so that
+// output full of brackets costs a bounded number of parses
+const maxEmbeddedValues = 16
+
+// embeddedValues returns the balanced {...} and [...] spans of the text,
+// longest first, at most maxEmbeddedValues of them. They are found in a
+// single pass that tracks the open brackets; quotes only start strings inside
+// brackets, so stray quotes in the surrounding prose are ignored, and
+// brackets inside strings do not count.
+func embeddedValues(text string) []string {
+	var values []string
+	var open []int
+	inString := false
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case inString && c == '"':
+			inString = false
+		case inString:
+		case c == '"' && len(open) > 0:
+			inString = true
+		case c == '{' || c == '[':
+			open = append(open, i)
+		case (c == '}' || c == ']') && len(open) > 0:
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			values = append(values, text[start:i+1])
+		}
+	}
+
+	sort.SliceStable(values, func(a, b int) bool {
+		return len(values[a]) > len(values[b])
+	})
+	if len(values) > maxEmbeddedValues {
+		values = values[:maxEmbeddedValues]
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+package llmjson
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// golden is the expected outcome of extracting JSON from a testdata input
+type golden struct {
+	Strategy string          `json:"strategy,omitempty"`
+	Repairs  []string        `json:"repairs,omitempty"`
+	JSON     json.RawMessage `json:"json,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// TestExtractGolden runs Extract on every testdata/<corpus>/*.txt upstream
+// response and compares the outcome with the matching .golden file. Each
+// directory under testdata is a corpus and must hold at least one case:
+// synthetic has hand-written edge cases, and captured, created by
+// scripts/capture-llm-output.sh, has outputs recorded from real upstream
+// generations. Run with -update to regenerate the golden files after an
+// intended change.
+func TestExtractGolden(t *testing.T) {
+	entries, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var corpora []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			corpora = append(corpora, entry.Name())
+		}
+	}
+	if len(corpora) == 0 {
+		t.Fatal("no testdata corpora found")
+	}
+
+	for _, corpus := range corpora {
+		t.Run(corpus, func(t *testing.T) {
+			inputs, err := filepath.Glob(filepath.Join("testdata", corpus, "*.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(inputs) == 0 {
+				t.Fatalf("no testdata/%s inputs found", corpus)
+			}
+
+			for _, input := range inputs {
+				name := strings.TrimSuffix(filepath.Base(input), ".txt")
+				t.Run(name, func(t *testing.T) {
+					checkGolden(t, input, filepath.Join("testdata", corpus, name+".golden"))
+				})
+			}
+		})
+	}
+}
+
+// checkGolden compares the outcome of extracting JSON from input with the
+// golden file, or rewrites the golden file with -update
+func checkGolden(t *testing.T, input, goldenPath string) {
+	text, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got golden
+	result, err := Extract(string(text))
+	if err != nil {
+		got.Error = err.Error()
+	} else {
+		got.Strategy = result.Strategy
+		got.Repairs = result.Repairs
+		got.JSON = json.RawMessage(result.JSON)
+	}
+
+	actual, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual = append(actual, '\n')
+
+	if *update {
+		if err := os.WriteFile(goldenPath, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("missing golden file (run with -update): %v", err)
+	}
+	if string(actual) != string(expected) {
+		t.Errorf("outcome differs from %s\n--- got ---\n%s\n--- want ---\n%s", goldenPath, actual, expected)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	result := &Result{Strategy: StrategyFenced, Repairs: []string{RepairTrailingCommas, RepairSmartQuotes}}
+	if got, want := result.Describe(), "fenced+trailing_commas+smart_quotes"; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
+
+// TestExtractBracketFlood checks that output made of brackets is scanned in
+// linear time and yields no JSON rather than a parse per bracket offset
+func TestExtractBracketFlood(t *testing.T) {
+	tests := map[string]string{
+		"unclosed": strings.Repeat("{[", 100000),
+		"nested":   strings.Repeat("[", 100000) + "x" + strings.Repeat("]", 100000),
+		"siblings": strings.Repeat("{x} ", 100000),
+	}
+	for name, text := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Extract(text); err != ErrNoJSON {
+				t.Errorf("Extract() error = %v, want ErrNoJSON", err)
+			}
+			if values := embeddedValues(text); len(values) > maxEmbeddedValues {
+				t.Errorf("embeddedValues() returned %d values, want at most %d", len(values), maxEmbeddedValues)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package llmjson
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// repair fixes common defects of model-written JSON: typographic quotes used
+// as string delimiters, trailing commas before a closing bracket, and raw
+// control characters inside strings. It returns the fixed text and the
+// repairs that changed something.
+func repair(text string) (string, []string) {
+	var b strings.Builder
+	b.Grow(len(text))
+
+	applied := map[string]bool{}
+	inString := false
+	smartString := false
+	escaped := false
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+				b.WriteRune(r)
+			case r == '\\':
+				escaped = true
+				b.WriteRune(r)
+			case r == '"':
+				inString = false
+				b.WriteRune(r)
+			case smartString && isSmartQuote(r) && closesString(text[i+size:]):
+				inString = false
+				applied[RepairSmartQuotes] = true
+				b.WriteByte('"')
+			case r == '\n':
+				applied[RepairControlCharacters] = true
+				b.WriteString(`\n`)
+			case r == '\r':
+				applied[RepairControlCharacters] = true
+				b.WriteString(`\r`)
+			case r == '\t':
+				applied[RepairControlCharacters] = true
+				b.WriteString(`\t`)
+			default:
+				b.WriteRune(r)
+			}
+			i += size
+			continue
+		}
+
+		switch {
+		case r == '"':
+			inString = true
+			smartString = false
+			b.WriteRune(r)
+		case isSmartQuote(r):
+			inString = true
+			smartString = true
+			applied[RepairSmartQuotes] = true
+			b.WriteByte('"')
+		case r == ',' && closesContainer(text[i+size:]):
+			applied[RepairTrailingCommas] = true
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+
+	var repairs []string
+	for _, name := range []string{RepairSmartQuotes, RepairTrailingCommas, RepairControlCharacters} {
+		if applied[name] {
+			repairs = append(repairs, name)
+		}
+	}
+	return b.String(), repairs
+}
+
+// isSmartQuote reports whether r is a typographic double quote
+func isSmartQuote(r rune) bool {
+	return r == '“' || r == '”' || r == '„' || r == '‟'
+}
+
+// closesString reports whether the text after a quote continues like JSON
+// after the end of a string
+func closesString(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	return rest == "" || strings.ContainsAny(rest[:1], ":,}]")
+}
+
+// closesContainer reports whether only whitespace separates the text from a
+// closing bracket
+func closesContainer(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	return rest != "" && (rest[0] == '}' || rest[0] == ']')
+}
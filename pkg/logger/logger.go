@@ -3,9 +3,12 @@ package logger
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
+
+	"pocket-app/pkg/redact"
 )
 
 // LogLevel represents the logging level
@@ -21,6 +24,7 @@ const (
 var (
 	currentLevel LogLevel = INFO
 	logger       *log.Logger
+	redactor     *redact.Redactor
 )
 
 // Color constants for terminal output
@@ -55,6 +59,33 @@ func SetLevel(level string) {
 	}
 }
 
+// SetRedactor sets the redaction rules applied to every message, and to
+// the bodies and headers passed through Body and Headers
+func SetRedactor(r *redact.Redactor) {
+	redactor = r
+}
+
+// Body returns a request or response body as it may be logged
+func Body(body []byte) string {
+	if redactor == nil {
+		return string(body)
+	}
+	return redactor.Body(body)
+}
+
+// Headers returns headers as they may be logged
+func Headers(header http.Header) http.Header {
+	if redactor == nil {
+		return header
+	}
+	return redactor.Headers(header)
+}
+
+// DebugEnabled reports whether debug messages are logged
+func DebugEnabled() bool {
+	return currentLevel <= DEBUG
+}
+
 // Debug logs a debug message
 func Debug(message string, args ...interface{}) {
 	if currentLevel <= DEBUG {
@@ -95,6 +126,9 @@ func logMessage(level LogLevel, color, levelStr, message string, args ...interfa
 	if len(args) > 0 {
 		message = fmt.Sprintf(message, args...)
 	}
+	if redactor != nil {
+		message = redactor.Text(message)
+	}
 	
 	logger.Printf("%s %s", prefix, message)
 }
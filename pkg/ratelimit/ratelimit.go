@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Result is the outcome of a rate limit check
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RetryAfter returns the time until the window resets
+func (r Result) RetryAfter() time.Duration {
+	return time.Until(r.Reset)
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter allows a fixed number of events per key within each time window
+type Limiter struct {
+	limit  int
+	period time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+// New creates a limiter that allows limit events per period for every key;
+// a limit of zero or less disables it
+func New(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		period:  period,
+		windows: make(map[string]*window),
+	}
+}
+
+// Enabled reports whether the limiter restricts anything
+func (l *Limiter) Enabled() bool {
+	return l.limit > 0
+}
+
+// Allow records an event for key and reports whether it is within the limit
+func (l *Limiter) Allow(key string) Result {
+	if !l.Enabled() {
+		return Result{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.period {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	result := Result{
+		Limit: l.limit,
+		Reset: w.start.Add(l.period),
+	}
+	if w.count >= l.limit {
+		return result
+	}
+
+	w.count++
+	result.Allowed = true
+	result.Remaining = l.limit - w.count
+	return result
+}
+
+// Release gives back an event recorded for key by Allow in the current window
+func (l *Limiter) Release(key string) {
+	if !l.Enabled() {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if w, ok := l.windows[key]; ok && time.Since(w.start) < l.period && w.count > 0 {
+		w.count--
+	}
+}
+
+// sweep drops expired windows at most once per period
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.period {
+		return
+	}
+	l.lastSweep = now
+
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.period {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+// Secrets that are scrubbed from any logged text
+var (
+	bearerToken = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	jwtToken    = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]+`)
+	apiKey      = regexp.MustCompile(`\b(sk|pk|rk)-[A-Za-z0-9_-]{16,}`)
+	email       = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// Rules configure what a Redactor removes
+type Rules struct {
+	// Headers are the header names whose values are never logged
+	Headers []string
+	// Fields are the JSON body fields whose values are masked, matched
+	// case-insensitively and ignoring "_" and "-"
+	Fields []string
+	// MaxBody is the number of characters of a body that are logged; zero
+	// or less logs whole bodies
+	MaxBody int
+	// Full logs bodies whole and unmasked; headers and secrets in text are
+	// still redacted
+	Full bool
+}
+
+// Redactor removes secrets and personal data from what is logged
+type Redactor struct {
+	headers map[string]bool
+	fields  map[string]bool
+	fieldRe *regexp.Regexp
+	maxBody int
+	full    bool
+}
+
+// New creates a redactor from its rules
+func New(rules Rules) *Redactor {
+	r := &Redactor{
+		headers: make(map[string]bool, len(rules.Headers)),
+		fields:  make(map[string]bool, len(rules.Fields)),
+		maxBody: rules.MaxBody,
+		full:    rules.Full,
+	}
+	for _, header := range rules.Headers {
+		r.headers[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+
+	names := make([]string, 0, len(rules.Fields))
+	for _, field := range rules.Fields {
+		if key := normalizeField(field); key != "" && !r.fields[key] {
+			r.fields[key] = true
+			names = append(names, fieldPattern(key))
+		}
+	}
+	if len(names) > 0 {
+		// "field": "value" pairs inside free text, such as upstream error bodies
+		r.fieldRe = regexp.MustCompile(`(?i)("(?:` + strings.Join(names, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*")`)
+	}
+	return r
+}
+
+// Full reports whether bodies are logged whole and unmasked
+func (r *Redactor) Full() bool {
+	return r.full
+}
+
+// Text scrubs bearer tokens, JWTs and API keys from text and, unless bodies
+// are logged in full, email addresses and masked "field": "value" pairs
+func (r *Redactor) Text(text string) string {
+	text = bearerToken.ReplaceAllString(text, "$1 "+Placeholder)
+	text = jwtToken.ReplaceAllString(text, Placeholder)
+	text = apiKey.ReplaceAllString(text, Placeholder)
+	if r.full {
+		return text
+	}
+	text = email.ReplaceAllString(text, Placeholder)
+	if r.fieldRe != nil {
+		text = r.fieldRe.ReplaceAllStringFunc(text, func(pair string) string {
+			match := r.fieldRe.FindStringSubmatch(pair)
+			if strings.HasPrefix(match[2], `"`+Placeholder[:len(Placeholder)-1]) {
+				// already masked
+				return pair
+			}
+			return match[1] + `"` + Placeholder + `"`
+		})
+	}
+	return text
+}
+
+// Headers returns a copy of the headers with the values of deny-listed
+// headers replaced
+func (r *Redactor) Headers(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		if r.headers[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{Placeholder}
+			continue
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// Body returns a body as it may be logged: JSON bodies have the values of
+// masked fields replaced, other bodies have secrets scrubbed, and both are
+// truncated to MaxBody characters
+func (r *Redactor) Body(body []byte) string {
+	if r.full {
+		return r.Text(string(body))
+	}
+
+	text := string(body)
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err == nil {
+		if masked, err := json.Marshal(r.mask(data)); err == nil {
+			text = string(masked)
+		}
+	}
+	return r.truncate(r.Text(text))
+}
+
+// mask replaces the values of masked fields in decoded JSON
+func (r *Redactor) mask(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if r.fields[normalizeField(key)] {
+				v[key] = maskedValue(item)
+				continue
+			}
+			v[key] = r.mask(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.mask(item)
+		}
+	}
+	return value
+}
+
+// truncate shortens text to MaxBody characters, noting how much was cut
+func (r *Redactor) truncate(text string) string {
+	if r.maxBody <= 0 {
+		return text
+	}
+	runes := []rune(text)
+	if len(runes) <= r.maxBody {
+		return text
+	}
+	return string(runes[:r.maxBody]) + fmt.Sprintf("… [truncated %d characters]", len(runes)-r.maxBody)
+}
+
+// maskedValue replaces a masked value, keeping the length of strings so that
+// empty and oversized values can still be told apart
+func maskedValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return ""
+		}
+		return fmt.Sprintf("[REDACTED %d chars]", len([]rune(v)))
+	}
+	return Placeholder
+}
+
+// fieldSeparator matches what normalizeField drops inside a quoted field name
+const fieldSeparator = `[^\p{L}\p{N}"\\]*`
+
+// fieldPattern matches the quoted names that normalize to key, so that
+// "api_key", "apiKey" and "API-Key" are all found for the key "apikey"
+func fieldPattern(key string) string {
+	var b strings.Builder
+	b.WriteString(fieldSeparator)
+	for _, r := range key {
+		b.WriteString(regexp.QuoteMeta(string(r)))
+		b.WriteString(fieldSeparator)
+	}
+	return b.String()
+}
+
+// normalizeField lowercases a field name and drops everything but letters and digits
+func normalizeField(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -51,6 +51,16 @@ func Created(w http.ResponseWriter, data interface{}, message string) error {
 	})
 }
 
+// Accepted returns an accepted response for work that completes asynchronously
+func Accepted(w http.ResponseWriter, data interface{}, message string) error {
+	return JSON(w, http.StatusAccepted, Response{
+		Success:   true,
+		Message:   message,
+		Data:      data,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
 // Error returns an error response
 func Error(w http.ResponseWriter, statusCode int, message string, err ...interface{}) error {
 	var errorDetail interface{}
@@ -90,6 +100,15 @@ func NotFound(w http.ResponseWriter, message string) error {
 	return Error(w, http.StatusNotFound, message)
 }
 
+// TooManyRequests returns a rate limit or quota exceeded response
+func TooManyRequests(w http.ResponseWriter, message string, err ...interface{}) error {
+	var errorDetail interface{}
+	if len(err) > 0 {
+		errorDetail = err[0]
+	}
+	return Error(w, http.StatusTooManyRequests, message, errorDetail)
+}
+
 // ValidationError returns a validation error response
 func ValidationError(w http.ResponseWriter, errors interface{}) error {
 	return JSON(w, http.StatusUnprocessableEntity, Response{
@@ -0,0 +1,106 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Response is an HTTP response whose body has been read completely
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// StatusError is returned by Client.Do when the attempts ran out on a
+// retryable status
+type StatusError struct {
+	Response *Response
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("upstream returned status %d", e.Response.StatusCode)
+}
+
+// Client sends HTTP requests under a retry policy. Timeouts come from the
+// policy and the request context, never from the underlying http.Client.
+type Client struct {
+	httpClient *http.Client
+	policy     Policy
+}
+
+// NewClient creates a new HTTP client with the given retry policy
+func NewClient(policy Policy) *Client {
+	return &Client{
+		httpClient: &http.Client{},
+		policy:     policy,
+	}
+}
+
+// Policy returns the client's retry policy
+func (c *Client) Policy() Policy {
+	return c.policy
+}
+
+// Open sends a single request and returns the response with its body still
+// open; the caller must close it
+func (c *Client) Open(ctx context.Context, method, url string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return c.httpClient.Do(req)
+}
+
+// Send sends a single request and reads the whole response body
+func (c *Client) Send(ctx context.Context, method, url string, body []byte, header http.Header) (*Response, error) {
+	resp, err := c.Open(ctx, method, url, body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       responseBody,
+	}, nil
+}
+
+// Do sends a request under the client's policy, retrying transport errors
+// and retryable statuses. It returns the final response, the number of
+// attempts and, when the attempts ran out on a retryable status, a
+// *StatusError holding that response.
+func (c *Client) Do(ctx context.Context, method, url string, body []byte, header http.Header) (*Response, int, error) {
+	var last *Response
+	attempts, err := Do(ctx, c.policy, func(ctx context.Context, attempt int) error {
+		resp, err := c.Send(ctx, method, url, body, header)
+		if err != nil {
+			return err
+		}
+		last = resp
+		if c.policy.IsRetryableStatus(resp.StatusCode) {
+			return &StatusError{Response: resp}
+		}
+		return nil
+	})
+
+	var statusErr *StatusError
+	if err != nil && !errors.As(err, &statusErr) {
+		return nil, attempts, err
+	}
+	return last, attempts, err
+}
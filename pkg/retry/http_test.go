@@ -0,0 +1,56 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{name: "success", statuses: []int{200}, wantAttempts: 1, wantStatus: 200},
+		{name: "retries retryable status", statuses: []int{503, 503, 200}, wantAttempts: 3, wantStatus: 200},
+		{name: "does not retry other statuses", statuses: []int{400}, wantAttempts: 1, wantStatus: 400},
+		{name: "attempts run out", statuses: []int{503, 503, 503}, wantAttempts: 3, wantStatus: 503, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[min(calls, len(tt.statuses)-1)]
+				calls++
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			client := NewClient(Policy{
+				MaxAttempts:       3,
+				InitialBackoff:    time.Millisecond,
+				Multiplier:        2,
+				RetryableStatuses: []int{503},
+			})
+			resp, attempts, err := client.Do(context.Background(), http.MethodGet, server.URL, nil, nil)
+
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("attempts = %d, calls = %d, want %d", attempts, calls, tt.wantAttempts)
+			}
+			if resp == nil || resp.StatusCode != tt.wantStatus {
+				t.Fatalf("response = %+v, want status %d", resp, tt.wantStatus)
+			}
+			var statusErr *StatusError
+			if tt.wantErr != errors.As(err, &statusErr) {
+				t.Errorf("err = %v, want StatusError: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
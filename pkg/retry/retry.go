@@ -0,0 +1,157 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy describes how often and how patiently an operation is retried
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after every attempt
+	Multiplier float64
+	// Jitter is the fraction (0-1) of each delay that is randomized
+	Jitter float64
+	// AttemptTimeout bounds a single attempt; zero means no limit
+	AttemptTimeout time.Duration
+	// OverallTimeout bounds all attempts and delays together; zero means no limit
+	OverallTimeout time.Duration
+	// RetryableStatuses are the HTTP statuses worth another attempt
+	RetryableStatuses []int
+}
+
+// Attempts returns the number of attempts, at least one
+func (p Policy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns the delay after the given attempt (starting at 1):
+// exponential growth from InitialBackoff, capped at MaxBackoff, with up to
+// Jitter of it removed at random
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// IsRetryableStatus reports whether an HTTP status is worth another attempt
+func (p Policy) IsRetryableStatus(statusCode int) bool {
+	for _, status := range p.RetryableStatuses {
+		if status == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// permanentError marks an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps an error so that Do returns it without retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it returns nil, returns a Permanent error, the attempts
+// or the overall timeout run out, or ctx is done. Each call gets a context
+// bounded by the attempt timeout. Do returns the number of attempts made and
+// the last error (unwrapped if permanent), or ctx's error once it is done.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context, attempt int) error) (int, error) {
+	runCtx := ctx
+	if p.OverallTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, p.OverallTimeout)
+		defer cancel()
+	}
+
+	maxAttempts := p.Attempts()
+	var lastErr error
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(p.Backoff(attempt - 1))
+			select {
+			case <-runCtx.Done():
+				timer.Stop()
+				if err := ctx.Err(); err != nil {
+					return attempt - 1, err
+				}
+				return attempt - 1, lastErr
+			case <-timer.C:
+			}
+		}
+
+		err := runAttempt(runCtx, p.AttemptTimeout, attempt, fn)
+		if err == nil {
+			return attempt, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return attempt, ctxErr
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return attempt, permanent.err
+		}
+		lastErr = err
+
+		if runCtx.Err() != nil {
+			return attempt, lastErr
+		}
+	}
+
+	return maxAttempts, lastErr
+}
+
+// runAttempt calls fn with a context bounded by the attempt timeout
+func runAttempt(ctx context.Context, timeout time.Duration, attempt int, fn func(ctx context.Context, attempt int) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return fn(ctx, attempt)
+}
@@ -0,0 +1,198 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "first attempt",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2},
+			attempt: 1,
+			want:    100 * time.Millisecond,
+		},
+		{
+			name:    "exponential growth",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2},
+			attempt: 4,
+			want:    800 * time.Millisecond,
+		},
+		{
+			name:    "capped at max backoff",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2},
+			attempt: 3,
+			want:    300 * time.Millisecond,
+		},
+		{
+			name:    "capped after many attempts",
+			policy:  Policy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 10},
+			attempt: 1000,
+			want:    5 * time.Second,
+		},
+		{
+			name:    "multiplier below one is constant",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, Multiplier: 0.5},
+			attempt: 5,
+			want:    100 * time.Millisecond,
+		},
+		{
+			name:    "initial backoff above max",
+			policy:  Policy{InitialBackoff: 2 * time.Second, MaxBackoff: time.Second, Multiplier: 2},
+			attempt: 1,
+			want:    time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Backoff(tt.attempt); got != tt.want {
+				t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		attempt  int
+		min, max time.Duration
+	}{
+		{
+			name:    "half jitter",
+			policy:  Policy{InitialBackoff: time.Second, Multiplier: 2, Jitter: 0.5},
+			attempt: 2,
+			min:     time.Second,
+			max:     2 * time.Second,
+		},
+		{
+			name:    "full jitter",
+			policy:  Policy{InitialBackoff: time.Second, Multiplier: 2, Jitter: 1},
+			attempt: 1,
+			min:     0,
+			max:     time.Second,
+		},
+		{
+			name:    "jitter above one is full jitter",
+			policy:  Policy{InitialBackoff: time.Second, Multiplier: 2, Jitter: 3},
+			attempt: 1,
+			min:     0,
+			max:     time.Second,
+		},
+		{
+			name:    "jitter applies after the cap",
+			policy:  Policy{InitialBackoff: time.Second, MaxBackoff: 4 * time.Second, Multiplier: 2, Jitter: 0.25},
+			attempt: 10,
+			min:     3 * time.Second,
+			max:     4 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				got := tt.policy.Backoff(tt.attempt)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("Backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	tests := []struct {
+		maxAttempts int
+		want        int
+	}{
+		{maxAttempts: -1, want: 1},
+		{maxAttempts: 0, want: 1},
+		{maxAttempts: 1, want: 1},
+		{maxAttempts: 4, want: 4},
+	}
+
+	for _, tt := range tests {
+		if got := (Policy{MaxAttempts: tt.maxAttempts}).Attempts(); got != tt.want {
+			t.Errorf("Attempts() with MaxAttempts %d = %d, want %d", tt.maxAttempts, got, tt.want)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		failures     int   // attempts that fail before fn succeeds
+		failWith     error // error of the failing attempts
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "first attempt succeeds", maxAttempts: 3, wantAttempts: 1},
+		{name: "succeeds after retries", maxAttempts: 3, failures: 2, failWith: errTransient, wantAttempts: 3},
+		{name: "attempts run out", maxAttempts: 3, failures: 5, failWith: errTransient, wantAttempts: 3, wantErr: errTransient},
+		{name: "permanent error stops", maxAttempts: 3, failures: 5, failWith: Permanent(errFatal), wantAttempts: 1, wantErr: errFatal},
+		{name: "zero attempts still tries once", maxAttempts: 0, failures: 5, failWith: errTransient, wantAttempts: 1, wantErr: errTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Policy{MaxAttempts: tt.maxAttempts, InitialBackoff: time.Millisecond, Multiplier: 2}
+			calls := 0
+			attempts, err := Do(context.Background(), policy, func(ctx context.Context, attempt int) error {
+				calls++
+				if attempt != calls {
+					t.Errorf("attempt = %d, want %d", attempt, calls)
+				}
+				if calls <= tt.failures {
+					return tt.failWith
+				}
+				return nil
+			})
+
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("attempts = %d, calls = %d, want %d", attempts, calls, tt.wantAttempts)
+			}
+			if err != tt.wantErr {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDoContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 5, InitialBackoff: time.Hour}
+
+	attempts, err := Do(ctx, policy, func(ctx context.Context, attempt int) error {
+		cancel()
+		return errors.New("transient")
+	})
+	if attempts != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() = %d, %v, want 1, %v", attempts, err, context.Canceled)
+	}
+}
+
+func TestDoOverallTimeout(t *testing.T) {
+	errTransient := errors.New("transient")
+	policy := Policy{MaxAttempts: 5, InitialBackoff: time.Hour, OverallTimeout: 20 * time.Millisecond}
+
+	attempts, err := Do(context.Background(), policy, func(ctx context.Context, attempt int) error {
+		return errTransient
+	})
+	if attempts != 1 || err != errTransient {
+		t.Errorf("Do() = %d, %v, want 1, %v", attempts, err, errTransient)
+	}
+}
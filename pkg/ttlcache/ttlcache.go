@@ -0,0 +1,116 @@
+package ttlcache
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats reports cache usage since the cache was created
+type Stats struct {
+	Entries int     `json:"entries"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+type entry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// Cache is an in-memory key/value cache whose entries expire after a fixed TTL
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]entry
+	hits    int64
+	misses  int64
+}
+
+// New creates a cache that keeps entries for ttl and holds at most maxEntries;
+// a maxEntries of zero or less means no limit
+func New(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]entry),
+	}
+}
+
+// Get returns the value stored for key and counts a hit or a miss
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if ok && time.Now().After(e.expiresAt) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	return e.value, true
+}
+
+// Set stores value for key, evicting the entry closest to expiry when the
+// cache is full
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, exists := c.entries[key]; !exists && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = entry{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Delete removes the entry for key
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// Stats returns the number of entries and the hit/miss counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Entries: len(c.entries),
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// evict drops expired entries, or the oldest entry when none have expired
+func (c *Cache) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+
+	for key, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || e.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, e.expiresAt
+		}
+	}
+
+	if len(c.entries) >= c.maxEntries && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
@@ -2,6 +2,7 @@ package validator
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -105,6 +106,17 @@ func (v *Validator) URL(field, value, message string) *Validator {
 	return v
 }
 
+// Range validates that an integer lies within [min, max]
+func (v *Validator) Range(field string, value, min, max int, message string) *Validator {
+	if value < min || value > max {
+		if message == "" {
+			message = field + " must be between " + strconv.Itoa(min) + " and " + strconv.Itoa(max)
+		}
+		v.errors.Add(field, message)
+	}
+	return v
+}
+
 // Custom allows custom validation logic
 func (v *Validator) Custom(field string, isValid bool, message string) *Validator {
 	if !isValid {
@@ -0,0 +1,170 @@
+package worddiff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Operation types
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// maxCells bounds the size of the comparison table; texts whose changed
+// middle parts are larger are diffed as a single replacement
+const maxCells = 4_000_000
+
+// Op is a run of text that is unchanged, inserted or deleted
+type Op struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Words returns the word-level edit script that turns a into b. Whitespace
+// is kept, so joining the equal and delete texts gives a and joining the
+// equal and insert texts gives b.
+func Words(a, b string) []Op {
+	x, y := tokenize(a), tokenize(b)
+
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	ops = appendOp(ops, Equal, x[:prefix]...)
+	ops = append(ops, diff(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	ops = appendOp(ops, Equal, x[len(x)-suffix:]...)
+	return merge(ops)
+}
+
+// Stats counts the words inserted and deleted by an edit script
+func Stats(ops []Op) (inserted, deleted int) {
+	for _, op := range ops {
+		switch op.Type {
+		case Insert:
+			inserted += len(strings.Fields(op.Text))
+		case Delete:
+			deleted += len(strings.Fields(op.Text))
+		}
+	}
+	return inserted, deleted
+}
+
+// diff computes a longest common subsequence edit script
+func diff(x, y []string) []Op {
+	if len(x) == 0 || len(y) == 0 || len(x)*len(y) > maxCells {
+		var ops []Op
+		ops = appendOp(ops, Delete, x...)
+		return appendOp(ops, Insert, y...)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	width := len(y) + 1
+	lcs := make([]int32, (len(x)+1)*width)
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else {
+				lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+			}
+		}
+	}
+
+	var ops []Op
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = appendOp(ops, Equal, x[i])
+			i++
+			j++
+		case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			ops = appendOp(ops, Delete, x[i])
+			i++
+		default:
+			ops = appendOp(ops, Insert, y[j])
+			j++
+		}
+	}
+	ops = appendOp(ops, Delete, x[i:]...)
+	return appendOp(ops, Insert, y[j:]...)
+}
+
+// tokenize splits text into alternating runs of whitespace and non-whitespace
+func tokenize(text string) []string {
+	var tokens []string
+	start, space := 0, false
+	for i, r := range text {
+		if i == 0 {
+			space = unicode.IsSpace(r)
+			continue
+		}
+		if unicode.IsSpace(r) != space {
+			tokens = append(tokens, text[start:i])
+			start, space = i, !space
+		}
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+func appendOp(ops []Op, opType string, tokens ...string) []Op {
+	if len(tokens) == 0 {
+		return ops
+	}
+	return append(ops, Op{Type: opType, Text: strings.Join(tokens, "")})
+}
+
+// merge groups each run of changes into one delete followed by one insert.
+// Whitespace that is unchanged between two changes joins the run, so that a
+// replaced phrase reads as one change rather than word by word.
+func merge(ops []Op) []Op {
+	var merged []Op
+	var deleted, inserted strings.Builder
+
+	flush := func() {
+		if deleted.Len() > 0 {
+			merged = append(merged, Op{Type: Delete, Text: deleted.String()})
+		}
+		if inserted.Len() > 0 {
+			merged = append(merged, Op{Type: Insert, Text: inserted.String()})
+		}
+		deleted.Reset()
+		inserted.Reset()
+	}
+
+	for i, op := range ops {
+		switch op.Type {
+		case Delete:
+			deleted.WriteString(op.Text)
+		case Insert:
+			inserted.WriteString(op.Text)
+		default:
+			changing := deleted.Len() > 0 || inserted.Len() > 0
+			if changing && i+1 < len(ops) && ops[i+1].Type != Equal && strings.TrimSpace(op.Text) == "" {
+				deleted.WriteString(op.Text)
+				inserted.WriteString(op.Text)
+				continue
+			}
+			flush()
+			if n := len(merged); n > 0 && merged[n-1].Type == Equal {
+				merged[n-1].Text += op.Text
+				continue
+			}
+			merged = append(merged, op)
+		}
+	}
+	flush()
+
+	return merged
+}
@@ -0,0 +1,188 @@
+package worddiff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Op
+	}{
+		{
+			name: "empty",
+			a:    "",
+			b:    "",
+			want: nil,
+		},
+		{
+			name: "unchanged",
+			a:    "the fox ran",
+			b:    "the fox ran",
+			want: []Op{{Equal, "the fox ran"}},
+		},
+		{
+			name: "all inserted",
+			a:    "",
+			b:    "once upon a time",
+			want: []Op{{Insert, "once upon a time"}},
+		},
+		{
+			name: "all deleted",
+			a:    "once upon a time",
+			b:    "",
+			want: []Op{{Delete, "once upon a time"}},
+		},
+		{
+			name: "word inserted",
+			a:    "the fox ran",
+			b:    "the red fox ran",
+			want: []Op{{Equal, "the "}, {Insert, "red "}, {Equal, "fox ran"}},
+		},
+		{
+			name: "word deleted",
+			a:    "the red fox ran",
+			b:    "the fox ran",
+			want: []Op{{Equal, "the "}, {Delete, "red "}, {Equal, "fox ran"}},
+		},
+		{
+			name: "phrase replaced as one change",
+			a:    "the quick brown fox",
+			b:    "the slow grey fox",
+			want: []Op{{Equal, "the "}, {Delete, "quick brown"}, {Insert, "slow grey"}, {Equal, " fox"}},
+		},
+		{
+			name: "separate changes",
+			a:    "a b c d",
+			b:    "a x c y",
+			want: []Op{{Equal, "a "}, {Delete, "b"}, {Insert, "x"}, {Equal, " c "}, {Delete, "d"}, {Insert, "y"}},
+		},
+		{
+			name: "whitespace kept",
+			a:    "the cat sat\non the mat",
+			b:    "the dog sat\non a mat",
+			want: []Op{{Equal, "the "}, {Delete, "cat"}, {Insert, "dog"}, {Equal, " sat\non "}, {Delete, "the"}, {Insert, "a"}, {Equal, " mat"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Words(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Words(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			checkScript(t, got, tt.a, tt.b)
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []string
+		want []Op
+	}{
+		{
+			name: "longest common subsequence kept",
+			x:    []string{"a", "b", "c", "d", "e"},
+			y:    []string{"b", "x", "d", "e", "y"},
+			want: []Op{{Delete, "a"}, {Equal, "b"}, {Delete, "c"}, {Insert, "x"}, {Equal, "d"}, {Equal, "e"}, {Insert, "y"}},
+		},
+		{
+			name: "nothing in common",
+			x:    []string{"a", "b"},
+			y:    []string{"c"},
+			want: []Op{{Delete, "a"}, {Delete, "b"}, {Insert, "c"}},
+		},
+		{
+			name: "empty side",
+			x:    []string{"a", "b"},
+			y:    nil,
+			want: []Op{{Delete, "ab"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff(tt.x, tt.y); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff(%q, %q) = %v, want %v", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordsMaxCells(t *testing.T) {
+	tests := []struct {
+		name       string
+		words      int // changed words on each side of the shared one
+		wantShared bool
+	}{
+		{name: "below the limit", words: 300, wantShared: true},
+		{name: "above the limit", words: 1500, wantShared: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := "start " + changedWords("a", tt.words) + " shared " + changedWords("c", tt.words) + " end"
+			b := "start " + changedWords("b", tt.words) + " shared " + changedWords("d", tt.words) + " end"
+			if cells := len(tokenize(a)) * len(tokenize(b)); (cells > maxCells) == tt.wantShared {
+				t.Fatalf("%d cells for a case meant to be %s", cells, tt.name)
+			}
+
+			ops := Words(a, b)
+			checkScript(t, ops, a, b)
+
+			shared := false
+			for _, op := range ops {
+				if op.Type == Equal && strings.Contains(op.Text, "shared") {
+					shared = true
+				}
+			}
+			if shared != tt.wantShared {
+				t.Errorf("shared word kept equal: %v, want %v", shared, tt.wantShared)
+			}
+			if !tt.wantShared && len(ops) != 4 {
+				t.Errorf("got %d ops, want the equal ends around one delete and one insert", len(ops))
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	ops := Words("the quick brown fox jumped", "the slow fox jumped high")
+	inserted, deleted := Stats(ops)
+	if inserted != 2 || deleted != 2 {
+		t.Errorf("Stats() = %d inserted, %d deleted, want 2 and 2", inserted, deleted)
+	}
+}
+
+// checkScript checks that an edit script turns a into b
+func checkScript(t *testing.T, ops []Op, a, b string) {
+	t.Helper()
+
+	var from, to strings.Builder
+	for _, op := range ops {
+		if op.Type != Insert {
+			from.WriteString(op.Text)
+		}
+		if op.Type != Delete {
+			to.WriteString(op.Text)
+		}
+	}
+	if from.String() != a || to.String() != b {
+		t.Errorf("edit script does not turn a into b:\n%q\n%q", from.String(), to.String())
+	}
+}
+
+// changedWords returns n distinct space-separated words with a prefix
+func changedWords(prefix string, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,84 @@
+#!/bin/bash
+
+# Record a real upstream story generation output as a pkg/llmjson golden case
+# Usage: scripts/capture-llm-output.sh <generation-log-id> <case-name>
+#
+# Reads the generation log from a running server, writes the model's output to
+# pkg/llmjson/testdata/captured/<case-name>.txt and writes its golden file.
+# Other golden files are left untouched. Review the recorded text for personal
+# content before committing it.
+#
+# Environment:
+#   POCKETBASE_URL  server URL (default http://127.0.0.1:8090)
+#   ADMIN_TOKEN     superuser auth token
+
+set -e
+
+source "$(dirname "$0")/utils/common.sh"
+
+ensure_project_root
+
+LOG_ID="$1"
+CASE_NAME="$2"
+POCKETBASE_URL="${POCKETBASE_URL:-http://127.0.0.1:8090}"
+TESTDATA_DIR="pkg/llmjson/testdata/captured"
+
+if [ -z "$LOG_ID" ] || [ -z "$CASE_NAME" ]; then
+    log_error "Usage: scripts/capture-llm-output.sh <generation-log-id> <case-name>"
+    exit 1
+fi
+
+if ! [[ "$CASE_NAME" =~ ^[a-z0-9_]+$ ]]; then
+    log_error "Case name must contain only lower-case letters, digits and underscores"
+    exit 1
+fi
+
+if [ -z "$ADMIN_TOKEN" ]; then
+    log_error "ADMIN_TOKEN must be set to a superuser auth token"
+    exit 1
+fi
+
+if ! command -v jq &> /dev/null; then
+    log_error "jq is required to read the generation log"
+    exit 1
+fi
+
+mkdir -p "$TESTDATA_DIR"
+OUTPUT_FILE="$TESTDATA_DIR/$CASE_NAME.txt"
+if [ -e "$OUTPUT_FILE" ]; then
+    log_error "$OUTPUT_FILE already exists"
+    exit 1
+fi
+
+log_progress "Fetching generation log $LOG_ID"
+LOG_JSON=$(curl -sf -H "Authorization: $ADMIN_TOKEN" "$POCKETBASE_URL/api/admin/generation-logs/$LOG_ID") || {
+    log_error "Failed to fetch generation log $LOG_ID"
+    exit 1
+}
+
+if echo "$LOG_JSON" | jq -r '.data.response' | grep -q '… \[truncated [0-9]* characters\]$'; then
+    log_warning "The logged response was truncated; raise GENERATION_LOG_MAX_BODY to record it whole"
+fi
+
+# Rivet failures log the whole upstream body; keep only the graph's output value
+echo "$LOG_JSON" | jq -j '
+    .data.response as $response
+    | ($response | try fromjson catch null) as $body
+    | if ($body | type) == "object" and ($body.output.value | type) == "string"
+      then $body.output.value
+      else $response
+      end' > "$OUTPUT_FILE"
+
+if [ ! -s "$OUTPUT_FILE" ]; then
+    rm -f "$OUTPUT_FILE"
+    rmdir "$TESTDATA_DIR" 2>/dev/null || true
+    log_error "Generation log $LOG_ID has no response"
+    exit 1
+fi
+
+log_success "Recorded $OUTPUT_FILE"
+
+log_progress "Writing the golden file"
+go test ./pkg/llmjson -run "^TestExtractGolden\$/^captured\$/^${CASE_NAME}\$" -update
+
+log_success "Recorded $CASE_NAME; review $TESTDATA_DIR/$CASE_NAME.golden before committing"
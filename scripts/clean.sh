@@ -1,6 +1,5 @@
 #!/bin/bash
 
-<<<<<<< HEAD
 # Clean script - removes build artifacts and optionally dependencies
 set -e
 
@@ -18,9 +17,9 @@ case $MODE in
     "build")
         log_progress "Cleaning build artifacts"
         
-        if [ -f "pocketbase/pocketbase-app" ]; then
-            rm -f pocketbase/pocketbase-app
-            log_success "Removed pocketbase/pocketbase-app"
+        if [ -f "pocket-app" ]; then
+            rm -f pocket-app
+            log_success "Removed pocket-app"
         fi
         
         if [ -d "client/dist" ]; then
@@ -38,17 +37,15 @@ case $MODE in
         fi
         
         # Clean Go mod cache (optional)
-        if [ -f "pocketbase/go.sum" ]; then
-            cd pocketbase && go clean -modcache && cd ..
-            log_success "Cleaned Go module cache"
-        fi
+        go clean -modcache
+        log_success "Cleaned Go module cache"
         ;;
         
     "all")
         log_progress "Cleaning everything"
         
         # Clean build artifacts
-        [ -f "pocketbase/pocketbase-app" ] && rm -f pocketbase/pocketbase-app
+        [ -f "pocket-app" ] && rm -f pocket-app
         [ -d "client/dist" ] && rm -rf client/dist
         
         # Clean dependencies
@@ -59,9 +56,7 @@ case $MODE in
         [ -L "client/.env.local" ] && rm -f client/.env.local
         
         # Clean Go cache (optional)
-        if [ -f "pocketbase/go.sum" ]; then
-            cd pocketbase && go clean -modcache && cd ..
-        fi
+        go clean -modcache
         
         log_success "All artifacts cleaned"
         ;;
@@ -76,61 +71,3 @@ case $MODE in
 esac
 
 log_success "Clean complete!"
-=======
-# Clean build artifacts and temporary files
-set -e
-
-# Colors for output
-RED='\033[0;31m'
-GREEN='\033[0;32m'
-YELLOW='\033[1;33m'
-BLUE='\033[0;34m'
-NC='\033[0m' # No Color
-
-echo -e "${GREEN}🧹 Cleaning build artifacts and temporary files...${NC}"
-
-# Navigate to project root
-cd "$(dirname "$0")/.."
-
-# Remove Go binary
-if [ -f "pocket-app" ]; then
-    echo -e "${BLUE}🗑️  Removing Go binary...${NC}"
-    rm -f pocket-app
-fi
-
-# Remove tmp directory (air hot reload)
-if [ -d "tmp" ]; then
-    echo -e "${BLUE}🗑️  Removing tmp directory...${NC}"
-    rm -rf tmp
-fi
-
-# Remove build logs
-if [ -f "build-errors.log" ]; then
-    echo -e "${BLUE}🗑️  Removing build logs...${NC}"
-    rm -f build-errors.log
-fi
-
-# Clean Go module cache (optional)
-echo -e "${BLUE}🧹 Cleaning Go module cache...${NC}"
-go clean -modcache 2>/dev/null || echo -e "${YELLOW}⚠️ Could not clean Go module cache${NC}"
-
-# Clean frontend build artifacts
-if [ -d "client/dist" ]; then
-    echo -e "${BLUE}🗑️  Removing frontend build...${NC}"
-    rm -rf client/dist
-fi
-
-if [ -d "client/node_modules/.cache" ]; then
-    echo -e "${BLUE}🗑️  Removing frontend cache...${NC}"
-    rm -rf client/node_modules/.cache
-fi
-
-# Clean logs directory but keep the directory
-if [ -d "logs" ]; then
-    echo -e "${BLUE}🗑️  Cleaning logs...${NC}"
-    rm -f logs/*.log
-fi
-
-echo -e "${GREEN}✅ Cleanup completed!${NC}"
-echo -e "${BLUE}💡 Run ./scripts/build.sh to rebuild the application${NC}"
->>>>>>> d636ce03a53456eaef001ada76af30b2d6174ea9
@@ -18,32 +18,23 @@ setup_env
 
 case $COMPONENT in
     "pocketbase")
-        # Setup pocketbase Go extension
-        if [ ! -f "pocketbase/go.mod" ]; then
-            log_info "Initializing PocketBase Go extension..."
-            cd pocketbase && go mod init pocketbase-extension && cd ..
-        fi
-
-        # Download dependencies
-        cd pocketbase
-        if [ ! -f "go.sum" ]; then
-            log_info "Downloading Go dependencies..."
-            go mod tidy
-        fi
-        cd ..
+        # Download Go dependencies of the application
+        log_info "Downloading Go dependencies..."
+        go mod download
 
-        log_section "Starting PocketBase Go Extension"
+        log_section "Starting PocketBase Application"
         log_info "PocketBase: http://localhost:8090"
         log_info "Admin UI: http://localhost:8090/_/"
-        log_info "Test endpoint: http://localhost:8090/test"
+        log_info "API: http://localhost:8090/api/"
         echo ""
         
-        log_info "Starting PocketBase with Go extension..."
+        log_info "Starting PocketBase application (./cmd/server)..."
         log_info "Press Ctrl+C to stop the server"
         echo ""
 
         # Start PocketBase in development mode
-        cd pocketbase && go run . serve
+        load_env
+        go run ./cmd/server serve
         ;;
         
     "frontend")
@@ -102,19 +93,9 @@ case $COMPONENT in
             exit 1
         fi
         
-        # Setup pocketbase Go extension
-        if [ ! -f "pocketbase/go.mod" ]; then
-            log_info "Initializing PocketBase Go extension..."
-            cd pocketbase && go mod init pocketbase-extension && cd ..
-        fi
-
-        # Download dependencies
-        cd pocketbase
-        if [ ! -f "go.sum" ]; then
-            log_info "Downloading Go dependencies..."
-            go mod tidy
-        fi
-        cd ..
+        # Download Go dependencies of the application
+        log_info "Downloading Go dependencies..."
+        go mod download
 
         # Setup frontend
         if [ ! -d "client/node_modules" ]; then
@@ -134,7 +115,7 @@ case $COMPONENT in
 
         log_info "PocketBase: http://localhost:8090"
         log_info "Admin UI: http://localhost:8090/_/"
-        log_info "Test endpoint: http://localhost:8090/test"
+        log_info "API: http://localhost:8090/api/"
         log_info "Frontend: http://localhost:5173"
         log_info "Rivet API: http://localhost:$RIVET_PORT"
         echo ""
@@ -162,7 +143,7 @@ case $COMPONENT in
         trap cleanup INT TERM EXIT
         
         # Start PocketBase with output to log file
-        (cd pocketbase && go run . serve > "$POCKETBASE_LOG" 2>&1) &
+        (load_env && go run ./cmd/server serve > "$POCKETBASE_LOG" 2>&1) &
         POCKETBASE_PID=$!
         
         # Start frontend with output to log file
@@ -189,7 +170,7 @@ case $COMPONENT in
         
     *)
         log_error "Usage: $0 [pocketbase|frontend|rivet|both]"
-        log_info "  pocketbase - Start PocketBase Go extension server (default)"
+        log_info "  pocketbase - Start the PocketBase application server (default)"
         log_info "  frontend   - Start frontend dev server"
         log_info "  rivet      - Start Rivet AI server"
         log_info "  both       - Start all servers concurrently"
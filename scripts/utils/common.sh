@@ -51,6 +51,16 @@ setup_env() {
     log_success "Environment setup complete"
 }
 
+# Export the variables in .env.local for the Go application, which reads its
+# configuration from the environment
+load_env() {
+    if [ -f ".env.local" ]; then
+        set -a
+        source .env.local
+        set +a
+    fi
+}
+
 # Install dependencies for a component
 install_deps() {
     local component=$1